@@ -0,0 +1,123 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// runImport 导入CSV/XLSX表格批量生成收据
+//
+// 与服务共用数据库，bbolt只允许一个进程打开，需在服务停止时运行。
+func runImport(args []string) {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	outPath := fs.String("o", "", "输出文件，默认为当前目录下的 receipts_<时间>.zip 或 .pdf")
+	output := fs.String("output", model.BatchOutputZip, "输出方式：zip 或 pdf（合并PDF）")
+	format := fs.String("format", service.FormatPDF, "ZIP中的文件格式：pdf、png、jpeg")
+	worksheet := fs.String("worksheet", "", "XLSX工作表名称，默认第一个工作表")
+	mappingPath := fs.String("mapping", "", "表头映射JSON文件，叠加在内置映射和RECEIPT_IMPORT_MAPPING之上")
+	dryRun := fs.Bool("dry-run", false, "只校验表格，不生成收据")
+	sheet := fs.String("sheet", "", "拼版纸张：A4、A5，只用于合并PDF")
+	up := fs.Int("up", 0, "每张纸的收据数，默认按纸张尺寸尽量多放")
+	gutter := fs.Float64("gutter", service.DefaultGutter, "收据之间的间距（mm）")
+	cropMarks := fs.Bool("crop-marks", false, "绘制裁切线")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "用法: %s import [选项] 表格文件(.csv|.xlsx)\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	req := &model.ImportRequest{
+		Output:    *output,
+		Format:    *format,
+		Worksheet: *worksheet,
+		DryRun:    *dryRun,
+		ImpositionRequest: model.ImpositionRequest{
+			Sheet:     *sheet,
+			Up:        *up,
+			Gutter:    gutter,
+			CropMarks: *cropMarks,
+		},
+	}
+	if *mappingPath != "" {
+		content, err := os.ReadFile(*mappingPath)
+		if err != nil {
+			log.Fatal("读取表头映射失败:", err)
+		}
+		req.Mapping = string(content)
+	}
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		log.Fatal("参数错误: ", err)
+	}
+
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal("打开表格失败:", err)
+	}
+	defer in.Close()
+
+	a := newApp()
+	defer a.db.Close()
+
+	var w io.Writer = io.Discard
+	if !req.DryRun {
+		if *outPath == "" {
+			*outPath = fmt.Sprintf("receipts_%s.%s", time.Now().Format("20060102_150405"), req.Output)
+		}
+		out, err := os.Create(*outPath)
+		if err != nil {
+			log.Fatal("创建输出文件失败:", err)
+		}
+		defer out.Close()
+		w = out
+	}
+
+	results, err := a.receipts.Import(w, in, filepath.Base(fs.Arg(0)), req)
+	failed := 0
+	for _, r := range results {
+		if r.Success {
+			fmt.Printf("第%d行 %s: %s\n", r.Row, r.RoomNumber, importResultText(r))
+		} else {
+			failed++
+			fmt.Fprintf(os.Stderr, "第%d行 %s: %s\n", r.Row, r.RoomNumber, r.Message)
+		}
+	}
+	if err != nil {
+		if !req.DryRun {
+			os.Remove(*outPath)
+		}
+		a.db.Close()
+		log.Fatal("导入失败: ", err)
+	}
+
+	if req.DryRun {
+		fmt.Printf("校验完成：共%d行，通过%d行，失败%d行\n", len(results), len(results)-failed, failed)
+		return
+	}
+	fmt.Printf("导入完成：共%d行，生成%d张收据，失败%d行，输出到 %s\n", len(results), len(results)-failed, failed, *outPath)
+}
+
+// importResultText 成功行的说明：收据编号及其在输出中的位置
+func importResultText(r *model.BatchItemResult) string {
+	switch {
+	case r.FileName != "":
+		return fmt.Sprintf("%s -> %s", r.ReceiptID, r.FileName)
+	case r.Page > 0:
+		return fmt.Sprintf("%s -> 第%d页", r.ReceiptID, r.Page)
+	case r.ReceiptID != "":
+		return r.ReceiptID
+	}
+	return r.Message
+}
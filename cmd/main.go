@@ -1,33 +1,102 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"os"
 	"receipt/internal/handler"
+	"receipt/internal/importer"
+	"receipt/internal/model"
 	"receipt/internal/service"
+	"receipt/internal/storage"
+	"receipt/internal/store"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	// 子命令
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify-ledger" {
+		runVerifyLedger(os.Args[2:])
+		return
+	}
+
 	// 设置Gin模式
 	gin.SetMode(gin.ReleaseMode)
 
 	// 创建Gin引擎
 	r := gin.Default()
 
-	// 配置路径 - 新系统不需要模板文件
-	templatePath := "" // 不再使用模板
-	outputPath := "output"
+	a := newApp()
+	defer a.db.Close()
+	receiptHandler, templateHandler, sealHandler := a.receipts, a.templates, a.seals
 
-	// 创建服务
-	pdfService := service.NewPDFService(templatePath, outputPath)
-	receiptHandler := handler.NewReceiptHandler(pdfService)
+	// 启动异步任务队列，上次退出时未完成的任务继续执行
+	workers, err := strconv.Atoi(getEnv("RECEIPT_JOB_WORKERS", strconv.Itoa(service.DefaultJobWorkers)))
+	if err != nil {
+		log.Fatal("任务并发数无效:", err)
+	}
+	jobs, err := service.NewJobQueue(a.pdf, a.db, a.jobFiles, workers)
+	if err != nil {
+		log.Fatal("创建任务队列失败:", err)
+	}
+	if err := jobs.Start(); err != nil {
+		log.Fatal("启动任务队列失败:", err)
+	}
+	// 定期删除结束超过保留时间的任务及其文件
+	jobRetention, err := time.ParseDuration(getEnv("RECEIPT_JOB_RETENTION", service.DefaultJobRetention.String()))
+	if err != nil || jobRetention < 0 {
+		log.Fatal("任务保留时间无效:", os.Getenv("RECEIPT_JOB_RETENTION"))
+	}
+	jobs.StartCleanup(jobRetention, service.DefaultJobCleanupInterval)
+	receiptHandler.SetJobQueue(jobs)
+
+	// 将以前按文件名保存的备份迁移为按内容寻址，之后定期校验备份
+	migrated, err := a.backups.Migrate()
+	if err != nil {
+		log.Fatal("迁移收据备份失败:", err)
+	}
+	if migrated > 0 {
+		log.Printf("已迁移%d个收据备份", migrated)
+	}
+	scrubInterval, err := time.ParseDuration(getEnv("RECEIPT_SCRUB_INTERVAL", service.DefaultScrubInterval.String()))
+	if err != nil || scrubInterval < 0 {
+		log.Fatal("备份校验间隔无效:", os.Getenv("RECEIPT_SCRUB_INTERVAL"))
+	}
+	if scrubInterval > 0 {
+		a.backups.StartScrub(scrubInterval)
+	}
+
+	// 按保留策略定期清理收据备份
+	janitor, interval, err := newJanitor(a.backups)
+	if err != nil {
+		log.Fatal("配置备份保留策略失败:", err)
+	}
+	janitor.Start(interval)
+	receiptHandler.SetJanitor(janitor)
+
+	// 生成接口的幂等处理，避免小程序重试时重复生成收据
+	idempotency, err := newIdempotency(a.db)
+	if err != nil {
+		log.Fatal("配置幂等处理失败:", err)
+	}
+	if idempotency != nil {
+		idempotency.Start(service.DefaultIdempotencyPurge)
+		receiptHandler.SetIdempotency(idempotency)
+	}
 
 	// 添加CORS中间件
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key")
+		c.Header("Access-Control-Expose-Headers", "Content-Disposition, X-Receipt-Number, X-Replaces-Receipt, X-Batch-Succeeded, X-Batch-Failed, X-Batch-Failed-Items, Idempotent-Replayed")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -42,20 +111,78 @@ func main() {
 	{
 		receipt := api.Group("/receipt")
 		{
-			receipt.POST("/generate", receiptHandler.GenerateReceipt)                  // 直接返回PDF文件
-			receipt.POST("/miniprogram", receiptHandler.GenerateReceiptForMiniProgram) // 为小程序返回Base64 PDF
-			receipt.POST("/generate-image", receiptHandler.GenerateReceiptImage)       // 为小程序返回Base64图片
+			// 生成接口支持 Idempotency-Key，重复请求返回首次生成的收据
+			idempotent := receiptHandler.Idempotent()
+			receipt.POST("/generate", idempotent, receiptHandler.GenerateReceipt)                  // 直接返回PDF文件
+			receipt.POST("/miniprogram", idempotent, receiptHandler.GenerateReceiptForMiniProgram) // 为小程序返回Base64 PDF
+			receipt.POST("/generate-image", idempotent, receiptHandler.GenerateReceiptImage)       // 为小程序返回Base64图片
+			receipt.POST("/batch", receiptHandler.GenerateReceiptBatch)                            // 批量生成，返回ZIP或合并PDF
+			receipt.POST("/import", receiptHandler.ImportReceipts)                                 // 导入CSV/XLSX表格批量生成
 			receipt.POST("/info", receiptHandler.GetReceiptInfo)
+			receipt.POST("/verify", receiptHandler.VerifyReceipt) // 校验收据签名
 
 			// 备份管理相关接口
 			backup := receipt.Group("/backup")
 			{
 				backup.GET("/list", receiptHandler.ListBackupReceipts)                  // 列出备份文件
 				backup.GET("/download/:fileName", receiptHandler.DownloadBackupReceipt) // 下载备份文件
+				backup.GET("/retention", receiptHandler.GetBackupRetention)             // 预演备份清理
+				backup.GET("/scrub", receiptHandler.GetBackupScrub)                     // 最近一次备份校验结果
+				backup.POST("/scrub", receiptHandler.ScrubBackups)                      // 立即校验备份
 			}
 		}
+
+		// 收据查询相关接口
+		receipts := api.Group("/receipts")
+		{
+			receipts.GET("", receiptHandler.ListReceipts)                // 查询收据
+			receipts.GET("/:id", receiptHandler.GetReceipt)              // 收据详情
+			receipts.GET("/:id/render", receiptHandler.RenderReceipt)    // 补打收据
+			receipts.POST("/:id/void", receiptHandler.VoidReceipt)       // 作废收据
+			receipts.POST("/:id/reissue", receiptHandler.ReissueReceipt) // 重开收据
+		}
+
+		// 异步任务相关接口
+		jobGroup := api.Group("/jobs")
+		{
+			jobGroup.GET("", receiptHandler.ListJobs)                     // 查询任务
+			jobGroup.GET("/:id", receiptHandler.GetJob)                   // 任务进度和每项结果
+			jobGroup.GET("/:id/result", receiptHandler.DownloadJobResult) // 下载任务生成的收据
+			jobGroup.POST("/:id/cancel", receiptHandler.CancelJob)        // 取消任务
+			jobGroup.POST("/:id/retry", receiptHandler.RetryJob)          // 重试失败的项
+		}
+
+		// 开具记录相关接口
+		ledger := api.Group("/ledger")
+		{
+			ledger.GET("/export", receiptHandler.ExportLedger) // 导出开具记录
+			ledger.GET("/verify", receiptHandler.VerifyLedger) // 校验开具记录
+		}
+
+		// 模板管理相关接口
+		templateGroup := api.Group("/templates")
+		{
+			templateGroup.GET("", templateHandler.ListTemplates)                     // 列出模板
+			templateGroup.POST("", templateHandler.UploadTemplate)                   // 上传模板
+			templateGroup.GET("/:name", templateHandler.GetTemplate)                 // 模板详情
+			templateGroup.GET("/:name/file", templateHandler.DownloadTemplate)       // 下载模板文件
+			templateGroup.DELETE("/:name", templateHandler.DeleteTemplate)           // 删除模板
+			templateGroup.POST("/:name/default", templateHandler.SetDefaultTemplate) // 设置默认模板
+		}
+
+		// 印章图片管理相关接口
+		sealGroup := api.Group("/seals")
+		{
+			sealGroup.GET("", sealHandler.ListSeals)                  // 列出印章图片
+			sealGroup.POST("", sealHandler.UploadSeal)                // 上传印章图片
+			sealGroup.GET("/:owner/:kind", sealHandler.DownloadSeal)  // 下载印章图片
+			sealGroup.DELETE("/:owner/:kind", sealHandler.DeleteSeal) // 删除印章图片
+		}
 	}
 
+	// 收据在线校验，收据二维码中的公开地址
+	r.GET("/verify/:token", receiptHandler.VerifyReceiptToken)
+
 	// 健康检查
 	r.GET("/health", receiptHandler.HealthCheck)
 
@@ -68,9 +195,35 @@ func main() {
 				"生成收据(PDF文件)":     "POST /api/receipt/generate",
 				"生成收据(小程序Base64)": "POST /api/receipt/miniprogram",
 				"生成收据图片(小程序)":     "POST /api/receipt/generate-image",
+				"批量生成收据":          "POST /api/receipt/batch",
+				"导入表格生成收据":        "POST /api/receipt/import",
 				"预览信息":            "POST /api/receipt/info",
+				"校验收据签名":          "POST /api/receipt/verify",
+				"查询收据":            "GET /api/receipts",
+				"收据详情":            "GET /api/receipts/{id}",
+				"补打收据":            "GET /api/receipts/{id}/render?format=pdf|png|jpeg",
+				"作废收据":            "POST /api/receipts/{id}/void",
+				"重开收据":            "POST /api/receipts/{id}/reissue",
+				"查询任务":            "GET /api/jobs",
+				"任务进度":            "GET /api/jobs/{id}",
+				"下载任务结果":          "GET /api/jobs/{id}/result",
+				"取消任务":            "POST /api/jobs/{id}/cancel",
+				"重试任务":            "POST /api/jobs/{id}/retry",
 				"备份文件列表":          "GET /api/receipt/backup/list",
 				"下载备份文件":          "GET /api/receipt/backup/download/{fileName}",
+				"预演备份清理":          "GET /api/receipt/backup/retention",
+				"备份校验结果":          "GET /api/receipt/backup/scrub",
+				"校验备份":            "POST /api/receipt/backup/scrub",
+				"导出开具记录":          "GET /api/ledger/export",
+				"校验开具记录":          "GET /api/ledger/verify",
+				"模板列表":            "GET /api/templates",
+				"上传模板":            "POST /api/templates",
+				"删除模板":            "DELETE /api/templates/{name}",
+				"设置默认模板":          "POST /api/templates/{name}/default",
+				"印章图片列表":          "GET /api/seals",
+				"上传印章图片":          "POST /api/seals",
+				"删除印章图片":          "DELETE /api/seals/{owner}/{kind}",
+				"收据在线校验":          "GET /verify/{token}",
 				"健康检查":            "GET /health",
 			},
 		})
@@ -86,3 +239,198 @@ func main() {
 		log.Fatal("启动服务器失败:", err)
 	}
 }
+
+// app 收据服务的各个组件
+type app struct {
+	pdf       *service.PDFService
+	db        *store.Store
+	receipts  *handler.ReceiptHandler
+	templates *handler.TemplateHandler
+	seals     *handler.SealHandler
+	backups   *service.BackupStore // 收据备份
+	jobFiles  storage.Storage      // 异步任务生成的文件
+}
+
+// newApp 按环境变量创建服务和数据库，配置错误时退出
+func newApp() *app {
+	// 配置路径 - AcroForm模板仅在使用acroform渲染后端时需要
+	templatePath := getEnv("RECEIPT_TEMPLATE", "templates/receipt_template.pdf")
+
+	// 创建服务
+	pdfService := service.NewPDFService(templatePath)
+	if err := pdfService.SetDefaultRenderer(getEnv("RECEIPT_RENDERER", service.RendererGopdf)); err != nil {
+		log.Fatal("配置渲染后端失败:", err)
+	}
+	if err := pdfService.SetRasterizer(getEnv("RECEIPT_RASTERIZER", service.RasterizerLayout)); err != nil {
+		log.Fatal("配置图片渲染方式失败:", err)
+	}
+	if layoutPath := os.Getenv("RECEIPT_LAYOUT"); layoutPath != "" {
+		layout, err := service.LoadLayout(layoutPath)
+		if err != nil {
+			log.Fatal("加载收据版式失败:", err)
+		}
+		pdfService.SetLayout(layout)
+	}
+
+	// 配置收据签名证书，PKCS#12优先，均未配置时生成的收据不签名
+	if p12Path := os.Getenv("RECEIPT_SIGN_PKCS12"); p12Path != "" {
+		signer, err := service.NewSignerFromPKCS12(p12Path, os.Getenv("RECEIPT_SIGN_PASSWORD"))
+		if err != nil {
+			log.Fatal("加载签名证书失败:", err)
+		}
+		pdfService.SetSigner(signer)
+	} else if certPath := os.Getenv("RECEIPT_SIGN_CERT"); certPath != "" {
+		signer, err := service.NewSignerFromPEM(certPath, os.Getenv("RECEIPT_SIGN_KEY"))
+		if err != nil {
+			log.Fatal("加载签名证书失败:", err)
+		}
+		pdfService.SetSigner(signer)
+	}
+
+	// 打开嵌入式数据库，保存收据编号序列和收据登记记录
+	db, err := store.Open(getEnv("RECEIPT_DB", "data/receipt.db"))
+	if err != nil {
+		log.Fatal("打开数据库失败:", err)
+	}
+	numbering, err := service.NewNumbering(
+		getEnv("RECEIPT_NUMBER_PATTERN", service.DefaultNumberPattern),
+		getEnv("RECEIPT_NUMBER_PREFIX", service.DefaultNumberPrefix),
+		db,
+	)
+	if err != nil {
+		log.Fatal("配置收据编号失败:", err)
+	}
+	pdfService.SetNumbering(numbering)
+
+	// 配置收据在线校验，未设置密钥时使用数据库中保存的随机密钥
+	verifyKey := []byte(os.Getenv("RECEIPT_VERIFY_KEY"))
+	if len(verifyKey) == 0 {
+		if verifyKey, err = db.Secret("verify_key", 32); err != nil {
+			log.Fatal("读取校验密钥失败:", err)
+		}
+	}
+	verifier, err := service.NewVerifier(getEnv("RECEIPT_PUBLIC_URL", "http://localhost:8090"), verifyKey)
+	if err != nil {
+		log.Fatal("配置收据校验失败:", err)
+	}
+	pdfService.SetVerifier(verifier)
+
+	templates, err := pdfService.LoadTemplates(getEnv("RECEIPT_TEMPLATE_DIR", "templates"))
+	if err != nil {
+		log.Fatal("加载模板库失败:", err)
+	}
+	seals, err := pdfService.LoadSeals(getEnv("RECEIPT_SEAL_DIR", "seals"))
+	if err != nil {
+		log.Fatal("加载印章图片失败:", err)
+	}
+
+	// 配置文件存储：收据备份和异步任务文件保存在本地目录或S3兼容的对象存储中
+	backups, err := newStorage("RECEIPT_BACKUP_DIR", "backup", "backup/")
+	if err != nil {
+		log.Fatal("配置备份存储失败:", err)
+	}
+	jobFiles, err := newStorage("RECEIPT_JOB_DIR", "data/jobs", "jobs/")
+	if err != nil {
+		log.Fatal("配置任务文件存储失败:", err)
+	}
+
+	backupStore := service.NewBackupStore(backups, db)
+	receiptHandler := handler.NewReceiptHandler(pdfService, db, backupStore)
+	if mappingPath := os.Getenv("RECEIPT_IMPORT_MAPPING"); mappingPath != "" {
+		mapping, err := importer.LoadMapping(mappingPath)
+		if err != nil {
+			log.Fatal("加载导入表头映射失败:", err)
+		}
+		receiptHandler.SetImportMapping(mapping)
+	}
+
+	return &app{
+		pdf:       pdfService,
+		db:        db,
+		receipts:  receiptHandler,
+		templates: handler.NewTemplateHandler(templates),
+		seals:     handler.NewSealHandler(seals),
+		backups:   backupStore,
+		jobFiles:  jobFiles,
+	}
+}
+
+// newJanitor 按RECEIPT_RETENTION_*创建备份清理器，返回清理间隔
+func newJanitor(backups *service.BackupStore) (*service.Janitor, time.Duration, error) {
+	var policy model.RetentionPolicy
+	var err error
+	if policy.KeepYears, err = strconv.Atoi(getEnv("RECEIPT_RETENTION_YEARS", "0")); err != nil {
+		return nil, 0, fmt.Errorf("RECEIPT_RETENTION_YEARS无效: %v", err)
+	}
+	if policy.KeepLatest, err = strconv.ParseBool(getEnv("RECEIPT_RETENTION_KEEP_LATEST", "false")); err != nil {
+		return nil, 0, fmt.Errorf("RECEIPT_RETENTION_KEEP_LATEST无效: %v", err)
+	}
+	if policy.ArchiveMonths, err = strconv.Atoi(getEnv("RECEIPT_RETENTION_ARCHIVE_MONTHS", "0")); err != nil {
+		return nil, 0, fmt.Errorf("RECEIPT_RETENTION_ARCHIVE_MONTHS无效: %v", err)
+	}
+	interval, err := time.ParseDuration(getEnv("RECEIPT_RETENTION_INTERVAL", service.DefaultRetentionInterval.String()))
+	if err != nil || interval <= 0 {
+		return nil, 0, fmt.Errorf("RECEIPT_RETENTION_INTERVAL无效: %s", os.Getenv("RECEIPT_RETENTION_INTERVAL"))
+	}
+
+	janitor, err := service.NewJanitor(backups, policy)
+	if err != nil {
+		return nil, 0, err
+	}
+	return janitor, interval, nil
+}
+
+// newIdempotency 按RECEIPT_IDEMPOTENCY_WINDOW和RECEIPT_IDEMPOTENCY_BODY_WINDOW创建幂等处理，两者均为0时返回nil
+//
+// RECEIPT_IDEMPOTENCY_BODY_WINDOW默认为0：未带Idempotency-Key的请求不按内容判断重复，需要时显式开启。
+func newIdempotency(db *store.Store) (*service.Idempotency, error) {
+	window, err := time.ParseDuration(getEnv("RECEIPT_IDEMPOTENCY_WINDOW", service.DefaultIdempotencyWindow.String()))
+	if err != nil || window < 0 {
+		return nil, fmt.Errorf("RECEIPT_IDEMPOTENCY_WINDOW无效: %s", os.Getenv("RECEIPT_IDEMPOTENCY_WINDOW"))
+	}
+	bodyWindow, err := time.ParseDuration(getEnv("RECEIPT_IDEMPOTENCY_BODY_WINDOW", service.DefaultIdempotencyBodyWindow.String()))
+	if err != nil || bodyWindow < 0 {
+		return nil, fmt.Errorf("RECEIPT_IDEMPOTENCY_BODY_WINDOW无效: %s", os.Getenv("RECEIPT_IDEMPOTENCY_BODY_WINDOW"))
+	}
+	if window == 0 && bodyWindow == 0 {
+		return nil, nil
+	}
+	return service.NewIdempotency(db, window, bodyWindow), nil
+}
+
+// newStorage 按RECEIPT_STORAGE创建文件存储：fs时使用dirKey指定的本地目录，
+// s3时使用RECEIPT_S3_*配置的存储桶，键加上RECEIPT_S3_PREFIX和prefix
+func newStorage(dirKey, dirFallback, prefix string) (storage.Storage, error) {
+	switch backend := getEnv("RECEIPT_STORAGE", storage.BackendFS); backend {
+	case storage.BackendFS:
+		return storage.NewFileSystem(getEnv(dirKey, dirFallback)), nil
+	case storage.BackendS3:
+		pathStyle, err := strconv.ParseBool(getEnv("RECEIPT_S3_PATH_STYLE", "false"))
+		if err != nil {
+			return nil, fmt.Errorf("RECEIPT_S3_PATH_STYLE无效: %v", err)
+		}
+		s3, err := storage.NewS3(storage.S3Config{
+			Endpoint:  os.Getenv("RECEIPT_S3_ENDPOINT"),
+			Region:    os.Getenv("RECEIPT_S3_REGION"),
+			Bucket:    os.Getenv("RECEIPT_S3_BUCKET"),
+			AccessKey: os.Getenv("RECEIPT_S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("RECEIPT_S3_SECRET_KEY"),
+			Prefix:    os.Getenv("RECEIPT_S3_PREFIX") + prefix,
+			PathStyle: pathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return s3, nil
+	default:
+		return nil, fmt.Errorf("不支持的存储类型: %s", backend)
+	}
+}
+
+// getEnv 读取环境变量，未设置时返回默认值
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
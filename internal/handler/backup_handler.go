@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"net/http"
+	"receipt/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetBackupScrub 获取最近一次备份校验的结果
+// @Summary 备份校验结果
+// @Description 返回最近一次定期校验或手动校验的结果，尚未校验时返回404
+// @Tags 收据
+// @Produce json
+// @Success 200 {object} map[string]interface{} "校验结果"
+// @Failure 404 {object} model.ReceiptResponse "尚未校验"
+// @Router /api/receipt/backup/scrub [get]
+func (h *ReceiptHandler) GetBackupScrub(c *gin.Context) {
+	report := h.backups.LastScrub()
+	if report == nil {
+		c.JSON(http.StatusNotFound, model.ReceiptResponse{
+			Success: false,
+			Message: "尚未校验备份",
+		})
+		return
+	}
+	respondScrub(c, report)
+}
+
+// ScrubBackups 立即校验全部备份
+// @Summary 校验备份
+// @Description 重新计算每个备份文件内容的SHA-256摘要并与清单比对，报告丢失、损坏的文件以及清单中没有引用的文件
+// @Tags 收据
+// @Produce json
+// @Success 200 {object} map[string]interface{} "校验结果"
+// @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
+// @Router /api/receipt/backup/scrub [post]
+func (h *ReceiptHandler) ScrubBackups(c *gin.Context) {
+	report, err := h.backups.Scrub()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: "校验备份失败: " + err.Error(),
+		})
+		return
+	}
+	respondScrub(c, report)
+}
+
+func respondScrub(c *gin.Context, report *model.ScrubReport) {
+	message := "备份校验通过"
+	if !report.Healthy() {
+		message = "发现丢失或损坏的备份文件"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    report,
+	})
+}
@@ -0,0 +1,373 @@
+package handler
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// batchResultFile ZIP中记录每张收据生成结果的文件
+const batchResultFile = "result.json"
+
+// batchItem 通过校验、等待生成的收据
+type batchItem struct {
+	result  *model.BatchItemResult
+	request *model.ReceiptRequest
+	data    *model.ReceiptData
+}
+
+// GenerateReceiptBatch 批量生成收据
+// @Summary 批量生成收据
+// @Description 一次生成多张收据，返回ZIP（每张收据一个文件，附result.json记录每项结果）或合并的多页PDF
+// @Description （成功和失败数量及失败项的序号在响应头X-Batch-Succeeded、X-Batch-Failed、X-Batch-Failed-Items中），合并PDF可按imposition拼版到A4/A5纸上。
+// @Description 单张收据校验或生成失败只记入该项结果，不影响其他收据。async为true时提交为异步任务，返回202和任务编号
+// @Tags 收据
+// @Accept json
+// @Produce application/zip,application/pdf
+// @Param request body model.BatchReceiptRequest true "批量收据信息"
+// @Success 200 {file} binary "ZIP文件，或每项结果和合并PDF"
+// @Success 202 {object} map[string]interface{} "已提交异步任务"
+// @Failure 400 {object} map[string]interface{} "请求参数错误或全部收据校验失败"
+// @Failure 500 {object} map[string]interface{} "全部收据生成失败"
+// @Router /api/receipt/batch [post]
+func (h *ReceiptHandler) GenerateReceiptBatch(c *gin.Context) {
+	var req model.BatchReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	output, format, err := batchOptions(req.Output, req.Format, req.Imposition)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	// 先逐项校验，全部无效时不分配编号也不生成文件
+	results := make([]*model.BatchItemResult, len(req.Receipts))
+	var items []batchItem
+	for i, raw := range req.Receipts {
+		results[i] = &model.BatchItemResult{Index: i}
+		item, err := parseBatchReceipt(raw, results[i])
+		if err != nil {
+			results[i].Message = "请求参数错误: " + err.Error()
+			continue
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		respondBatchFailure(c, http.StatusBadRequest, "全部收据校验失败", results)
+		return
+	}
+	if req.Async {
+		h.submitJob(c, model.JobKindBatch, output, format, req.Imposition, results, items)
+		return
+	}
+
+	h.respondBatch(c, items, results, output, format, req.Imposition)
+}
+
+// batchOptions 检查输出方式、文件格式和拼版参数的组合，未指定时使用默认的ZIP和PDF
+func batchOptions(output, format string, imposition *model.ImpositionRequest) (string, string, error) {
+	if output == "" {
+		output = model.BatchOutputZip
+	}
+	if format == "" {
+		format = service.FormatPDF
+	}
+	if output == model.BatchOutputPDF && format != service.FormatPDF {
+		return "", "", errors.New("合并PDF时format只能为pdf")
+	}
+	if imposition != nil && imposition.Sheet != "" && output != model.BatchOutputPDF {
+		return "", "", errors.New("拼版只支持合并PDF输出")
+	}
+	return output, format, nil
+}
+
+// parseBatchReceipt 解析并校验批量请求中的单张收据，能解析出房间号时记入该项结果
+func parseBatchReceipt(raw json.RawMessage, result *model.BatchItemResult) (batchItem, error) {
+	var req model.ReceiptRequest
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return batchItem{}, err
+	}
+	result.RoomNumber = req.RoomNumber
+	data, err := validateReceipt(&req)
+	if err != nil {
+		return batchItem{}, err
+	}
+	return batchItem{result: result, request: &req, data: data}, nil
+}
+
+// validateReceipt 按请求绑定的规则校验收据信息并转换为收据数据
+func validateReceipt(req *model.ReceiptRequest) (*model.ReceiptData, error) {
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		return nil, err
+	}
+	return service.ConvertReceiptToData(req)
+}
+
+// renderBatchItem 为单张收据分配编号并生成文件，失败原因写入该项结果；生成的收据由调用方登记
+func (h *ReceiptHandler) renderBatchItem(item batchItem, format string) ([]byte, bool) {
+	if err := h.pdfService.AssignNumber(item.data); err != nil {
+		item.result.Message = "分配收据编号失败: " + err.Error()
+		return nil, false
+	}
+	item.result.ReceiptID = item.data.ID
+
+	var buf bytes.Buffer
+	if err := h.pdfService.RenderReceipt(&buf, item.data, format); err != nil {
+		item.result.Message = "生成收据失败: " + err.Error()
+		return nil, false
+	}
+
+	item.result.Success = true
+	return buf.Bytes(), true
+}
+
+// respondBatch 按输出方式生成全部收据并返回
+func (h *ReceiptHandler) respondBatch(c *gin.Context, items []batchItem, results []*model.BatchItemResult, output, format string, imposition *model.ImpositionRequest) {
+	if output == model.BatchOutputPDF {
+		h.writeBatchPDF(c, items, results, imposition)
+		return
+	}
+	h.writeBatchZip(c, items, results, format)
+}
+
+// writeBatchZip 逐张生成收据并以ZIP流式返回，最后写入每项结果
+func (h *ReceiptHandler) writeBatchZip(c *gin.Context, items []batchItem, results []*model.BatchItemResult, format string) {
+	startBatchZip(c)
+	if err := h.buildBatchZip(c.Writer, items, results, format); err != nil {
+		fmt.Printf("警告：写入批量收据失败: %v\n", err)
+	}
+}
+
+// startBatchZip 设置ZIP下载的响应头，之后以流的方式写入ZIP
+func startBatchZip(c *gin.Context) {
+	fileName := fmt.Sprintf("receipts_%s.zip", time.Now().Format("20060102_150405"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Status(http.StatusOK)
+}
+
+// buildBatchZip 逐张生成收据写入ZIP，最后写入每项结果；w支持http.Flusher时每张收据写完即发送
+func (h *ReceiptHandler) buildBatchZip(w io.Writer, items []batchItem, results []*model.BatchItemResult, format string) error {
+	zw := zip.NewWriter(w)
+	for _, item := range items {
+		content, ok := h.renderBatchItem(item, format)
+		if !ok {
+			continue
+		}
+		if err := h.recordReceipt(item.data, format, "", content); err != nil {
+			item.result.Success = false
+			item.result.Message = err.Error()
+			continue
+		}
+		item.result.FileName = fmt.Sprintf("receipt_%s.%s", item.data.ID, format)
+		if err := writeZipFile(zw, w, item.result.FileName, content); err != nil {
+			return err
+		}
+	}
+	return closeBatchZip(zw, results)
+}
+
+// writeZipFile 向ZIP中写入一个文件，w支持http.Flusher时立即发送
+func writeZipFile(zw *zip.Writer, w io.Writer, name string, content []byte) error {
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(content); err != nil {
+		return err
+	}
+	if f, ok := w.(http.Flusher); ok {
+		if err := zw.Flush(); err != nil {
+			return err
+		}
+		f.Flush()
+	}
+	return nil
+}
+
+// closeBatchZip 写入每项结果并结束ZIP
+func closeBatchZip(zw *zip.Writer, results []*model.BatchItemResult) error {
+	summary, _ := json.MarshalIndent(batchSummary(results), "", "  ")
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: batchResultFile, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(summary); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeBatchPDF 生成全部收据后合并为一个PDF返回，指定拼版参数时按拼版排列到纸张上
+func (h *ReceiptHandler) writeBatchPDF(c *gin.Context, items []batchItem, results []*model.BatchItemResult, imposition *model.ImpositionRequest) {
+	output, err := h.buildBatchPDF(items, results, imposition)
+	if err != nil {
+		respondBatchFailure(c, renderErrorStatus(err), err.Error(), results)
+		return
+	}
+	sendBatchPDF(c, output, results)
+}
+
+// sendBatchPDF 返回合并的PDF，成功和失败数量以及失败项的序号放在响应头中
+//
+// 每项结果的错误信息和起始页码可能很多，不放在响应头中；需要时使用ZIP输出或异步任务查询。
+func sendBatchPDF(c *gin.Context, output []byte, results []*model.BatchItemResult) {
+	var failed []string
+	for _, r := range results {
+		if !r.Success {
+			failed = append(failed, strconv.Itoa(r.Index))
+		}
+	}
+
+	fileName := fmt.Sprintf("receipts_%s.pdf", time.Now().Format("20060102_150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	c.Header("X-Batch-Succeeded", strconv.Itoa(len(results)-len(failed)))
+	c.Header("X-Batch-Failed", strconv.Itoa(len(failed)))
+	if len(failed) > 0 {
+		c.Header("X-Batch-Failed-Items", strings.Join(failed, ","))
+	}
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Data(http.StatusOK, "application/pdf", output)
+}
+
+// buildBatchPDF 生成全部收据并合并或拼版为一个PDF，记录每张收据的起始页码
+//
+// 合并成功后才登记收据：合并或拼版失败时不返回任何收据，也不应留下登记记录。
+// 登记失败的收据记为失败，去掉后重新合并，返回的PDF只包含已登记的收据。
+func (h *ReceiptHandler) buildBatchPDF(items []batchItem, results []*model.BatchItemResult, imposition *model.ImpositionRequest) ([]byte, error) {
+	var rendered []batchItem
+	var contents [][]byte
+	for _, item := range items {
+		content, ok := h.renderBatchItem(item, service.FormatPDF)
+		if !ok {
+			continue
+		}
+		rendered = append(rendered, item)
+		contents = append(contents, content)
+	}
+	if len(contents) == 0 {
+		return nil, errors.New("全部收据生成失败")
+	}
+
+	output, pages, err := combinePDF(contents, imposition)
+	if err != nil {
+		for _, item := range rendered {
+			item.result.Success = false
+			item.result.Message = "合并PDF失败: " + err.Error()
+		}
+		return nil, err
+	}
+
+	var recorded []batchItem
+	var recordedContents [][]byte
+	for i, item := range rendered {
+		if err := h.recordReceipt(item.data, service.FormatPDF, "", contents[i]); err != nil {
+			item.result.Success = false
+			item.result.Message = err.Error()
+			continue
+		}
+		item.result.Page = pages[i]
+		recorded = append(recorded, item)
+		recordedContents = append(recordedContents, contents[i])
+	}
+	if len(recorded) == len(rendered) {
+		return output, nil
+	}
+	if len(recorded) == 0 {
+		return nil, errors.New("全部收据登记失败")
+	}
+
+	if output, pages, err = combinePDF(recordedContents, imposition); err != nil {
+		for _, item := range recorded {
+			item.result.Success = false
+			item.result.Message = "合并PDF失败: " + err.Error()
+		}
+		return nil, err
+	}
+	for i, item := range recorded {
+		item.result.Page = pages[i]
+	}
+	return output, nil
+}
+
+// combinePDF 合并PDF，指定拼版参数时拼版，返回结果和每个PDF的起始页码
+func combinePDF(contents [][]byte, imposition *model.ImpositionRequest) ([]byte, []int, error) {
+	if imposition != nil && imposition.Sheet != "" {
+		return service.ImposePDF(contents, impositionOptions(imposition))
+	}
+	return mergePDF(contents)
+}
+
+// mergePDF 依次合并PDF，返回合并结果和每个PDF在其中的起始页码
+func mergePDF(pdfs [][]byte) ([]byte, []int, error) {
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	files := make([]io.ReadSeeker, len(pdfs))
+	pages := make([]int, len(pdfs))
+	page := 1
+	for i, content := range pdfs {
+		n, err := api.PageCount(bytes.NewReader(content), conf)
+		if err != nil {
+			return nil, nil, fmt.Errorf("读取收据页数失败: %v", err)
+		}
+		pages[i] = page
+		page += n
+		files[i] = bytes.NewReader(content)
+	}
+
+	var merged bytes.Buffer
+	if err := api.MergeRaw(files, &merged, false, conf); err != nil {
+		return nil, nil, fmt.Errorf("合并PDF失败: %v", err)
+	}
+	return merged.Bytes(), pages, nil
+}
+
+// batchSummary 汇总批量生成的结果
+func batchSummary(results []*model.BatchItemResult) gin.H {
+	succeeded := 0
+	for _, r := range results {
+		if r.Success {
+			succeeded++
+		}
+	}
+	return gin.H{
+		"total":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+		"results":   results,
+	}
+}
+
+// respondBatchFailure 没有可返回的收据时以JSON返回每项结果
+func respondBatchFailure(c *gin.Context, status int, message string, results []*model.BatchItemResult) {
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": message,
+		"data":    batchSummary(results),
+	})
+}
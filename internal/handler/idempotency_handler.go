@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// idempotentReceiptKey 重复请求时保存首次生成的收据记录的上下文键
+const idempotentReceiptKey = "idempotentReceipt"
+
+// SetIdempotency 设置生成接口的幂等处理，未设置时每次请求都生成新收据
+func (h *ReceiptHandler) SetIdempotency(idempotency *service.Idempotency) {
+	h.idempotency = idempotency
+}
+
+// Idempotent 生成接口的幂等中间件
+//
+// 小程序在网络不稳定时会重试请求，窗口期内的重复请求返回首次生成的收据（响应头
+// Idempotent-Replayed: true），不再分配编号、备份和登记。带 Idempotency-Key 时按键判断，
+// 同一键用于内容不同的请求返回422；未带时按请求内容判断。首次请求尚未完成时返回409，
+// 首次请求失败时不保存结果，重复请求重新生成。
+//
+// 幂等记录只保存收据编号（X-Receipt-Number），重复请求时返回首次生成时备份的文件，
+// 没有可用的备份时才按登记的收据数据重新生成；收据已作废时返回410，不会绕过作废检查返回首次的文件。
+func (h *ReceiptHandler) Idempotent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if h.idempotency == nil {
+			c.Next()
+			return
+		}
+
+		key := strings.TrimSpace(c.GetHeader("Idempotency-Key"))
+		if len(key) > service.MaxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.ReceiptResponse{
+				Success: false,
+				Message: fmt.Sprintf("Idempotency-Key不能超过%d个字符", service.MaxIdempotencyKeyLength),
+			})
+			return
+		}
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, model.ReceiptResponse{
+				Success: false,
+				Message: "读取请求失败: " + err.Error(),
+			})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestHash := service.RequestHash(c.Request.Method, c.Request.URL.Path, c.Request.URL.RawQuery, body)
+		record, err := h.idempotency.Begin(key, requestHash)
+		switch {
+		case errors.Is(err, service.ErrIdempotencyMismatch):
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, model.ReceiptResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		case errors.Is(err, service.ErrIdempotencyInProgress):
+			c.Header("Retry-After", "1")
+			c.AbortWithStatusJSON(http.StatusConflict, model.ReceiptResponse{
+				Success: false,
+				Message: err.Error() + "，请稍后重试",
+			})
+			return
+		case err != nil:
+			// 幂等记录读写失败不影响生成收据
+			fmt.Printf("警告：%v\n", err)
+			c.Next()
+			return
+		case record == nil:
+			c.Next()
+			return
+		case record.Completed():
+			h.replayReceipt(c, record)
+			return
+		}
+
+		c.Next()
+
+		status := c.Writer.Status()
+		receiptID := c.Writer.Header().Get("X-Receipt-Number")
+		if status < http.StatusOK || status >= http.StatusMultipleChoices || receiptID == "" {
+			if err := h.idempotency.Release(record); err != nil {
+				fmt.Printf("警告：%v\n", err)
+			}
+			return
+		}
+		if err := h.idempotency.Complete(record, receiptID); err != nil {
+			fmt.Printf("警告：%v\n", err)
+		}
+	}
+}
+
+// replayReceipt 按幂等记录中的收据编号返回首次请求的收据，收据已作废时返回410
+func (h *ReceiptHandler) replayReceipt(c *gin.Context, record *model.IdempotencyRecord) {
+	receipt, err := h.receipts.GetReceipt(record.ReceiptID)
+	if err != nil {
+		respondReceiptError(c, err)
+		c.Abort()
+		return
+	}
+	if receipt.Voided() {
+		c.AbortWithStatusJSON(http.StatusGone, model.ReceiptResponse{
+			Success: false,
+			Message: voidedMessage(receipt),
+		})
+		return
+	}
+
+	c.Set(idempotentReceiptKey, receipt)
+	c.Header("Idempotent-Replayed", "true")
+	c.Next()
+}
+
+// replayedReceipt 返回重复请求对应的首次生成的收据，不是重复请求时返回nil
+func replayedReceipt(c *gin.Context) *model.ReceiptRecord {
+	if value, ok := c.Get(idempotentReceiptKey); ok {
+		return value.(*model.ReceiptRecord)
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"receipt/internal/importer"
+	"receipt/internal/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportSize 导入表格文件的大小上限
+const maxImportSize = 10 << 20
+
+// errImportAllInvalid 表格中没有通过校验的行
+var errImportAllInvalid = errors.New("全部行校验失败")
+
+// ImportReceipts 导入表格批量生成收据
+// @Summary 导入表格批量生成收据
+// @Description 以multipart表单上传CSV或XLSX表格，每行一张收据，表头按映射对应到收据字段（支持房间号、租金、付款人等中文表头）。
+// @Description 逐行校验，单行错误只记入该行结果（含表格行号），其余行一次生成，返回方式与批量生成相同；dry_run时只返回校验结果
+// @Tags 收据
+// @Accept multipart/form-data
+// @Produce application/zip,application/pdf,json
+// @Param file formData file true "CSV或XLSX表格"
+// @Param output formData string false "输出方式：zip（默认）或 pdf"
+// @Param format formData string false "ZIP中的文件格式：pdf（默认）、png、jpeg"
+// @Param worksheet formData string false "XLSX工作表名称，默认第一个工作表"
+// @Param mapping formData string false "表头映射JSON，如 {\"户号\":\"room_number\"}"
+// @Param dry_run formData bool false "只校验表格，不生成收据"
+// @Param async formData bool false "提交为异步任务，返回202和任务编号"
+// @Param sheet formData string false "拼版纸张：A4、A5，只用于合并PDF"
+// @Param up formData int false "每张纸的收据数"
+// @Param gutter formData number false "收据之间的间距（mm），默认5"
+// @Param crop_marks formData bool false "绘制裁切线"
+// @Success 200 {file} binary "ZIP或PDF文件，dry_run时为每行的校验结果"
+// @Success 202 {object} map[string]interface{} "已提交异步任务"
+// @Failure 400 {object} map[string]interface{} "请求参数错误、表格无法读取或全部行校验失败"
+// @Failure 500 {object} map[string]interface{} "全部收据生成失败"
+// @Router /api/receipt/import [post]
+func (h *ReceiptHandler) ImportReceipts(c *gin.Context) {
+	var req model.ImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	output, format, err := batchOptions(req.Output, req.Format, &req.ImpositionRequest)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: 需要file字段",
+		})
+		return
+	}
+	if fileHeader.Size > maxImportSize {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "表格文件过大",
+		})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "读取上传文件失败: " + err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	rows, err := h.readImportRows(file, fileHeader.Filename, &req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	results, items := importItems(rows)
+	if len(items) == 0 {
+		respondBatchFailure(c, http.StatusBadRequest, errImportAllInvalid.Error(), results)
+		return
+	}
+	if req.DryRun {
+		markDryRun(items)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": "表格校验完成",
+			"data":    batchSummary(results),
+		})
+		return
+	}
+
+	if req.Async {
+		h.submitJob(c, model.JobKindImport, output, format, &req.ImpositionRequest, results, items)
+		return
+	}
+
+	h.respondBatch(c, items, results, output, format, &req.ImpositionRequest)
+}
+
+// Import 导入表格生成收据并按req的输出方式写入w，返回每行的结果，供命令行导入使用
+//
+// 命令行导入总是同步执行，忽略async；dry_run时只校验不写入。参数错误、表格无法读取、全部行校验失败或全部收据生成失败时返回错误。
+func (h *ReceiptHandler) Import(w io.Writer, file io.Reader, fileName string, req *model.ImportRequest) ([]*model.BatchItemResult, error) {
+	output, format, err := batchOptions(req.Output, req.Format, &req.ImpositionRequest)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := h.readImportRows(file, fileName, req)
+	if err != nil {
+		return nil, err
+	}
+
+	results, items := importItems(rows)
+	if len(items) == 0 {
+		return results, errImportAllInvalid
+	}
+	if req.DryRun {
+		markDryRun(items)
+		return results, nil
+	}
+
+	if output == model.BatchOutputPDF {
+		content, err := h.buildBatchPDF(items, results, &req.ImpositionRequest)
+		if err != nil {
+			return results, err
+		}
+		_, err = w.Write(content)
+		return results, err
+	}
+	return results, h.buildBatchZip(w, items, results, format)
+}
+
+// readImportRows 按文件扩展名读取表格，表头映射为配置的映射叠加请求中的映射
+func (h *ReceiptHandler) readImportRows(file io.Reader, fileName string, req *model.ImportRequest) ([]importer.Row, error) {
+	format, err := importer.FormatFromName(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := h.importMapping
+	if req.Mapping != "" {
+		extra, err := importer.ParseMapping([]byte(req.Mapping))
+		if err != nil {
+			return nil, err
+		}
+		if mapping, err = mapping.Merge(extra); err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := importer.Parse(file, format, req.Worksheet, mapping)
+	if err != nil {
+		return nil, fmt.Errorf("读取表格失败: %v", err)
+	}
+	return rows, nil
+}
+
+// importItems 逐行校验表格数据，返回每行的结果和通过校验的收据
+func importItems(rows []importer.Row) ([]*model.BatchItemResult, []batchItem) {
+	results := make([]*model.BatchItemResult, len(rows))
+	var items []batchItem
+	for i, row := range rows {
+		results[i] = &model.BatchItemResult{Index: i, Row: row.Line, RoomNumber: row.Request.RoomNumber}
+		err := row.Err
+		var data *model.ReceiptData
+		if err == nil {
+			data, err = validateReceipt(row.Request)
+		}
+		if err != nil {
+			results[i].Message = "请求参数错误: " + err.Error()
+			continue
+		}
+		items = append(items, batchItem{result: results[i], request: row.Request, data: data})
+	}
+	return results, items
+}
+
+// markDryRun 只校验表格时将通过校验的行标记为成功
+func markDryRun(items []batchItem) {
+	for _, item := range items {
+		item.result.Success = true
+		item.result.Message = "校验通过"
+	}
+}
@@ -0,0 +1,296 @@
+package handler
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"receipt/internal/store"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetJobQueue 设置异步任务队列，未设置时批量生成和导入只能同步执行
+func (h *ReceiptHandler) SetJobQueue(jobs *service.JobQueue) {
+	h.jobs = jobs
+}
+
+// submitJob 将批量生成或导入提交为异步任务，返回202和任务信息
+//
+// 通过校验的收据在提交时确定日期和月份，稍后执行或重试时不随当天日期变化；校验失败的项直接记为失败。
+func (h *ReceiptHandler) submitJob(c *gin.Context, kind, output, format string, imposition *model.ImpositionRequest,
+	results []*model.BatchItemResult, items []batchItem) {
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, model.ReceiptResponse{
+			Success: false,
+			Message: "未启用异步任务",
+		})
+		return
+	}
+
+	job := &model.Job{Kind: kind, Output: output, Format: format}
+	if imposition != nil && imposition.Sheet != "" {
+		job.Imposition = imposition
+	}
+	job.Items = make([]*model.JobItem, len(results))
+	for i, result := range results {
+		job.Items[i] = &model.JobItem{BatchItemResult: *result, Status: model.JobItemFailed}
+	}
+	for _, item := range items {
+		req := *item.request
+		req.Date, req.Month = item.data.Date, item.data.Month
+		jobItem := job.Items[item.result.Index]
+		jobItem.Status, jobItem.Request = model.JobItemPending, &req
+	}
+
+	if err := h.jobs.Submit(job); err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.Header("Location", "/api/jobs/"+job.ID)
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "任务已提交",
+		"data":    job.Summary(),
+	})
+}
+
+// ListJobs 查询异步任务
+// @Summary 查询任务
+// @Description 按提交时间倒序列出异步任务及进度，不含每一项的结果
+// @Tags 任务
+// @Produce json
+// @Param status query string false "任务状态：queued、running、completed、failed、canceled"
+// @Param page query int false "页码，从1开始"
+// @Param page_size query int false "每页条数，最大100"
+// @Success 200 {object} map[string]interface{} "查询成功"
+// @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Router /api/jobs [get]
+func (h *ReceiptHandler) ListJobs(c *gin.Context) {
+	var q model.JobQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	jobs, total, err := h.receipts.ListJobs(&q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	page, pageSize := q.Page, q.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = store.DefaultPageSize
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "查询任务成功",
+		"data": gin.H{
+			"jobs":      jobs,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetJob 获取异步任务的进度和每一项的结果
+// @Summary 获取任务
+// @Tags 任务
+// @Produce json
+// @Param id path string true "任务编号"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 404 {object} model.ReceiptResponse "任务不存在"
+// @Router /api/jobs/{id} [get]
+func (h *ReceiptHandler) GetJob(c *gin.Context) {
+	job, err := h.receipts.GetJob(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "获取任务成功",
+		"data":    job,
+	})
+}
+
+// CancelJob 取消异步任务
+// @Summary 取消任务
+// @Description 排队中的任务立即取消；执行中的任务在当前一张收据完成后停止，已生成的收据保留
+// @Tags 任务
+// @Produce json
+// @Param id path string true "任务编号"
+// @Success 200 {object} map[string]interface{} "已取消或已请求取消"
+// @Failure 404 {object} model.ReceiptResponse "任务不存在"
+// @Failure 409 {object} model.ReceiptResponse "任务已结束"
+// @Router /api/jobs/{id}/cancel [post]
+func (h *ReceiptHandler) CancelJob(c *gin.Context) {
+	job, err := h.receipts.CancelJob(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	message := "任务已取消"
+	if job.CancelRequested {
+		message = "已请求取消，当前收据生成后停止"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    job.Summary(),
+	})
+}
+
+// RetryJob 重试异步任务中失败的项
+// @Summary 重试任务
+// @Description 将已结束任务中生成失败和被取消的项重新加入队列，已分配编号的项沿用原编号；校验失败的项不重试
+// @Tags 任务
+// @Produce json
+// @Param id path string true "任务编号"
+// @Success 202 {object} map[string]interface{} "已重新加入队列"
+// @Failure 404 {object} model.ReceiptResponse "任务不存在"
+// @Failure 409 {object} model.ReceiptResponse "任务尚未结束或没有可重试的项"
+// @Router /api/jobs/{id}/retry [post]
+func (h *ReceiptHandler) RetryJob(c *gin.Context) {
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, model.ReceiptResponse{
+			Success: false,
+			Message: "未启用异步任务",
+		})
+		return
+	}
+
+	job, err := h.jobs.Retry(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "任务已重新加入队列",
+		"data":    job.Summary(),
+	})
+}
+
+// DownloadJobResult 下载异步任务生成的收据
+// @Summary 下载任务结果
+// @Description 任务结束后按提交时的输出方式返回成功生成的收据：ZIP（附result.json）或合并PDF（响应头同批量生成），每项结果见任务详情
+// @Tags 任务
+// @Produce application/zip,application/pdf
+// @Param id path string true "任务编号"
+// @Success 200 {file} binary "ZIP或PDF文件"
+// @Failure 404 {object} model.ReceiptResponse "任务不存在"
+// @Failure 409 {object} model.ReceiptResponse "任务尚未结束或没有成功生成的收据"
+// @Router /api/jobs/{id}/result [get]
+func (h *ReceiptHandler) DownloadJobResult(c *gin.Context) {
+	if h.jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, model.ReceiptResponse{
+			Success: false,
+			Message: "未启用异步任务",
+		})
+		return
+	}
+
+	job, err := h.receipts.GetJob(c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+	if !job.Finished() {
+		respondJobError(c, fmt.Errorf("%w: %s", store.ErrJobNotFinished, job.Status))
+		return
+	}
+	if job.Succeeded == 0 {
+		c.JSON(http.StatusConflict, model.ReceiptResponse{
+			Success: false,
+			Message: "任务没有成功生成的收据",
+		})
+		return
+	}
+
+	// 读取全部文件后再开始响应，文件缺失时仍可返回错误
+	results := make([]*model.BatchItemResult, len(job.Items))
+	var succeeded []*model.JobItem
+	var contents [][]byte
+	for i, item := range job.Items {
+		results[i] = &item.BatchItemResult
+		if item.Status != model.JobItemSucceeded {
+			continue
+		}
+		content, err := h.jobs.ReadItemFile(job, item)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		succeeded = append(succeeded, item)
+		contents = append(contents, content)
+	}
+
+	if job.Output == model.BatchOutputPDF {
+		output, pages, err := combinePDF(contents, job.Imposition)
+		if err != nil {
+			c.JSON(renderErrorStatus(err), model.ReceiptResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		for i, item := range succeeded {
+			item.Page = pages[i]
+		}
+		sendBatchPDF(c, output, results)
+		return
+	}
+
+	startBatchZip(c)
+	zw := zip.NewWriter(c.Writer)
+	for i, item := range succeeded {
+		if err := writeZipFile(zw, c.Writer, item.FileName, contents[i]); err != nil {
+			fmt.Printf("警告：写入任务结果失败: %v\n", err)
+			return
+		}
+	}
+	if err := closeBatchZip(zw, results); err != nil {
+		fmt.Printf("警告：写入任务结果失败: %v\n", err)
+	}
+}
+
+// respondJobError 按任务错误类型返回对应的HTTP状态码
+func respondJobError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, store.ErrJobNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, store.ErrJobFinished), errors.Is(err, store.ErrJobNotFinished),
+		errors.Is(err, store.ErrJobNothingToRetry):
+		status = http.StatusConflict
+	}
+	c.JSON(status, model.ReceiptResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
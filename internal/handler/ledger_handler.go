@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportLedger 导出收据开具记录
+// @Summary 导出开具记录
+// @Description 按序号顺序导出全部开具记录，每行一条JSON（JSON Lines），可用 verify-ledger -file 离线校验
+// @Tags 收据
+// @Produce application/x-ndjson
+// @Success 200 {file} file "开具记录"
+// @Router /api/ledger/export [get]
+func (h *ReceiptHandler) ExportLedger(c *gin.Context) {
+	fileName := fmt.Sprintf("ledger_%s.jsonl", time.Now().Format("20060102_150405"))
+	c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", fileName))
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	err := h.receipts.LedgerEntries(func(entry *model.LedgerEntry) error {
+		return encoder.Encode(entry)
+	})
+	if err != nil {
+		// 已开始输出，无法再返回错误响应，截断的导出文件校验时会报告缺失的记录
+		fmt.Printf("警告：导出开具记录失败: %v\n", err)
+	}
+}
+
+// VerifyLedger 校验收据开具记录
+// @Summary 校验开具记录
+// @Description 校验开具记录的哈希链，发现删除、插入、修改或调换顺序的记录，并与收据登记记录逐张比对
+// @Tags 收据
+// @Produce json
+// @Success 200 {object} map[string]interface{} "校验结果"
+// @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
+// @Router /api/ledger/verify [get]
+func (h *ReceiptHandler) VerifyLedger(c *gin.Context) {
+	entries, records, err := h.receipts.LedgerSnapshot()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	report := service.VerifyLedger(entries, records)
+	message := "开具记录校验通过"
+	if !report.Valid {
+		message = "开具记录校验未通过"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    report,
+	})
+}
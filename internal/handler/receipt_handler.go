@@ -1,43 +1,68 @@
 package handler
 
 import (
+	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"path"
+	"receipt/internal/importer"
 	"receipt/internal/model"
 	"receipt/internal/service"
-	"strconv"
+	"receipt/internal/store"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type ReceiptHandler struct {
-	pdfService *service.PDFService
+	pdfService    *service.PDFService
+	receipts      *store.Store
+	importMapping importer.Mapping     // 导入表格的表头映射
+	jobs          *service.JobQueue    // 异步任务队列
+	backups       *service.BackupStore // 收据备份
+	janitor       *service.Janitor     // 备份保留策略
+	idempotency   *service.Idempotency // 生成接口的幂等处理
 }
 
-func NewReceiptHandler(pdfService *service.PDFService) *ReceiptHandler {
+// NewReceiptHandler 创建收据接口，backups为main按RECEIPT_STORAGE配置的收据备份
+func NewReceiptHandler(pdfService *service.PDFService, receipts *store.Store, backups *service.BackupStore) *ReceiptHandler {
 	return &ReceiptHandler{
-		pdfService: pdfService,
+		pdfService:    pdfService,
+		receipts:      receipts,
+		importMapping: importer.DefaultMapping(),
+		backups:       backups,
 	}
 }
 
+// SetImportMapping 设置导入表格的表头映射，请求中的映射叠加在其上
+func (h *ReceiptHandler) SetImportMapping(mapping importer.Mapping) {
+	h.importMapping = mapping
+}
+
 // GenerateReceipt 生成收据PDF
 // @Summary 生成收据PDF
-// @Description 接收小程序发送的租金、房间号、收款人等信息，生成收据PDF并返回
+// @Description 接收小程序发送的租金、房间号、收款人等信息，生成收据PDF并返回；指定sheet时返回拼版到A4/A5纸上的PDF
 // @Tags 收据
 // @Accept json
 // @Produce application/pdf
 // @Param request body model.ReceiptRequest true "收据信息"
+// @Param Idempotency-Key header string false "幂等键，重复请求返回首次生成的收据"
+// @Param sheet query string false "拼版纸张：A4、A5，为空时不拼版"
+// @Param up query int false "每张纸的收据数，默认按纸张尺寸尽量多放"
+// @Param gutter query number false "收据之间的间距（mm），默认5"
+// @Param crop_marks query bool false "绘制裁切线"
 // @Success 200 {file} binary "PDF文件"
 // @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 409 {object} model.ReceiptResponse "相同的请求正在处理中"
+// @Failure 410 {object} model.ReceiptResponse "重复请求对应的收据已作废"
+// @Failure 422 {object} model.ReceiptResponse "Idempotency-Key已用于内容不同的请求"
 // @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
 // @Router /api/receipt/generate [post]
 func (h *ReceiptHandler) GenerateReceipt(c *gin.Context) {
-	var req model.ReceiptRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
+	var imposition model.ImpositionRequest
+	if err := c.ShouldBindQuery(&imposition); err != nil {
 		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
 			Success: false,
 			Message: "请求参数错误: " + err.Error(),
@@ -45,55 +70,56 @@ func (h *ReceiptHandler) GenerateReceipt(c *gin.Context) {
 		return
 	}
 
-	// 转换为PDF填充数据
-	data := service.ConvertReceiptToData(&req)
-
-	// 生成PDF
-	outputPath, err := h.pdfService.FillReceipt(data)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "生成收据PDF失败: " + err.Error(),
-		})
+	data, ok := h.bindReceipt(c)
+	if !ok {
 		return
 	}
 
-	// 检查文件是否存在
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "PDF文件生成失败",
-		})
-		return
+	// 生成PDF，重复请求返回首次生成时备份的文件
+	pdfBytes, replayed := h.replayedFile(c, service.FormatPDF)
+	if !replayed {
+		var buf bytes.Buffer
+		if err := h.pdfService.RenderReceipt(&buf, data, service.FormatPDF); err != nil {
+			c.JSON(renderErrorStatus(err), model.ReceiptResponse{
+				Success: false,
+				Message: "生成收据PDF失败: " + err.Error(),
+			})
+			return
+		}
+		pdfBytes = buf.Bytes()
 	}
 
-	// 获取文件信息
-	fileInfo, err := os.Stat(outputPath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "无法获取文件信息: " + err.Error(),
-		})
-		return
+	// 拼版只改变返回的文件，登记的仍是单张收据
+	output := pdfBytes
+	if imposition.Sheet != "" {
+		var err error
+		if output, _, err = service.ImposePDF([][]byte{pdfBytes}, impositionOptions(&imposition)); err != nil {
+			respondReceiptError(c, err)
+			return
+		}
+	}
+
+	// 登记收据，登记成功后才返回文件；重复请求的收据已经登记
+	if replayedReceipt(c) == nil {
+		if err := h.recordReceipt(data, "pdf", "", pdfBytes); err != nil {
+			c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
 	}
 
 	// 设置小程序友好的响应头
 	fileName := fmt.Sprintf("receipt_%s_%s.pdf", data.RoomNumber, time.Now().Format("20060102_150405"))
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Length", strconv.FormatInt(fileInfo.Size(), 10))
 	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	c.Header("X-Receipt-Number", data.ID)
 	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
 
 	// 返回PDF文件给小程序
-	c.File(outputPath)
-
-	// 延迟清理临时文件（可选）
-	go func() {
-		time.Sleep(5 * time.Minute) // 5分钟后清理
-		os.Remove(outputPath)
-	}()
+	c.Data(http.StatusOK, "application/pdf", output)
 }
 
 // GenerateReceiptForMiniProgram 为小程序生成收据PDF（返回Base64）
@@ -103,82 +129,40 @@ func (h *ReceiptHandler) GenerateReceipt(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body model.ReceiptRequest true "收据信息"
+// @Param Idempotency-Key header string false "幂等键，重复请求返回首次生成的收据"
 // @Success 200 {object} map[string]interface{} "生成成功"
 // @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 409 {object} model.ReceiptResponse "相同的请求正在处理中"
+// @Failure 410 {object} model.ReceiptResponse "重复请求对应的收据已作废"
+// @Failure 422 {object} model.ReceiptResponse "Idempotency-Key已用于内容不同的请求"
 // @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
 // @Router /api/receipt/miniprogram [post]
 func (h *ReceiptHandler) GenerateReceiptForMiniProgram(c *gin.Context) {
-	var req model.ReceiptRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
-			Success: false,
-			Message: "请求参数错误: " + err.Error(),
-		})
-		return
-	}
-
-	// 转换为PDF填充数据
-	data := service.ConvertReceiptToData(&req)
-
-	// 生成PDF
-	outputPath, err := h.pdfService.FillReceipt(data)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "生成收据PDF失败: " + err.Error(),
-		})
-		return
-	}
-
-	// 检查文件是否存在
-	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "PDF文件生成失败",
-		})
-		return
-	}
-
-	// 读取PDF文件内容
-	pdfBytes, err := os.ReadFile(outputPath)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "读取PDF文件失败: " + err.Error(),
-		})
-		return
-	}
-
-	// 转换为Base64编码
-	base64PDF := base64.StdEncoding.EncodeToString(pdfBytes)
-
-	// 创建备份目录
-	backupDir := "backup"
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "创建备份目录失败: " + err.Error(),
-		})
+	data, ok := h.bindReceipt(c)
+	if !ok {
 		return
 	}
 
-	// 生成备份文件名（包含时间戳和收据ID）
-	backupFileName := fmt.Sprintf("receipt_%s_%s.pdf", data.ID, time.Now().Format("20060102_150405"))
-	backupPath := filepath.Join(backupDir, backupFileName)
-
-	// 创建备份文件
-	err = os.WriteFile(backupPath, pdfBytes, 0644)
-	if err != nil {
-		// 备份失败不影响主要功能，记录错误但继续执行
-		fmt.Printf("警告：备份文件失败: %v\n", err)
+	// 生成PDF，重复请求返回首次生成时备份的文件
+	pdfBytes, replayed := h.replayedFile(c, service.FormatPDF)
+	if !replayed {
+		var buf bytes.Buffer
+		if err := h.pdfService.RenderReceipt(&buf, data, service.FormatPDF); err != nil {
+			c.JSON(renderErrorStatus(err), model.ReceiptResponse{
+				Success: false,
+				Message: "生成收据PDF失败: " + err.Error(),
+			})
+			return
+		}
+		pdfBytes = buf.Bytes()
 	}
 
-	// 获取文件信息
-	fileInfo, err := os.Stat(outputPath)
+	// 保存备份并登记收据
+	backupPath, err := h.backupReceipt(c, data, "pdf", pdfBytes)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
 			Success: false,
-			Message: "无法获取文件信息: " + err.Error(),
+			Message: err.Error(),
 		})
 		return
 	}
@@ -186,25 +170,20 @@ func (h *ReceiptHandler) GenerateReceiptForMiniProgram(c *gin.Context) {
 	fileName := fmt.Sprintf("receipt_%s_%s.pdf", data.RoomNumber, time.Now().Format("20060102_150405"))
 
 	// 返回JSON响应给小程序
+	c.Header("X-Receipt-Number", data.ID)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "收据生成成功",
 		"data": gin.H{
 			"receiptId":    data.ID,
 			"fileName":     fileName,
-			"fileSize":     fileInfo.Size(),
-			"pdfBase64":    base64PDF,
+			"fileSize":     len(pdfBytes),
+			"pdfBase64":    base64.StdEncoding.EncodeToString(pdfBytes),
 			"contentType":  "application/pdf",
 			"generateTime": time.Now().Format("2006-01-02 15:04:05"),
 			"backupPath":   backupPath, // 返回备份路径信息
 		},
 	})
-
-	// 清理临时文件
-	go func() {
-		time.Sleep(1 * time.Minute) // 1分钟后清理
-		os.Remove(outputPath)
-	}()
 }
 
 // GenerateReceiptImage 生成收据图片
@@ -214,67 +193,48 @@ func (h *ReceiptHandler) GenerateReceiptForMiniProgram(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param request body model.ReceiptRequest true "收据信息"
+// @Param Idempotency-Key header string false "幂等键，重复请求返回首次生成的收据"
 // @Success 200 {object} map[string]interface{} "生成成功"
 // @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 409 {object} model.ReceiptResponse "相同的请求正在处理中"
+// @Failure 410 {object} model.ReceiptResponse "重复请求对应的收据已作废"
+// @Failure 422 {object} model.ReceiptResponse "Idempotency-Key已用于内容不同的请求"
 // @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
 // @Router /api/receipt/generate-image [post]
 func (h *ReceiptHandler) GenerateReceiptImage(c *gin.Context) {
-	var req model.ReceiptRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
-			Success: false,
-			Message: "请求参数错误: " + err.Error(),
-		})
+	data, ok := h.bindReceipt(c)
+	if !ok {
 		return
 	}
 
-	// 转换为收据数据
-	data := service.ConvertReceiptToData(&req)
-
-	// 生成收据图片并直接返回Base64编码
-	base64Image, err := h.pdfService.GenerateReceiptImageBase64(data)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "生成收据图片失败: " + err.Error(),
-		})
-		return
+	// 生成收据图片，重复请求返回首次生成时备份的文件
+	imageBytes, replayed := h.replayedFile(c, service.FormatPNG)
+	if !replayed {
+		var buf bytes.Buffer
+		if err := h.pdfService.RenderReceipt(&buf, data, service.FormatPNG); err != nil {
+			c.JSON(renderErrorStatus(err), model.ReceiptResponse{
+				Success: false,
+				Message: "生成收据图片失败: " + err.Error(),
+			})
+			return
+		}
+		imageBytes = buf.Bytes()
 	}
 
-	// 为备份功能，将Base64转换回字节数据
-	imageBytes, err := base64.StdEncoding.DecodeString(base64Image)
+	// 保存备份并登记收据
+	backupPath, err := h.backupReceipt(c, data, "png", imageBytes)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
 			Success: false,
-			Message: "图片数据处理失败: " + err.Error(),
+			Message: err.Error(),
 		})
 		return
 	}
 
-	// 创建备份目录
-	backupDir := "backup"
-	if err := os.MkdirAll(backupDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
-			Success: false,
-			Message: "创建备份目录失败: " + err.Error(),
-		})
-		return
-	}
-
-	// 生成备份文件名
-	backupFileName := fmt.Sprintf("receipt_%s_%s.png", data.ID, time.Now().Format("20060102_150405"))
-	backupPath := filepath.Join(backupDir, backupFileName)
-
-	// 创建备份文件
-	err = os.WriteFile(backupPath, imageBytes, 0644)
-	if err != nil {
-		// 备份失败不影响主要功能，记录错误但继续执行
-		fmt.Printf("警告：备份图片文件失败: %v\n", err)
-	}
-
 	fileName := fmt.Sprintf("receipt_%s_%s.png", data.RoomNumber, time.Now().Format("20060102_150405"))
 
 	// 返回JSON响应给小程序
+	c.Header("X-Receipt-Number", data.ID)
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "收据图片生成成功",
@@ -282,7 +242,7 @@ func (h *ReceiptHandler) GenerateReceiptImage(c *gin.Context) {
 			"receiptId":    data.ID,
 			"fileName":     fileName,
 			"fileSize":     len(imageBytes),
-			"imageBase64":  base64Image,
+			"imageBase64":  base64.StdEncoding.EncodeToString(imageBytes),
 			"contentType":  "image/png",
 			"generateTime": time.Now().Format("2006-01-02 15:04:05"),
 			"backupPath":   backupPath,
@@ -290,6 +250,134 @@ func (h *ReceiptHandler) GenerateReceiptImage(c *gin.Context) {
 	})
 }
 
+// bindReceipt 解析收据请求并分配收据编号，失败时已写入错误响应；重复请求返回首次登记的收据数据
+func (h *ReceiptHandler) bindReceipt(c *gin.Context) (*model.ReceiptData, bool) {
+	if record := replayedReceipt(c); record != nil {
+		data := record.ReceiptData
+		return &data, true
+	}
+
+	var req model.ReceiptRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	// 转换为收据数据
+	data, err := service.ConvertReceiptToData(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	// 分配收据编号
+	if err := h.pdfService.AssignNumber(data); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrNumberField) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, model.ReceiptResponse{
+			Success: false,
+			Message: "分配收据编号失败: " + err.Error(),
+		})
+		return nil, false
+	}
+
+	return data, true
+}
+
+// impositionOptions 将拼版请求转换为拼版参数，未指定间距时使用默认值
+func impositionOptions(req *model.ImpositionRequest) service.Imposition {
+	gutter := float64(service.DefaultGutter)
+	if req.Gutter != nil {
+		gutter = *req.Gutter
+	}
+	return service.Imposition{
+		Sheet:     req.Sheet,
+		Up:        req.Up,
+		Gutter:    gutter,
+		CropMarks: req.CropMarks,
+	}
+}
+
+// backupReceipt 将生成的收据保存到备份存储并登记，返回备份文件位置
+//
+// 备份失败不影响本次生成，只登记收据，返回空路径；登记失败时返回错误，已保存的备份随之删除。
+// 重复请求不再备份和登记，返回首次生成时的备份位置。
+func (h *ReceiptHandler) backupReceipt(c *gin.Context, data *model.ReceiptData, format string, content []byte) (string, error) {
+	if record := replayedReceipt(c); record != nil {
+		return h.recordedBackupPath(record, format), nil
+	}
+
+	entry, err := h.backups.Save(data.ID, format, time.Now(), content)
+	if err != nil {
+		fmt.Printf("警告：备份文件失败: %v\n", err)
+		return "", h.recordReceipt(data, format, "", content)
+	}
+
+	if err := h.recordReceipt(data, format, entry.Name, content); err != nil {
+		if derr := h.backups.Delete(entry.Name); derr != nil {
+			fmt.Printf("警告：删除未登记收据的备份失败: %v\n", derr)
+		}
+		return "", err
+	}
+	return h.backups.Location(entry), nil
+}
+
+// recordedBackupPath 返回登记记录中首次生成的该格式文件的备份位置，没有备份或备份已删除时为空
+func (h *ReceiptHandler) recordedBackupPath(record *model.ReceiptRecord, format string) string {
+	if entry := h.recordedBackup(record, format); entry != nil {
+		return h.backups.Location(entry)
+	}
+	return ""
+}
+
+// recordedBackup 返回登记记录中首次生成的该格式文件的备份，没有备份或备份已删除时返回nil
+func (h *ReceiptHandler) recordedBackup(record *model.ReceiptRecord, format string) *model.BackupEntry {
+	for _, file := range record.Files {
+		if file.Format != format {
+			continue
+		}
+		if file.FileName == "" {
+			return nil
+		}
+		entry, err := h.backups.Get(file.FileName)
+		if err != nil {
+			return nil
+		}
+		return entry
+	}
+	return nil
+}
+
+// replayedFile 返回重复请求对应的首次生成时备份的文件内容，与开具记录中的document_hash一致
+//
+// 不是重复请求时返回false。首次生成的文件没有备份（/generate接口不备份、备份失败或已被
+// 保留策略删除）或备份已损坏时也返回false，由调用方按登记的收据数据重新生成，此时文件内容
+// 与首次返回的不一定相同。
+func (h *ReceiptHandler) replayedFile(c *gin.Context, format string) ([]byte, bool) {
+	record := replayedReceipt(c)
+	if record == nil {
+		return nil, false
+	}
+	entry := h.recordedBackup(record, format)
+	if entry == nil {
+		return nil, false
+	}
+	content, err := h.backups.Read(entry)
+	if err != nil {
+		fmt.Printf("警告：读取重复请求的备份文件失败，按登记数据重新生成: %v\n", err)
+		return nil, false
+	}
+	return content, true
+}
+
 // GetReceiptInfo 获取收据信息（仅返回JSON，不生成PDF）
 // @Summary 获取收据信息
 // @Description 接收小程序发送的租金、房间号、收款人等信息，返回处理后的信息（预览功能）
@@ -311,7 +399,27 @@ func (h *ReceiptHandler) GetReceiptInfo(c *gin.Context) {
 	}
 
 	// 转换为PDF填充数据
-	data := service.ConvertReceiptToData(&req)
+	data, err := service.ConvertReceiptToData(&req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	// 预览编号，不占用序号
+	if err := h.pdfService.PreviewNumber(data); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrNumberField) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, model.ReceiptResponse{
+			Success: false,
+			Message: "读取收据编号失败: " + err.Error(),
+		})
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -344,51 +452,37 @@ func (h *ReceiptHandler) HealthCheck(c *gin.Context) {
 // @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
 // @Router /api/receipt/backup/list [get]
 func (h *ReceiptHandler) ListBackupReceipts(c *gin.Context) {
-	backupDir := "backup"
-
-	// 检查备份目录是否存在
-	if _, err := os.Stat(backupDir); os.IsNotExist(err) {
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"message": "暂无备份文件",
-			"data": gin.H{
-				"files": []interface{}{},
-				"count": 0,
-			},
-		})
-		return
-	}
-
-	// 读取备份目录
-	files, err := os.ReadDir(backupDir)
+	entries, err := h.backups.List()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
 			Success: false,
-			Message: "读取备份目录失败: " + err.Error(),
+			Message: "读取备份清单失败: " + err.Error(),
 		})
 		return
 	}
 
-	var backupFiles []map[string]interface{}
-	for _, file := range files {
-		if !file.IsDir() && filepath.Ext(file.Name()) == ".pdf" {
-			info, err := file.Info()
-			if err != nil {
-				continue
-			}
-
-			backupFiles = append(backupFiles, map[string]interface{}{
-				"fileName":    file.Name(),
-				"fileSize":    info.Size(),
-				"modTime":     info.ModTime().Format("2006-01-02 15:04:05"),
-				"downloadUrl": fmt.Sprintf("/api/receipt/backup/download/%s", file.Name()),
-			})
+	backupFiles := []map[string]interface{}{}
+	for _, entry := range entries {
+		if entry.Format != service.FormatPDF {
+			continue
 		}
+		backupFiles = append(backupFiles, map[string]interface{}{
+			"fileName":    entry.Name,
+			"fileSize":    entry.Size,
+			"modTime":     entry.IssuedAt.Local().Format("2006-01-02 15:04:05"),
+			"receiptId":   entry.ReceiptID,
+			"sha256":      entry.SHA256,
+			"downloadUrl": fmt.Sprintf("/api/receipt/backup/download/%s", entry.Name),
+		})
 	}
 
+	message := "获取备份文件列表成功"
+	if len(backupFiles) == 0 {
+		message = "暂无备份文件"
+	}
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "获取备份文件列表成功",
+		"message": message,
 		"data": gin.H{
 			"files": backupFiles,
 			"count": len(backupFiles),
@@ -403,24 +497,31 @@ func (h *ReceiptHandler) ListBackupReceipts(c *gin.Context) {
 // @Param fileName path string true "文件名"
 // @Produce application/pdf
 // @Success 200 {file} binary "PDF文件"
+// @Param allow_voided query bool false "允许下载已作废的收据，下载的文件标注\"作废\""
 // @Failure 404 {object} model.ReceiptResponse "文件不存在"
+// @Failure 410 {object} model.ReceiptResponse "收据已作废"
 // @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
 // @Router /api/receipt/backup/download/{fileName} [get]
 func (h *ReceiptHandler) DownloadBackupReceipt(c *gin.Context) {
 	fileName := c.Param("fileName")
-	backupPath := filepath.Join("backup", fileName)
 
 	// 检查文件是否存在
-	if _, err := os.Stat(backupPath); os.IsNotExist(err) {
-		c.JSON(http.StatusNotFound, model.ReceiptResponse{
+	entry, err := h.backups.Get(fileName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		message := "读取备份清单失败: " + err.Error()
+		if errors.Is(err, store.ErrBackupNotFound) {
+			status, message = http.StatusNotFound, "备份文件不存在"
+		}
+		c.JSON(status, model.ReceiptResponse{
 			Success: false,
-			Message: "备份文件不存在",
+			Message: message,
 		})
 		return
 	}
 
 	// 检查文件扩展名安全性
-	if filepath.Ext(fileName) != ".pdf" {
+	if path.Ext(fileName) != ".pdf" {
 		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
 			Success: false,
 			Message: "不支持的文件类型",
@@ -428,10 +529,43 @@ func (h *ReceiptHandler) DownloadBackupReceipt(c *gin.Context) {
 		return
 	}
 
-	// 设置响应头
-	c.Header("Content-Type", "application/pdf")
-	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	// 已作废的收据需明确指定 allow_voided 才能下载，下载的文件叠加作废印记
+	record, err := h.receipts.FindReceiptByFile(fileName)
+	if err == nil && record.Voided() {
+		if !allowVoided(c) {
+			respondVoided(c, record)
+			return
+		}
+
+		content, err := h.backups.Read(entry)
+		if err == nil {
+			content, err = h.pdfService.StampPDF(content, service.StampVoid)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+				Success: false,
+				Message: "读取备份文件失败: " + err.Error(),
+			})
+			return
+		}
+		c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+		c.Data(http.StatusOK, "application/pdf", content)
+		return
+	}
+
+	// 读取时校验摘要，不返回已损坏的文件
+	content, err := h.backups.Read(entry)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: "读取备份文件失败: " + err.Error(),
+		})
+		return
+	}
 
 	// 返回文件
-	c.File(backupPath)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	c.Header("Last-Modified", entry.IssuedAt.UTC().Format(http.TimeFormat))
+	c.Header("ETag", fmt.Sprintf("\"%s\"", entry.SHA256))
+	c.Data(http.StatusOK, "application/pdf", content)
 }
@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"receipt/internal/store"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListReceipts 查询已生成的收据
+// @Summary 查询收据
+// @Description 按房间号、付款人、收款人、日期范围、月份和金额范围查询已登记的收据，支持分页和排序
+// @Tags 收据
+// @Produce json
+// @Param room_number query string false "房间号"
+// @Param payer query string false "付款人（包含匹配）"
+// @Param recipient query string false "收款人（包含匹配）"
+// @Param status query string false "收据状态：issued、voided"
+// @Param month query string false "租金月份，如 2025年9月、2025-09"
+// @Param date_from query string false "收据日期下限，如 2025-01-01"
+// @Param date_to query string false "收据日期上限，如 2025-12-31"
+// @Param min_amount query string false "金额下限"
+// @Param max_amount query string false "金额上限"
+// @Param sort query string false "排序字段：created_at、date、amount、id、room_number"
+// @Param order query string false "排序方向：asc、desc"
+// @Param page query int false "页码，从1开始"
+// @Param page_size query int false "每页条数，最大100"
+// @Success 200 {object} map[string]interface{} "查询成功"
+// @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
+// @Router /api/receipts [get]
+func (h *ReceiptHandler) ListReceipts(c *gin.Context) {
+	var q model.ReceiptQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if _, _, err := q.DateRange(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+	if _, _, err := q.AmountRange(); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	records, total, err := h.receipts.ListReceipts(&q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	page, pageSize := q.Page, q.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = store.DefaultPageSize
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "查询收据成功",
+		"data": gin.H{
+			"receipts":  records,
+			"total":     total,
+			"page":      page,
+			"page_size": pageSize,
+		},
+	})
+}
+
+// GetReceipt 获取收据登记记录
+// @Summary 获取收据
+// @Description 按收据编号获取收据数据及生成的文件信息
+// @Tags 收据
+// @Produce json
+// @Param id path string true "收据编号"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 404 {object} model.ReceiptResponse "收据不存在"
+// @Router /api/receipts/{id} [get]
+func (h *ReceiptHandler) GetReceipt(c *gin.Context) {
+	record, err := h.receipts.GetReceipt(c.Param("id"))
+	if err != nil {
+		respondReceiptError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "获取收据成功",
+		"data":    record,
+	})
+}
+
+// RenderReceipt 按登记的收据数据重新渲染收据
+// @Summary 补打收据
+// @Description 使用登记的收据数据重新生成收据，可选择输出格式和模板，生成的文件标注"补打/副本"
+// @Tags 收据
+// @Produce application/pdf,image/png,image/jpeg
+// @Param id path string true "收据编号"
+// @Param format query string false "输出格式：pdf（默认）、png、jpeg"
+// @Param template query string false "模板名称，默认使用原收据的模板"
+// @Param allow_voided query bool false "允许补打已作废的收据，生成的文件标注\"作废\""
+// @Success 200 {file} binary "收据文件"
+// @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 404 {object} model.ReceiptResponse "收据或模板不存在"
+// @Failure 410 {object} model.ReceiptResponse "收据已作废"
+// @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
+// @Router /api/receipts/{id}/render [get]
+func (h *ReceiptHandler) RenderReceipt(c *gin.Context) {
+	format := c.DefaultQuery("format", service.FormatPDF)
+	contentType, ok := service.FormatContentType(format)
+	if !ok {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "不支持的输出格式: " + format,
+		})
+		return
+	}
+
+	record, err := h.receipts.GetReceipt(c.Param("id"))
+	if err != nil {
+		respondReceiptError(c, err)
+		return
+	}
+
+	stamps := []service.Stamp{service.StampReprint}
+	if record.Voided() {
+		if !allowVoided(c) {
+			respondVoided(c, record)
+			return
+		}
+		stamps = append(stamps, service.StampVoid)
+	}
+
+	data := record.ReceiptData
+	if template := c.Query("template"); template != "" {
+		data.Template = template
+	}
+
+	var buf bytes.Buffer
+	if err := h.pdfService.RenderReceipt(&buf, &data, format, stamps...); err != nil {
+		respondReceiptError(c, err)
+		return
+	}
+
+	fileName := fmt.Sprintf("receipt_%s_reprint.%s", data.ID, format)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	c.Header("X-Receipt-Number", data.ID)
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// VoidReceipt 作废收据
+// @Summary 作废收据
+// @Description 作废已开具的收据，记录作废原因和时间；作废后的收据仍保留登记记录，补打和下载时标注"作废"
+// @Tags 收据
+// @Accept json
+// @Produce json
+// @Param id path string true "收据编号"
+// @Param request body model.VoidRequest true "作废原因"
+// @Success 200 {object} map[string]interface{} "作废成功"
+// @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 404 {object} model.ReceiptResponse "收据不存在"
+// @Failure 409 {object} model.ReceiptResponse "收据已作废"
+// @Router /api/receipts/{id}/void [post]
+func (h *ReceiptHandler) VoidReceipt(c *gin.Context) {
+	var req model.VoidRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	record, err := h.receipts.VoidReceipt(c.Param("id"), req.Reason)
+	if err != nil {
+		respondReceiptError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "收据已作废",
+		"data":    record,
+	})
+}
+
+// ReissueReceipt 重开收据
+// @Summary 重开收据
+// @Description 以新编号重新开具收据并与原收据关联，原收据尚未作废时一并作废；未提供更正后的收据信息时按原收据数据重开
+// @Tags 收据
+// @Accept json
+// @Produce application/pdf
+// @Param id path string true "原收据编号"
+// @Param request body model.ReissueRequest false "作废原因及更正后的收据信息"
+// @Success 200 {file} binary "新收据PDF"
+// @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Failure 404 {object} model.ReceiptResponse "收据不存在"
+// @Failure 409 {object} model.ReceiptResponse "收据已重开"
+// @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
+// @Router /api/receipts/{id}/reissue [post]
+func (h *ReceiptHandler) ReissueReceipt(c *gin.Context) {
+	var req model.ReissueRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+				Success: false,
+				Message: "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	original, err := h.receipts.GetReceipt(c.Param("id"))
+	if err != nil {
+		respondReceiptError(c, err)
+		return
+	}
+	if original.ReplacedBy != "" {
+		respondReceiptError(c, fmt.Errorf("%w: %s 已由 %s 替代", store.ErrReceiptReplaced, original.ID, original.ReplacedBy))
+		return
+	}
+	if !original.Voided() && req.Reason == "" {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "原收据尚未作废，请填写作废原因",
+		})
+		return
+	}
+
+	// 未提供更正信息时沿用原收据数据，模板也沿用原收据的模板
+	data := original.ReceiptData
+	if req.Receipt != nil {
+		converted, err := service.ConvertReceiptToData(req.Receipt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+				Success: false,
+				Message: "请求参数错误: " + err.Error(),
+			})
+			return
+		}
+		if converted.Template == "" && converted.Renderer == "" {
+			converted.Template = original.Template
+			converted.Renderer = original.Renderer
+		}
+		data = *converted
+	}
+	data.CreatedAt = time.Now()
+
+	if err := h.pdfService.AssignNumber(&data); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrNumberField) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, model.ReceiptResponse{
+			Success: false,
+			Message: "分配收据编号失败: " + err.Error(),
+		})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := h.pdfService.RenderReceipt(&buf, &data, service.FormatPDF); err != nil {
+		respondReceiptError(c, err)
+		return
+	}
+
+	// 与生成接口一样保存备份，备份失败时只登记；重开失败时删除已保存的备份
+	backupFileName := ""
+	entry, err := h.backups.Save(data.ID, service.FormatPDF, time.Now(), buf.Bytes())
+	if err != nil {
+		fmt.Printf("警告：备份文件失败: %v\n", err)
+	} else {
+		backupFileName = entry.Name
+	}
+
+	_, _, err = h.receipts.ReissueReceipt(original.ID, req.Reason, &data, model.NewReceiptFile(service.FormatPDF, backupFileName, buf.Bytes()))
+	if err != nil {
+		if entry != nil {
+			if derr := h.backups.Delete(entry.Name); derr != nil {
+				fmt.Printf("警告：删除未登记收据的备份失败: %v\n", derr)
+			}
+		}
+		respondReceiptError(c, err)
+		return
+	}
+
+	fileName := fmt.Sprintf("receipt_%s.pdf", data.ID)
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=\"%s\"", fileName))
+	c.Header("X-Receipt-Number", data.ID)
+	c.Header("X-Replaces-Receipt", original.ID)
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Data(http.StatusOK, "application/pdf", buf.Bytes())
+}
+
+// allowVoided 请求是否明确允许获取已作废的收据
+func allowVoided(c *gin.Context) bool {
+	allow, _ := strconv.ParseBool(c.Query("allow_voided"))
+	return allow
+}
+
+// respondVoided 拒绝获取已作废的收据
+func respondVoided(c *gin.Context, record *model.ReceiptRecord) {
+	c.JSON(http.StatusGone, model.ReceiptResponse{
+		Success: false,
+		Message: voidedMessage(record) + "；如确需获取请指定 allow_voided=true",
+	})
+}
+
+// voidedMessage 已作废收据的提示，重开的收据附上替代的收据编号
+func voidedMessage(record *model.ReceiptRecord) string {
+	message := fmt.Sprintf("收据%s已作废", record.ID)
+	if record.ReplacedBy != "" {
+		message += "，已由" + record.ReplacedBy + "替代"
+	}
+	return message
+}
+
+// respondReceiptError 将收据查询和渲染错误映射为HTTP状态码
+func respondReceiptError(c *gin.Context, err error) {
+	status := renderErrorStatus(err)
+	switch {
+	case errors.Is(err, store.ErrReceiptNotFound), errors.Is(err, service.ErrTemplateNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, store.ErrReceiptVoided), errors.Is(err, store.ErrReceiptReplaced):
+		status = http.StatusConflict
+	}
+	c.JSON(status, model.ReceiptResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
+
+// renderErrorStatus 返回渲染错误的HTTP状态码，收据无法按请求的方式渲染时为400
+func renderErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrRasterUnsupported), errors.Is(err, service.ErrCopiesUnsupported),
+		errors.Is(err, service.ErrImpositionNotFit), errors.Is(err, service.ErrImpositionUnsupported):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// recordReceipt 登记收据及生成的文件；登记失败的收据没有登记记录和开具记录，不能交给调用方
+func (h *ReceiptHandler) recordReceipt(data *model.ReceiptData, format, backupFileName string, content []byte) error {
+	return h.receipts.RecordReceipt(data, model.NewReceiptFile(format, backupFileName, content))
+}
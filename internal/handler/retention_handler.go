@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetJanitor 设置备份保留策略，未设置时不提供清理预演
+func (h *ReceiptHandler) SetJanitor(janitor *service.Janitor) {
+	h.janitor = janitor
+}
+
+// GetBackupRetention 预演备份保留策略
+// @Summary 预演备份清理
+// @Description 按当前配置的保留策略列出将被删除（超过保留年限、同一收据编号有更新的备份）和归档到月度压缩包的备份文件，不修改任何文件
+// @Tags 收据
+// @Produce json
+// @Success 200 {object} map[string]interface{} "预演结果"
+// @Failure 500 {object} model.ReceiptResponse "服务器内部错误"
+// @Router /api/receipt/backup/retention [get]
+func (h *ReceiptHandler) GetBackupRetention(c *gin.Context) {
+	if h.janitor == nil {
+		c.JSON(http.StatusServiceUnavailable, model.ReceiptResponse{
+			Success: false,
+			Message: "未启用备份保留策略",
+		})
+		return
+	}
+
+	report, err := h.janitor.Plan(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+			Success: false,
+			Message: "读取备份目录失败: " + err.Error(),
+		})
+		return
+	}
+
+	message := "预演备份清理成功"
+	if !report.Policy.Enabled() {
+		message = "未配置保留策略，不会删除任何备份"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    report,
+	})
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSealSize 上传印章图片的最大字节数
+const maxSealSize = 2 << 20
+
+type SealHandler struct {
+	seals *service.SealRegistry
+}
+
+func NewSealHandler(seals *service.SealRegistry) *SealHandler {
+	return &SealHandler{
+		seals: seals,
+	}
+}
+
+// ListSeals 列出全部印章图片
+// @Summary 列出印章图片
+// @Description 获取已登记的公章、财务专用章和经手人签名图片
+// @Tags 印章
+// @Produce json
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Router /api/seals [get]
+func (h *SealHandler) ListSeals(c *gin.Context) {
+	seals := h.seals.List()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "获取印章列表成功",
+		"data": gin.H{
+			"seals": seals,
+			"count": len(seals),
+		},
+	})
+}
+
+// DownloadSeal 下载印章图片
+// @Summary 下载印章图片
+// @Tags 印章
+// @Produce png
+// @Param owner path string true "所有者：收款人姓名或出租方名称"
+// @Param kind path string true "印章类型：company、finance 或 signature"
+// @Success 200 {file} binary "印章图片"
+// @Failure 404 {object} model.ReceiptResponse "印章图片不存在"
+// @Router /api/seals/{owner}/{kind} [get]
+func (h *SealHandler) DownloadSeal(c *gin.Context) {
+	seal, err := h.seals.Get(c.Param("owner"), c.Param("kind"))
+	if err != nil {
+		respondSealError(c, err)
+		return
+	}
+
+	c.File(seal.Path())
+}
+
+// UploadSeal 上传印章图片
+// @Summary 上传印章图片
+// @Description 以multipart表单上传透明背景的PNG图片。公章和财务专用章按出租方登记，经手人签名按收款人登记，
+// @Description 版式中的seal元素按所有者和类型取图叠加在盖章位置
+// @Tags 印章
+// @Accept multipart/form-data
+// @Produce json
+// @Param owner formData string true "所有者：收款人姓名或出租方名称"
+// @Param kind formData string true "印章类型：company、finance 或 signature"
+// @Param file formData file true "PNG图片"
+// @Param overwrite formData bool false "是否覆盖已登记的图片"
+// @Success 200 {object} map[string]interface{} "上传成功"
+// @Failure 400 {object} model.ReceiptResponse "图片无效"
+// @Failure 409 {object} model.ReceiptResponse "印章图片已存在"
+// @Router /api/seals [post]
+func (h *SealHandler) UploadSeal(c *gin.Context) {
+	owner, kind := c.PostForm("owner"), c.PostForm("kind")
+	fileHeader, err := c.FormFile("file")
+	if err != nil || owner == "" || kind == "" {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: 需要owner、kind和file字段",
+		})
+		return
+	}
+	if fileHeader.Size > maxSealSize {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "印章图片过大",
+		})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "读取上传文件失败: " + err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "读取上传文件失败: " + err.Error(),
+		})
+		return
+	}
+
+	seal, err := h.seals.Save(owner, kind, content, c.PostForm("overwrite") == "true")
+	if err != nil {
+		respondSealError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": fmt.Sprintf("%s上传成功", seal.KindName),
+		"data":    seal,
+	})
+}
+
+// DeleteSeal 删除印章图片
+// @Summary 删除印章图片
+// @Tags 印章
+// @Produce json
+// @Param owner path string true "所有者：收款人姓名或出租方名称"
+// @Param kind path string true "印章类型：company、finance 或 signature"
+// @Success 200 {object} model.ReceiptResponse "删除成功"
+// @Failure 404 {object} model.ReceiptResponse "印章图片不存在"
+// @Router /api/seals/{owner}/{kind} [delete]
+func (h *SealHandler) DeleteSeal(c *gin.Context) {
+	if err := h.seals.Delete(c.Param("owner"), c.Param("kind")); err != nil {
+		respondSealError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.ReceiptResponse{
+		Success: true,
+		Message: "印章图片删除成功",
+	})
+}
+
+// respondSealError 将印章图片库错误映射为HTTP状态码
+func respondSealError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, service.ErrSealNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrSealExists):
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, model.ReceiptResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"receipt/internal/model"
+	"receipt/internal/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxVerifySize 校验签名时上传PDF的最大字节数
+const maxVerifySize = 10 << 20
+
+// VerifyReceipt 校验收据PDF的数字签名
+// @Summary 校验收据签名
+// @Description 上传收据PDF（multipart表单的file字段，或直接以application/pdf作为请求体），返回签名人、签名时间以及签名后文件是否被修改
+// @Tags 收据
+// @Accept multipart/form-data,application/pdf
+// @Produce json
+// @Param file formData file false "收据PDF"
+// @Success 200 {object} map[string]interface{} "校验完成"
+// @Failure 400 {object} model.ReceiptResponse "请求参数错误"
+// @Router /api/receipt/verify [post]
+func (h *ReceiptHandler) VerifyReceipt(c *gin.Context) {
+	content, err := readUploadedPDF(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: " + err.Error(),
+		})
+		return
+	}
+
+	signatures, err := h.pdfService.VerifyReceipt(content)
+	if errors.Is(err, service.ErrNotSigned) {
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"message": err.Error(),
+			"data": gin.H{
+				"signed":     false,
+				"signatures": []service.SignatureVerification{},
+			},
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "校验签名失败: " + err.Error(),
+		})
+		return
+	}
+
+	altered, trusted := false, true
+	for _, s := range signatures {
+		altered = altered || s.Altered
+		trusted = trusted && s.Trusted
+	}
+	message := "签名有效，签名后文件未被修改"
+	if altered {
+		message = "签名后文件已被修改"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data": gin.H{
+			"signed":     true,
+			"altered":    altered,
+			"trusted":    trusted,
+			"signatures": signatures,
+		},
+	})
+}
+
+// readUploadedPDF 读取multipart表单的file字段或请求体中的PDF
+func readUploadedPDF(c *gin.Context) ([]byte, error) {
+	var r io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			return nil, errors.New("需要file字段")
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	content, err := io.ReadAll(io.LimitReader(r, maxVerifySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxVerifySize {
+		return nil, errors.New("文件过大")
+	}
+	if !bytes.HasPrefix(content, []byte("%PDF-")) {
+		return nil, errors.New("不是PDF文件")
+	}
+	return content, nil
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"receipt/internal/model"
+	"receipt/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxTemplateSize 上传模板的最大字节数
+const maxTemplateSize = 10 << 20
+
+type TemplateHandler struct {
+	templates *service.TemplateRegistry
+}
+
+func NewTemplateHandler(templates *service.TemplateRegistry) *TemplateHandler {
+	return &TemplateHandler{
+		templates: templates,
+	}
+}
+
+// ListTemplates 列出全部模板
+// @Summary 列出模板
+// @Description 获取模板库中的全部收据模板
+// @Tags 模板
+// @Produce json
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Router /api/templates [get]
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	templates := h.templates.List()
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "获取模板列表成功",
+		"data": gin.H{
+			"templates": templates,
+			"count":     len(templates),
+			"default":   h.templates.Default(),
+		},
+	})
+}
+
+// GetTemplate 获取模板详情
+// @Summary 获取模板详情
+// @Description 返回模板信息，版式模板附带版式内容，AcroForm模板附带表单字段名称
+// @Tags 模板
+// @Produce json
+// @Param name path string true "模板名称"
+// @Success 200 {object} map[string]interface{} "获取成功"
+// @Failure 404 {object} model.ReceiptResponse "模板不存在"
+// @Router /api/templates/{name} [get]
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	t, err := h.templates.Get(c.Param("name"))
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	data := gin.H{"template": t}
+	if layout := t.Layout(); layout != nil {
+		data["layout"] = layout
+	}
+	if t.Kind == service.TemplateKindAcroForm {
+		fields, err := t.FieldNames()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, model.ReceiptResponse{
+				Success: false,
+				Message: err.Error(),
+			})
+			return
+		}
+		data["fields"] = fields
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "获取模板成功",
+		"data":    data,
+	})
+}
+
+// DownloadTemplate 下载模板文件
+// @Summary 下载模板文件
+// @Tags 模板
+// @Param name path string true "模板名称"
+// @Success 200 {file} binary "模板文件"
+// @Failure 404 {object} model.ReceiptResponse "模板不存在"
+// @Router /api/templates/{name}/file [get]
+func (h *TemplateHandler) DownloadTemplate(c *gin.Context) {
+	t, err := h.templates.Get(c.Param("name"))
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	// 内置模板没有文件，直接返回版式JSON
+	if t.Builtin {
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.json\"", t.Name))
+		c.JSON(http.StatusOK, t.Layout())
+		return
+	}
+
+	c.FileAttachment(t.Path(), fmt.Sprintf("%s%s", t.Name, filepath.Ext(t.Path())))
+}
+
+// UploadTemplate 上传模板
+// @Summary 上传模板
+// @Description 以multipart表单上传模板文件：.json为版式模板，.pdf为AcroForm模板
+// @Tags 模板
+// @Accept multipart/form-data
+// @Produce json
+// @Param name formData string true "模板名称"
+// @Param file formData file true "模板文件"
+// @Param overwrite formData bool false "是否覆盖同名模板"
+// @Success 200 {object} map[string]interface{} "上传成功"
+// @Failure 400 {object} model.ReceiptResponse "模板无效"
+// @Failure 409 {object} model.ReceiptResponse "模板已存在"
+// @Router /api/templates [post]
+func (h *TemplateHandler) UploadTemplate(c *gin.Context) {
+	name := c.PostForm("name")
+	fileHeader, err := c.FormFile("file")
+	if err != nil || name == "" {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "请求参数错误: 需要name和file字段",
+		})
+		return
+	}
+
+	kind, ok := service.TemplateKindFromFileName(fileHeader.Filename)
+	if !ok {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "不支持的模板文件类型，仅支持.json和.pdf",
+		})
+		return
+	}
+	if fileHeader.Size > maxTemplateSize {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "模板文件过大",
+		})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "读取上传文件失败: " + err.Error(),
+		})
+		return
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, model.ReceiptResponse{
+			Success: false,
+			Message: "读取上传文件失败: " + err.Error(),
+		})
+		return
+	}
+
+	t, err := h.templates.Save(name, kind, content, c.PostForm("overwrite") == "true")
+	if err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "模板上传成功",
+		"data":    t,
+	})
+}
+
+// DeleteTemplate 删除模板
+// @Summary 删除模板
+// @Tags 模板
+// @Produce json
+// @Param name path string true "模板名称"
+// @Success 200 {object} model.ReceiptResponse "删除成功"
+// @Failure 404 {object} model.ReceiptResponse "模板不存在"
+// @Failure 409 {object} model.ReceiptResponse "模板不可删除"
+// @Router /api/templates/{name} [delete]
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	if err := h.templates.Delete(c.Param("name")); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.ReceiptResponse{
+		Success: true,
+		Message: "模板删除成功",
+	})
+}
+
+// SetDefaultTemplate 设置默认模板
+// @Summary 设置默认模板
+// @Description 未指定template的收据请求将使用默认模板
+// @Tags 模板
+// @Produce json
+// @Param name path string true "模板名称"
+// @Success 200 {object} model.ReceiptResponse "设置成功"
+// @Failure 404 {object} model.ReceiptResponse "模板不存在"
+// @Router /api/templates/{name}/default [post]
+func (h *TemplateHandler) SetDefaultTemplate(c *gin.Context) {
+	if err := h.templates.SetDefault(c.Param("name")); err != nil {
+		respondTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.ReceiptResponse{
+		Success: true,
+		Message: "默认模板设置成功",
+	})
+}
+
+// respondTemplateError 将模板库错误映射为HTTP状态码
+func respondTemplateError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	switch {
+	case errors.Is(err, service.ErrTemplateNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, service.ErrTemplateExists),
+		errors.Is(err, service.ErrTemplateReadOnly),
+		errors.Is(err, service.ErrTemplateInUse):
+		status = http.StatusConflict
+	}
+
+	c.JSON(status, model.ReceiptResponse{
+		Success: false,
+		Message: err.Error(),
+	})
+}
@@ -0,0 +1,162 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+	"receipt/internal/model"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// receiptVerification 在线校验页面展示的收据信息，付款人姓名部分隐藏
+type receiptVerification struct {
+	ID              string     `json:"id"`
+	Rent            string     `json:"rent"`
+	RentZh          string     `json:"rent_zh"`
+	Date            string     `json:"date"`
+	Month           string     `json:"month"`
+	Purpose         string     `json:"purpose"`
+	RoomNumber      string     `json:"room_number"`
+	Payer           string     `json:"payer"`
+	Recipient       string     `json:"recipient"`
+	Landlord        string     `json:"landlord,omitempty"`
+	PaymentMethodZh string     `json:"payment_method_zh,omitempty"`
+	Status          string     `json:"status"`
+	VoidedAt        *time.Time `json:"voided_at,omitempty"`
+	ReplacedBy      string     `json:"replaced_by,omitempty"`
+	IssuedAt        time.Time  `json:"issued_at"`
+}
+
+// verifyPageTemplate 在线校验HTML页面
+var verifyPageTemplate = template.Must(template.New("verify").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>收据校验</title>
+<style>
+body { font-family: sans-serif; max-width: 480px; margin: 24px auto; padding: 0 16px; color: #222; }
+h1 { font-size: 20px; }
+.ok { color: #1a7f37; } .warn { color: #c00000; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 6px 4px; border-bottom: 1px solid #ddd; font-size: 14px; }
+th { width: 35%; color: #666; font-weight: normal; }
+</style>
+</head>
+<body>
+{{if .Receipt}}{{with .Receipt}}
+{{if eq .Status "voided"}}<h1 class="warn">该收据已作废</h1>{{else}}<h1 class="ok">收据真实有效</h1>{{end}}
+<table>
+<tr><th>收据号</th><td>{{.ID}}</td></tr>
+<tr><th>金额</th><td>¥{{.Rent}}（{{.RentZh}}）</td></tr>
+<tr><th>日期</th><td>{{.Date}}</td></tr>
+<tr><th>收费事项</th><td>{{.Month}} {{.Purpose}}</td></tr>
+<tr><th>房间号</th><td>{{.RoomNumber}}</td></tr>
+<tr><th>付款人</th><td>{{.Payer}}</td></tr>
+<tr><th>收款人</th><td>{{.Recipient}}</td></tr>
+{{if .Landlord}}<tr><th>出租方</th><td>{{.Landlord}}</td></tr>{{end}}
+{{if .PaymentMethodZh}}<tr><th>付款方式</th><td>{{.PaymentMethodZh}}</td></tr>{{end}}
+{{if .VoidedAt}}<tr><th>作废时间</th><td>{{.VoidedAt.Format "2006-01-02 15:04"}}</td></tr>{{end}}
+{{if .ReplacedBy}}<tr><th>重开收据号</th><td>{{.ReplacedBy}}</td></tr>{{end}}
+</table>
+{{end}}{{else}}
+<h1 class="warn">{{.Message}}</h1>
+<p>请核对二维码是否来自本服务开具的收据。</p>
+{{end}}
+</body>
+</html>
+`))
+
+// VerifyReceiptToken 收据在线校验
+// @Summary 收据在线校验
+// @Description 收据二维码中的公开校验地址，按登记记录确认收据编号、金额和日期，浏览器访问返回HTML页面，
+// @Description Accept为application/json或format=json时返回JSON
+// @Tags 收据
+// @Produce html,json
+// @Param token path string true "收据上二维码中的校验码"
+// @Param format query string false "json"
+// @Success 200 {object} map[string]interface{} "收据有效"
+// @Failure 404 {object} model.ReceiptResponse "收据不存在或校验码无效"
+// @Router /verify/{token} [get]
+func (h *ReceiptHandler) VerifyReceiptToken(c *gin.Context) {
+	token := c.Param("token")
+	verifier := h.pdfService.Verifier()
+	if verifier == nil {
+		respondVerification(c, http.StatusNotFound, "未启用收据在线校验", nil)
+		return
+	}
+
+	id, err := verifier.ReceiptID(token)
+	if err != nil {
+		respondVerification(c, http.StatusNotFound, "收据不存在或校验码无效", nil)
+		return
+	}
+	record, err := h.receipts.GetReceipt(id)
+	if err != nil || !verifier.Check(token, &record.ReceiptData) {
+		respondVerification(c, http.StatusNotFound, "收据不存在或校验码无效", nil)
+		return
+	}
+
+	message := "收据真实有效"
+	if record.Voided() {
+		message = "该收据已作废"
+	}
+	respondVerification(c, http.StatusOK, message, &receiptVerification{
+		ID:              record.ID,
+		Rent:            record.Rent.String(),
+		RentZh:          record.RentZh,
+		Date:            record.Date,
+		Month:           record.Month,
+		Purpose:         record.Purpose,
+		RoomNumber:      record.RoomNumber,
+		Payer:           maskName(record.Payer),
+		Recipient:       record.Recipient,
+		Landlord:        record.Landlord,
+		PaymentMethodZh: model.PaymentMethodName(record.PaymentMethod),
+		Status:          record.Status,
+		VoidedAt:        record.VoidedAt,
+		ReplacedBy:      record.ReplacedBy,
+		IssuedAt:        record.CreatedAt,
+	})
+}
+
+// respondVerification 按请求的格式返回校验结果，receipt为nil表示校验失败
+func respondVerification(c *gin.Context, status int, message string, receipt *receiptVerification) {
+	if c.Query("format") == "json" || c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		if receipt == nil {
+			c.JSON(status, model.ReceiptResponse{
+				Success: false,
+				Message: message,
+			})
+			return
+		}
+		c.JSON(status, gin.H{
+			"success": true,
+			"message": message,
+			"data": gin.H{
+				"valid":   true,
+				"voided":  receipt.Status == model.ReceiptStatusVoided,
+				"receipt": receipt,
+			},
+		})
+		return
+	}
+
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	verifyPageTemplate.Execute(c.Writer, gin.H{
+		"Message": message,
+		"Receipt": receipt,
+	})
+}
+
+// maskName 隐藏姓名除首字外的部分，如 李四 -> 李*
+func maskName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= 1 {
+		return name
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+}
@@ -0,0 +1,433 @@
+// Package importer 从CSV或Excel表格读取收据请求
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"receipt/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xuri/excelize/v2"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// 表格格式
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// MaxRows 单个表格最多导入的数据行数
+const MaxRows = 500
+
+// ErrUnsupportedFormat 不支持的表格格式
+var ErrUnsupportedFormat = errors.New("不支持的表格格式")
+
+// Row 表格中的一行数据
+type Row struct {
+	Line    int                   // 在表格中的行号，从1开始，表头为第1行时数据从第2行开始
+	Request *model.ReceiptRequest // 解析得到的收据请求，Err不为空时可能不完整
+	Err     error                 // 单元格格式错误
+}
+
+// Mapping 表头到ReceiptRequest字段（JSON名称）的映射，表头比较时忽略首尾空白和大小写
+type Mapping map[string]string
+
+// DefaultMapping 返回内置的表头映射，包含常用中文表头和字段的JSON名称
+func DefaultMapping() Mapping {
+	m := Mapping{
+		"房间号": "room_number", "房号": "room_number",
+		"租金": "rent", "金额": "rent",
+		"收款人": "recipient", "经手人": "recipient",
+		"付款人": "payer", "交款人": "payer", "租客": "payer",
+		"日期": "date", "收据日期": "date",
+		"月份": "month", "租金月份": "month",
+		"收费目的": "purpose", "用途": "purpose", "事由": "purpose",
+		"付款方式":  "payment_method",
+		"付款凭证号": "payment_reference", "凭证号": "payment_reference", "流水号": "payment_reference",
+		"出租方": "landlord", "房东": "landlord",
+		"模板": "template",
+		"联次": "copies",
+	}
+	for field := range fieldSetters {
+		m[field] = field
+	}
+	return m
+}
+
+// LoadMapping 从JSON文件加载表头映射，与内置映射合并，文件中的映射优先
+func LoadMapping(path string) (Mapping, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取表头映射失败: %v", err)
+	}
+	m, err := ParseMapping(content)
+	if err != nil {
+		return nil, err
+	}
+	return DefaultMapping().Merge(m)
+}
+
+// ParseMapping 解析JSON格式的表头映射，如 {"户号": "room_number"}
+func ParseMapping(content []byte) (Mapping, error) {
+	var m Mapping
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("解析表头映射失败: %v", err)
+	}
+	return m, nil
+}
+
+// Merge 返回在m的基础上叠加extra后的映射，extra中的字段名必须是可导入的字段
+func (m Mapping) Merge(extra Mapping) (Mapping, error) {
+	merged := make(Mapping, len(m)+len(extra))
+	for header, field := range m {
+		merged[normalizeHeader(header)] = field
+	}
+	for header, field := range extra {
+		if _, ok := fieldSetters[field]; !ok {
+			return nil, fmt.Errorf("表头%q映射到未知字段: %s", header, field)
+		}
+		merged[normalizeHeader(header)] = field
+	}
+	return merged, nil
+}
+
+// field 返回表头对应的字段，未映射时返回空字符串
+func (m Mapping) field(header string) string {
+	return m[normalizeHeader(header)]
+}
+
+// normalizeHeader 统一表头格式：去除首尾空白（含全角空格）并转为小写
+func normalizeHeader(header string) string {
+	return strings.ToLower(strings.Trim(header, " \t\r\n\u3000\ufeff"))
+}
+
+// FormatFromName 按文件扩展名判断表格格式
+func FormatFromName(name string) (string, error) {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".csv":
+		return FormatCSV, nil
+	case ".xlsx":
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("%w: %s，请使用.csv或.xlsx文件", ErrUnsupportedFormat, filepath.Ext(name))
+}
+
+// Parse 读取表格并按表头映射转换为收据请求
+//
+// 第一个非空行为表头，其后每个非空行为一张收据。XLSX读取worksheet指定的工作表，为空时读取第一个工作表。
+// 缺少必填列或表格无法读取时返回错误；单元格格式错误记入该行的Err，不影响其他行。
+func Parse(r io.Reader, format, worksheet string, mapping Mapping) ([]Row, error) {
+	var records [][]string
+	var err error
+	switch format {
+	case FormatCSV:
+		records, err = readCSV(r)
+	case FormatXLSX:
+		records, err = readXLSX(r, worksheet)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 跳过表头之前的空行
+	headerLine := 0
+	for headerLine < len(records) && blankRecord(records[headerLine]) {
+		headerLine++
+	}
+	if headerLine == len(records) {
+		return nil, fmt.Errorf("表格为空")
+	}
+
+	columns := make([]string, len(records[headerLine]))
+	present := make(map[string]bool)
+	for i, header := range records[headerLine] {
+		if field := mapping.field(header); field != "" {
+			columns[i] = field
+			present[field] = true
+		}
+	}
+	var missing []string
+	for _, field := range requiredFields {
+		if !present[field] {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("表格缺少必填列: %s", strings.Join(missing, ", "))
+	}
+
+	var rows []Row
+	for i := headerLine + 1; i < len(records); i++ {
+		if blankRecord(records[i]) {
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, fmt.Errorf("表格超过%d行", MaxRows)
+		}
+		rows = append(rows, parseRecord(i+1, columns, records[i]))
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("表格没有数据行")
+	}
+	return rows, nil
+}
+
+// requiredFields 表格必须包含的列
+var requiredFields = []string{"room_number", "rent", "recipient", "payer"}
+
+// parseRecord 将一行单元格转换为收据请求，多个单元格错误合并为一个错误
+func parseRecord(line int, columns, record []string) Row {
+	row := Row{Line: line, Request: &model.ReceiptRequest{}}
+	var errs []string
+	// 月份只写月数时取同一行日期的年份，因此最后解析月份
+	var months []int
+	set := func(i int) {
+		value := strings.TrimSpace(record[i])
+		if value == "" {
+			return
+		}
+		if err := fieldSetters[columns[i]](row.Request, value); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", columns[i], err))
+		}
+	}
+	for i := range record {
+		if i >= len(columns) || columns[i] == "" {
+			continue
+		}
+		if columns[i] == "month" {
+			months = append(months, i)
+			continue
+		}
+		set(i)
+	}
+	for _, i := range months {
+		set(i)
+	}
+	if len(errs) > 0 {
+		row.Err = errors.New(strings.Join(errs, "; "))
+	}
+	return row
+}
+
+// blankRecord 行中所有单元格是否为空
+func blankRecord(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// readCSV 读取CSV，支持UTF-8（可带BOM）和Excel常用的GBK编码
+func readCSV(r io.Reader) ([][]string, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取CSV失败: %v", err)
+	}
+	content = bytes.TrimPrefix(content, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(content) {
+		if content, err = simplifiedchinese.GB18030.NewDecoder().Bytes(content); err != nil {
+			return nil, fmt.Errorf("CSV编码无法识别: %v", err)
+		}
+	}
+
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("解析CSV失败: %v", err)
+	}
+	return records, nil
+}
+
+// readXLSX 读取XLSX工作表，单元格取原始值，日期格式的单元格转换为 2006-01-02
+func readXLSX(r io.Reader, worksheet string) ([][]string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("打开Excel文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if worksheet == "" {
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("Excel文件没有工作表")
+		}
+		worksheet = sheets[0]
+	}
+	records, err := f.GetRows(worksheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("读取工作表%s失败: %v", worksheet, err)
+	}
+
+	// 只有日期格式的数值单元格按Excel序列号转换，其他数值原样保留
+	dateStyles := make(map[int]bool)
+	for i, record := range records {
+		for j, value := range record {
+			serial, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			cell, err := excelize.CoordinatesToCellName(j+1, i+1)
+			if err != nil {
+				return nil, err
+			}
+			styleID, err := f.GetCellStyle(worksheet, cell)
+			if err != nil {
+				return nil, fmt.Errorf("读取单元格%s格式失败: %v", cell, err)
+			}
+			isDate, ok := dateStyles[styleID]
+			if !ok {
+				style, err := f.GetStyle(styleID)
+				if err != nil {
+					return nil, fmt.Errorf("读取单元格%s格式失败: %v", cell, err)
+				}
+				isDate = dateNumFmt(style)
+				dateStyles[styleID] = isDate
+			}
+			if !isDate {
+				continue
+			}
+			t, err := excelize.ExcelDateToTime(serial, false)
+			if err != nil {
+				return nil, fmt.Errorf("单元格%s日期无效: %s", cell, value)
+			}
+			record[j] = t.Format("2006-01-02")
+		}
+	}
+	return records, nil
+}
+
+// dateNumFmt 单元格的数字格式是否为日期，包括内置的日期格式和含年月日的自定义格式
+func dateNumFmt(style *excelize.Style) bool {
+	switch id := style.NumFmt; {
+	case id >= 14 && id <= 17, id == 22, id >= 27 && id <= 36, id >= 50 && id <= 58:
+		return true
+	}
+	if style.CustomNumFmt == nil {
+		return false
+	}
+	// 去掉不表示日期的部分后查找年月日，只有月和时分秒时为时间格式
+	format := dateFmtLiterals.ReplaceAllString(*style.CustomNumFmt, "")
+	return strings.ContainsAny(format, "yYdDe") || strings.ContainsAny(format, "mM") && !strings.ContainsAny(format, "hHsS")
+}
+
+// dateFmtLiterals 数字格式中不表示日期的部分：引号中的文字、转义和填充字符、方括号中的颜色和区域设置、General
+var dateFmtLiterals = regexp.MustCompile(`"[^"]*"|\\.|[_*].|\[[^\]]*\]|(?i)general`)
+
+// fieldSetters 可导入的字段及单元格解析方式
+var fieldSetters = map[string]func(req *model.ReceiptRequest, value string) error{
+	"room_number": func(req *model.ReceiptRequest, v string) error { req.RoomNumber = v; return nil },
+	"recipient":   func(req *model.ReceiptRequest, v string) error { req.Recipient = v; return nil },
+	"payer":       func(req *model.ReceiptRequest, v string) error { req.Payer = v; return nil },
+	"purpose":     func(req *model.ReceiptRequest, v string) error { req.Purpose = v; return nil },
+	"landlord":    func(req *model.ReceiptRequest, v string) error { req.Landlord = v; return nil },
+	"template":    func(req *model.ReceiptRequest, v string) error { req.Template = v; return nil },
+	"renderer":    func(req *model.ReceiptRequest, v string) error { req.Renderer = v; return nil },
+	"payment_reference": func(req *model.ReceiptRequest, v string) error {
+		req.PaymentReference = v
+		return nil
+	},
+	"rent": func(req *model.ReceiptRequest, v string) (err error) {
+		req.Rent, err = parseAmount(v)
+		return err
+	},
+	"date": func(req *model.ReceiptRequest, v string) (err error) {
+		req.Date, err = parseDate(v)
+		return err
+	},
+	"month": func(req *model.ReceiptRequest, v string) (err error) {
+		req.Month, err = parseMonth(v, req.Date)
+		return err
+	},
+	"payment_method": func(req *model.ReceiptRequest, v string) error {
+		for _, method := range model.PaymentMethods {
+			if strings.EqualFold(v, method) || v == model.PaymentMethodName(method) {
+				req.PaymentMethod = method
+				return nil
+			}
+		}
+		return fmt.Errorf("未知的付款方式: %s", v)
+	},
+	"copies": func(req *model.ReceiptRequest, v string) error {
+		req.Copies = nil
+		for _, name := range strings.FieldsFunc(v, func(r rune) bool { return strings.ContainsRune(",，、/ ", r) }) {
+			c, ok := copyAliases[strings.ToLower(name)]
+			if !ok {
+				return fmt.Errorf("未知的联次: %s", name)
+			}
+			req.Copies = append(req.Copies, c)
+		}
+		return nil
+	},
+}
+
+// copyAliases 联次的表格写法
+var copyAliases = map[string]string{
+	model.CopyStub: model.CopyStub, "存根联": model.CopyStub, "存根": model.CopyStub,
+	model.CopyCustomer: model.CopyCustomer, "收据联": model.CopyCustomer, "收据": model.CopyCustomer,
+	model.CopyAccounting: model.CopyAccounting, "记账联": model.CopyAccounting, "记账": model.CopyAccounting,
+}
+
+// parseAmount 解析金额，允许货币符号、千分位和"元"
+func parseAmount(v string) (model.Money, error) {
+	v = strings.NewReplacer("¥", "", "￥", "", ",", "", "，", "", "元", "", " ", "").Replace(v)
+	// Excel中的数值可能带有浮点误差，如 1500.0000000000002，只修正误差，不对多于两位的小数四舍五入
+	if f, err := strconv.ParseFloat(v, 64); err == nil && strings.ContainsAny(v, ".eE") {
+		if cents := f * 100; math.Abs(cents-math.Round(cents)) < 1e-6 {
+			v = strconv.FormatFloat(f, 'f', 2, 64)
+		}
+	}
+	return model.ParseMoney(v)
+}
+
+// parseDate 解析日期并统一为 2006-01-02，Excel日期单元格在读取时已转换
+func parseDate(v string) (string, error) {
+	if d, err := model.NormalizeDate(v); err == nil {
+		return d, nil
+	}
+	return "", fmt.Errorf("日期格式无效: %s", v)
+}
+
+// plainMonthPattern 只写月数的月份，如 9、09、9月
+var plainMonthPattern = regexp.MustCompile(`^(\d{1,2})月?$`)
+
+// parseMonth 解析月份并统一为 2006年01月
+//
+// 支持 202509、2025-09、2025年9月等年月写法，日期（取所在月份）和只写月数的月份；
+// 只写月数时年份取同一行的日期date，没有日期时取当年。其他写法返回错误。
+func parseMonth(v, date string) (string, error) {
+	if code, err := model.NormalizeMonth(v); err == nil {
+		return code[:4] + "年" + code[4:] + "月", nil
+	}
+	if d, err := parseDate(v); err == nil {
+		return d[:4] + "年" + d[5:7] + "月", nil
+	}
+	if m := plainMonthPattern.FindStringSubmatch(v); m != nil {
+		month, _ := strconv.Atoi(m[1])
+		if month < 1 || month > 12 {
+			return "", fmt.Errorf("月份超出范围: %s", v)
+		}
+		year := time.Now().Year()
+		if t, err := time.Parse("2006-01-02", date); err == nil {
+			year = t.Year()
+		}
+		return fmt.Sprintf("%d年%02d月", year, month), nil
+	}
+	return "", fmt.Errorf("月份格式无效: %s", v)
+}
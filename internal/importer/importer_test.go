@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestParseMonthCSV(t *testing.T) {
+	year := time.Now().Year()
+	tests := []struct {
+		month string
+		date  string
+		want  string // 为空时应返回错误
+	}{
+		{"202509", "", "2025年09月"},
+		{"2025-09", "", "2025年09月"},
+		{"2025-9", "", "2025年09月"},
+		{"2025年9月", "", "2025年09月"},
+		{"2025/09", "", "2025年09月"},
+		{"2025-09-21", "", "2025年09月"},
+		{"9", "2024-12-31", "2024年09月"},
+		{"09", "", fmt.Sprintf("%d年09月", year)},
+		{"9月", "", fmt.Sprintf("%d年09月", year)},
+		{"45901", "", ""},
+		{"13", "", ""},
+		{"2025年13月", "", ""},
+		{"九月", "", ""},
+		{"下个月", "", ""},
+	}
+
+	for _, tt := range tests {
+		csv := "房间号,租金,收款人,付款人,日期,月份\n101,1500,张三,李四," + tt.date + "," + tt.month + "\n"
+		rows, err := Parse(strings.NewReader(csv), FormatCSV, "", DefaultMapping())
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.month, err)
+		}
+		row := rows[0]
+		if tt.want == "" {
+			if row.Err == nil {
+				t.Errorf("month %q: got %q, want error", tt.month, row.Request.Month)
+			}
+			continue
+		}
+		if row.Err != nil {
+			t.Errorf("month %q: %v", tt.month, row.Err)
+			continue
+		}
+		if row.Request.Month != tt.want {
+			t.Errorf("month %q: got %q, want %q", tt.month, row.Request.Month, tt.want)
+		}
+	}
+}
+
+func TestParseXLSXDateCells(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+
+	dateStyle, err := f.NewStyle(&excelize.Style{NumFmt: 14})
+	if err != nil {
+		t.Fatal(err)
+	}
+	monthFmt := `yyyy"年"m"月"`
+	monthStyle, err := f.NewStyle(&excelize.Style{CustomNumFmt: &monthFmt})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := [][]interface{}{
+		{"房间号", "租金", "收款人", "付款人", "日期", "月份"},
+		{"101", 1500, "张三", "李四", time.Date(2025, 9, 21, 0, 0, 0, 0, time.UTC), time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{"102", 1500, "张三", "王五", "2025-09-21", 202509},
+		{"103", 1500, "张三", "赵六", "2025-09-21", 45901},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SetCellStyle(sheet, "E2", "E2", dateStyle); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SetCellStyle(sheet, "F2", "F2", monthStyle); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := Parse(&buf, FormatXLSX, "", DefaultMapping())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 3 {
+		t.Fatalf("got %d rows, want 3", len(parsed))
+	}
+
+	if r := parsed[0]; r.Err != nil || r.Request.Date != "2025-09-21" || r.Request.Month != "2025年09月" {
+		t.Errorf("date-formatted cells: date %q month %q err %v", r.Request.Date, r.Request.Month, r.Err)
+	}
+	if r := parsed[1]; r.Err != nil || r.Request.Month != "2025年09月" {
+		t.Errorf("numeric YYYYMM month: month %q err %v", r.Request.Month, r.Err)
+	}
+	// 未设置日期格式的数值不按Excel序列号转换
+	if r := parsed[2]; r.Err == nil {
+		t.Errorf("plain number 45901 accepted as month %q", r.Request.Month)
+	}
+}
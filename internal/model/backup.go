@@ -0,0 +1,46 @@
+package model
+
+import "time"
+
+// BackupEntry 备份清单中的一项：备份文件名对应的收据和文件内容的摘要
+//
+// 文件内容按SHA-256摘要保存，内容相同的备份共用一份文件。
+type BackupEntry struct {
+	Name      string    `json:"name"`       // 备份文件名，如 receipt_NO101202509-001_20250921_103000.pdf
+	ReceiptID string    `json:"receipt_id"` // 收据编号
+	Format    string    `json:"format"`     // 文件格式
+	SHA256    string    `json:"sha256"`     // 文件内容的SHA-256摘要
+	Size      int64     `json:"size"`       // 文件大小
+	IssuedAt  time.Time `json:"issued_at"`  // 生成时间
+}
+
+// 备份文件的问题
+const (
+	ScrubMissing    = "missing"    // 文件丢失
+	ScrubCorrupt    = "corrupt"    // 内容与摘要不符
+	ScrubUnreadable = "unreadable" // 读取失败，如对象存储暂时无法访问
+)
+
+// ScrubIssue 校验备份时发现的问题
+type ScrubIssue struct {
+	SHA256  string   `json:"sha256"`            // 清单中的摘要
+	Problem string   `json:"problem"`           // 问题：missing、corrupt 或 unreadable
+	Actual  string   `json:"actual,omitempty"`  // 文件内容实际的摘要
+	Names   []string `json:"names"`             // 受影响的备份文件名
+	Message string   `json:"message,omitempty"` // 读取失败的原因
+}
+
+// ScrubReport 一次备份校验的结果
+type ScrubReport struct {
+	StartedAt  time.Time     `json:"started_at"`        // 开始时间
+	FinishedAt time.Time     `json:"finished_at"`       // 结束时间
+	Entries    int           `json:"entries"`           // 清单中的备份数
+	Objects    int           `json:"objects"`           // 校验的文件数，内容相同的备份只校验一次
+	Issues     []*ScrubIssue `json:"issues"`            // 丢失、损坏或读取失败的文件
+	Orphans    []string      `json:"orphans,omitempty"` // 清单中没有引用的文件
+}
+
+// Healthy 是否没有发现丢失或损坏的文件
+func (r *ScrubReport) Healthy() bool {
+	return len(r.Issues) == 0
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// dateLayouts 收据日期支持的写法，如 2025-09-21、2025/9/21、2025.9.21、2025年9月21日、20250921
+var dateLayouts = []string{"2006-1-2", "2006/1/2", "2006.1.2", "2006年1月2日", "20060102"}
+
+// NormalizeDate 将日期统一为 YYYY-MM-DD，如 "2025年9月5日" -> "2025-09-05"，无法识别时返回错误
+func NormalizeDate(date string) (string, error) {
+	date = strings.TrimSpace(date)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("日期格式无效: %q", date)
+}
@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// 幂等记录的状态
+const (
+	IdempotencyPending   = "pending"   // 首次请求正在生成收据
+	IdempotencyCompleted = "completed" // 已生成，重复请求按登记的收据重新返回
+)
+
+// IdempotencyRecord 生成接口的一次请求及其生成的收据编号
+//
+// 只保存收据编号而不保存响应内容：重复请求时按登记的收据数据重新生成响应，并检查收据是否已作废。
+type IdempotencyRecord struct {
+	Key         string    `json:"key"`                  // 幂等键：key:<Idempotency-Key> 或 body:<请求摘要>
+	RequestHash string    `json:"request_hash"`         // 请求方法、路径、查询参数和请求体的SHA-256摘要
+	Status      string    `json:"status"`               // 状态：pending 或 completed
+	ReceiptID   string    `json:"receipt_id,omitempty"` // 首次请求生成的收据编号
+	CreatedAt   time.Time `json:"created_at"`           // 首次请求时间
+	ExpiresAt   time.Time `json:"expires_at"`           // 过期时间，之后同一幂等键视为新请求
+}
+
+// Completed 是否已生成收据
+func (r *IdempotencyRecord) Completed() bool {
+	return r.Status == IdempotencyCompleted
+}
@@ -0,0 +1,111 @@
+package model
+
+import "time"
+
+// 任务类型
+const (
+	JobKindBatch  = "batch"  // 批量生成收据
+	JobKindImport = "import" // 导入表格生成收据
+)
+
+// 任务状态
+const (
+	JobStatusQueued    = "queued"    // 排队等待执行
+	JobStatusRunning   = "running"   // 正在执行
+	JobStatusCompleted = "completed" // 已完成，至少有一项成功
+	JobStatusFailed    = "failed"    // 已完成，全部失败
+	JobStatusCanceled  = "canceled"  // 已取消
+)
+
+// 任务项状态
+const (
+	JobItemPending   = "pending"   // 等待生成
+	JobItemSucceeded = "succeeded" // 生成成功
+	JobItemFailed    = "failed"    // 校验或生成失败
+	JobItemCanceled  = "canceled"  // 任务取消时尚未生成
+)
+
+// Job 异步生成收据的任务
+//
+// 任务及每一项的进度保存在数据库中，服务重启后未完成的任务继续执行。
+type Job struct {
+	ID         string             `json:"id"`                   // 任务编号
+	Kind       string             `json:"kind"`                 // 任务类型：batch 或 import
+	Status     string             `json:"status"`               // 任务状态
+	Output     string             `json:"output"`               // 结果的输出方式：zip 或 pdf
+	Format     string             `json:"format"`               // 收据文件格式
+	Imposition *ImpositionRequest `json:"imposition,omitempty"` // 合并PDF的拼版参数
+
+	Total     int `json:"total"`     // 总项数
+	Processed int `json:"processed"` // 已处理的项数，包括成功和失败
+	Succeeded int `json:"succeeded"` // 成功的项数
+	Failed    int `json:"failed"`    // 失败的项数
+
+	CancelRequested bool       `json:"cancel_requested,omitempty"` // 执行中请求取消，当前一项完成后停止
+	CreatedAt       time.Time  `json:"created_at"`                 // 提交时间
+	StartedAt       *time.Time `json:"started_at,omitempty"`       // 最近一次开始执行的时间
+	FinishedAt      *time.Time `json:"finished_at,omitempty"`      // 完成或取消的时间
+
+	Items []*JobItem `json:"items,omitempty"` // 每一项的结果
+}
+
+// JobItem 任务中的一张收据
+type JobItem struct {
+	BatchItemResult
+
+	Status   string          `json:"status"`            // 任务项状态
+	Attempts int             `json:"attempts"`          // 已生成的次数，重试时增加
+	Request  *ReceiptRequest `json:"request,omitempty"` // 通过校验的收据信息，日期和月份在提交时确定；校验失败的项为空，不会重试
+}
+
+// Finished 任务是否已结束（完成、失败或取消）
+func (j *Job) Finished() bool {
+	switch j.Status {
+	case JobStatusCompleted, JobStatusFailed, JobStatusCanceled:
+		return true
+	}
+	return false
+}
+
+// Tally 按每一项的状态重新统计进度
+func (j *Job) Tally() {
+	j.Total, j.Processed, j.Succeeded, j.Failed = len(j.Items), 0, 0, 0
+	for _, item := range j.Items {
+		switch item.Status {
+		case JobItemSucceeded:
+			j.Succeeded++
+		case JobItemFailed:
+			j.Failed++
+		}
+	}
+	j.Processed = j.Succeeded + j.Failed
+}
+
+// Retally 一个任务项的状态从from变为to时更新进度，不需要读取全部任务项；新增的任务项from为空
+func (j *Job) Retally(from, to string) {
+	count := func(status string, delta int) {
+		switch status {
+		case JobItemSucceeded:
+			j.Succeeded += delta
+		case JobItemFailed:
+			j.Failed += delta
+		}
+	}
+	count(from, -1)
+	count(to, 1)
+	j.Processed = j.Succeeded + j.Failed
+}
+
+// Summary 返回不含任务项的副本，用于任务列表
+func (j *Job) Summary() *Job {
+	summary := *j
+	summary.Items = nil
+	return &summary
+}
+
+// JobQuery 任务查询条件
+type JobQuery struct {
+	Status   string `form:"status" binding:"omitempty,oneof=queued running completed failed canceled"` // 任务状态
+	Page     int    `form:"page" binding:"omitempty,min=1"`                                            // 页码，从1开始
+	PageSize int    `form:"page_size" binding:"omitempty,min=1,max=100"`                               // 每页条数，默认20
+}
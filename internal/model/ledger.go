@@ -0,0 +1,79 @@
+package model
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// 开具记录的事件
+const (
+	LedgerIssue = "issue" // 开具收据，包括重开的新收据
+	LedgerFile  = "file"  // 同一收据再次生成文件
+	LedgerVoid  = "void"  // 作废收据
+)
+
+// LedgerGenesisHash 第一条记录的 prev_hash
+const LedgerGenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// LedgerEntry 收据开具记录中的一条
+//
+// 每条记录包含上一条记录的哈希，修改、删除或调换任意一条都会使之后的哈希链对不上。
+type LedgerEntry struct {
+	Seq          uint64    `json:"seq"`                     // 序号，从1开始连续递增
+	Event        string    `json:"event"`                   // 事件：issue、file 或 void
+	ReceiptID    string    `json:"receipt_id"`              // 收据编号
+	Amount       Money     `json:"amount"`                  // 金额
+	Payer        string    `json:"payer"`                   // 付款人
+	Timestamp    time.Time `json:"timestamp"`               // 记录时间（UTC）
+	DocumentHash string    `json:"document_hash,omitempty"` // 生成文件的SHA-256摘要，作废时为空
+	Detail       string    `json:"detail,omitempty"`        // 作废原因、重开时替代的原收据编号等
+	PrevHash     string    `json:"prev_hash"`               // 上一条记录的哈希
+	Hash         string    `json:"hash"`                    // 本条记录的哈希
+}
+
+// ComputeHash 计算记录的哈希：对除hash以外的各字段按固定顺序编码为JSON数组后取SHA-256
+func (e *LedgerEntry) ComputeHash() string {
+	fields, _ := json.Marshal([]string{
+		strconv.FormatUint(e.Seq, 10),
+		e.Event,
+		e.ReceiptID,
+		e.Amount.String(),
+		e.Payer,
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.DocumentHash,
+		e.Detail,
+		e.PrevHash,
+	})
+	sum := sha256.Sum256(fields)
+	return hex.EncodeToString(sum[:])
+}
+
+// 校验开具记录发现的问题
+const (
+	LedgerGap           = "gap"            // 序号不连续，有记录被删除或插入
+	LedgerBrokenLink    = "broken_link"    // prev_hash与上一条的哈希不符，记录被删除、插入或调换顺序
+	LedgerHashMismatch  = "hash_mismatch"  // 记录内容与哈希不符，记录被修改
+	LedgerRecordMissing = "record_missing" // 已开具的收据登记记录不存在
+	LedgerRecordAltered = "record_altered" // 收据登记记录的金额、付款人或文件摘要与开具记录不符
+	LedgerUnrecorded    = "unrecorded"     // 收据登记记录没有对应的开具记录
+)
+
+// LedgerProblem 校验开具记录发现的一个问题
+type LedgerProblem struct {
+	Seq       uint64 `json:"seq,omitempty"`        // 出现问题的记录序号
+	ReceiptID string `json:"receipt_id,omitempty"` // 相关的收据编号
+	Problem   string `json:"problem"`              // 问题类型
+	Message   string `json:"message"`              // 问题说明
+}
+
+// LedgerReport 开具记录的校验结果
+type LedgerReport struct {
+	CheckedAt time.Time        `json:"checked_at"` // 校验时间
+	Entries   int              `json:"entries"`    // 记录条数
+	Head      string           `json:"head"`       // 最后一条记录的哈希，可另行保存用于比对
+	Valid     bool             `json:"valid"`      // 是否未发现问题
+	Problems  []*LedgerProblem `json:"problems"`   // 发现的问题
+}
@@ -0,0 +1,130 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Money 以分为单位的定点金额，避免浮点误差
+type Money int64
+
+// moneyPattern 金额格式：可选负号、最多15位整数、最多两位小数
+var moneyPattern = regexp.MustCompile(`^(-)?(\d{1,15})(?:\.(\d*))?$`)
+
+// ParseMoney 解析十进制金额字符串，如 "1500"、"1500.5"、"0.29"，超过两位小数返回错误
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	m := moneyPattern.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("金额格式无效: %q", s)
+	}
+
+	decimals := strings.TrimRight(m[3], "0")
+	if len(decimals) > 2 {
+		return 0, fmt.Errorf("金额最多两位小数: %s", s)
+	}
+
+	yuan, _ := strconv.ParseInt(m[2], 10, 64)
+	fen, _ := strconv.ParseInt((decimals + "00")[:2], 10, 64)
+	value := Money(yuan*100 + fen)
+	if m[1] == "-" {
+		value = -value
+	}
+	return value, nil
+}
+
+// Yuan 返回整数元部分（不含符号）
+func (m Money) Yuan() int64 {
+	return m.abs() / 100
+}
+
+// Fen 返回角分部分，范围0-99（不含符号）
+func (m Money) Fen() int64 {
+	return m.abs() % 100
+}
+
+// String 格式化为两位小数，如 "1500.00"
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, m.Yuan(), m.Fen())
+}
+
+// MulQuantity 计算 金额×数量，结果四舍五入到分
+func (m Money) MulQuantity(quantity float64) Money {
+	q := quantityRat(quantity)
+	return roundRat(q.Mul(q, new(big.Rat).SetInt64(int64(m))))
+}
+
+// DivQuantity 计算 金额÷数量，结果四舍五入到分；数量为0时返回0
+func (m Money) DivQuantity(quantity float64) Money {
+	q := quantityRat(quantity)
+	if q.Sign() == 0 {
+		return 0
+	}
+	return roundRat(q.Quo(new(big.Rat).SetInt64(int64(m)), q))
+}
+
+// MarshalJSON 序列化为两位小数的字符串，避免客户端浮点误差
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON 支持JSON数字（1500.5）和字符串（"1500.50"）
+func (m *Money) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+
+	s := string(b)
+	if len(b) > 0 && b[0] == '"' {
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+	}
+
+	value, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = value
+	return nil
+}
+
+func (m Money) abs() int64 {
+	if m < 0 {
+		return -int64(m)
+	}
+	return int64(m)
+}
+
+// quantityRat 使用数量的最短十进制表示构造有理数，保证 100.5 等数量按用户输入精确计算
+func quantityRat(quantity float64) *big.Rat {
+	q, ok := new(big.Rat).SetString(strconv.FormatFloat(quantity, 'f', -1, 64))
+	if !ok {
+		return new(big.Rat)
+	}
+	return q
+}
+
+// roundRat 将以分为单位的有理数四舍五入（远离零）为金额
+func roundRat(r *big.Rat) Money {
+	num, den := r.Num(), r.Denom()
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2)).Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+	return Money(quo.Int64())
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// monthPattern 匹配 2025年9月、2025-09、2025/9、202509 等月份写法
+// 没有分隔符时月份必须为两位，避免把 45901 之类的数字当作年月
+var monthPattern = regexp.MustCompile(`^(\d{4})(?:\s*(?:年|-|/|\.)\s*(\d{1,2})\s*月?|(\d{2}))$`)
+
+// NormalizeMonth 将月份统一为 YYYYMM，如 "2025年9月" -> "202509"，无法识别时返回错误
+func NormalizeMonth(month string) (string, error) {
+	m := monthPattern.FindStringSubmatch(strings.TrimSpace(month))
+	if m == nil {
+		return "", fmt.Errorf("月份格式无效: %q", month)
+	}
+	n, _ := strconv.Atoi(m[2] + m[3])
+	if n < 1 || n > 12 {
+		return "", fmt.Errorf("月份超出范围: %q", month)
+	}
+	return fmt.Sprintf("%s%02d", m[1], n), nil
+}
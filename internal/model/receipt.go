@@ -1,16 +1,80 @@
 package model
 
-import "time"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// 付款方式
+const (
+	PaymentCash     = "cash"     // 现金
+	PaymentTransfer = "transfer" // 转账
+	PaymentCheque   = "cheque"   // 支票
+	PaymentWechat   = "wechat"   // 微信
+	PaymentAlipay   = "alipay"   // 支付宝
+)
+
+// PaymentMethods 全部付款方式，顺序与收据上的勾选框一致
+var PaymentMethods = []string{PaymentCash, PaymentTransfer, PaymentCheque, PaymentWechat, PaymentAlipay}
+
+// PaymentMethodName 返回付款方式的中文名称，未知或为空时返回空字符串
+func PaymentMethodName(method string) string {
+	switch method {
+	case PaymentCash:
+		return "现金"
+	case PaymentTransfer:
+		return "转账"
+	case PaymentCheque:
+		return "支票"
+	case PaymentWechat:
+		return "微信"
+	case PaymentAlipay:
+		return "支付宝"
+	}
+	return ""
+}
+
+// 收据联次
+const (
+	CopyStub       = "stub"       // 存根联，开票方留存
+	CopyCustomer   = "customer"   // 收据联，交付款人
+	CopyAccounting = "accounting" // 记账联，交财务入账
+)
+
+// Copies 全部联次，顺序与传统收据本一致
+var Copies = []string{CopyStub, CopyCustomer, CopyAccounting}
 
 // ReceiptRequest 收据请求模型
 type ReceiptRequest struct {
-	Rent       float64 `json:"rent" binding:"required" example:"1500.00"`    // 租金
-	RoomNumber string  `json:"room_number" binding:"required" example:"101"` // 房间号
-	Recipient  string  `json:"recipient" binding:"required" example:"张三"`    // 收款人
-	Payer      string  `json:"payer" binding:"required" example:"李四"`        // 付款人
-	Date       string  `json:"date" example:"2025-09-21"`                    // 收据日期，如果为空则使用当前日期
-	Month      string  `json:"month" example:"2025年9月"`                      // 租金月份
-	Purpose    string  `json:"purpose" example:"房租"`                         // 收费目的
+	Rent       Money  `json:"rent" binding:"required_without=Items" example:"1500.00"` // 租金，提供收费明细时可省略
+	RoomNumber string `json:"room_number" binding:"required" example:"101"`            // 房间号
+	Recipient  string `json:"recipient" binding:"required" example:"张三"`               // 收款人
+	Payer      string `json:"payer" binding:"required" example:"李四"`                   // 付款人
+	Date       string `json:"date" example:"2025-09-21"`                               // 收据日期，如果为空则使用当前日期
+	Month      string `json:"month" example:"2025年9月"`                                 // 租金月份
+	Purpose    string `json:"purpose" example:"房租"`                                    // 收费目的
+	Renderer   string `json:"renderer" example:"gopdf"`                                // 渲染后端：gopdf 或 acroform，为空则使用默认
+	Template   string `json:"template" example:"deposit"`                              // 模板名称，为空则使用默认模板
+
+	PaymentMethod    string `json:"payment_method" binding:"omitempty,oneof=cash transfer cheque wechat alipay" example:"transfer"` // 付款方式，在收据上勾选
+	PaymentReference string `json:"payment_reference" binding:"max=64" example:"20250921000123"`                                    // 付款凭证号，如转账流水号、支票号
+
+	Landlord string `json:"landlord" binding:"max=64" example:"幸福物业"` // 出租方（房东或物业公司），用于选择收据上加盖的公章
+
+	Items []ReceiptItem `json:"items" binding:"omitempty,dive"` // 收费明细，合计金额由服务端计算
+	Total *Money        `json:"total" example:"1680.00"`        // 客户端计算的合计金额，提供时须与服务端计算结果一致
+
+	Copies []string `json:"copies" binding:"omitempty,max=3,unique,dive,oneof=stub customer accounting" example:"stub,customer,accounting"` // 联次，每联一页、共用同一编号，为空时只生成单联
+}
+
+// ReceiptItem 收费明细项
+type ReceiptItem struct {
+	Description string  `json:"description" binding:"required" example:"水费"` // 收费项目
+	Quantity    float64 `json:"quantity" binding:"gte=0" example:"12"`       // 数量，为空时按1计
+	UnitPrice   Money   `json:"unit_price" example:"5.00"`                   // 单价
+	Amount      Money   `json:"amount" example:"60.00"`                      // 金额，为空时按 数量×单价 计算
 }
 
 // ReceiptResponse 收据响应模型
@@ -23,14 +87,194 @@ type ReceiptResponse struct {
 
 // ReceiptData PDF 填充数据
 type ReceiptData struct {
-	ID         string    `json:"id"`          // 收据编号，格式：NO+房间号+月份
-	Rent       string    `json:"rent"`        // 租金金额
-	RentZh     string    `json:"rent_zh"`     // 租金中文大写金额
-	RoomNumber string    `json:"room_number"` // 房间号
-	Recipient  string    `json:"recipient"`   // 收款人
-	Payer      string    `json:"payer"`       // 付款人
-	Date       string    `json:"date"`        // 收据日期
-	Month      string    `json:"month"`       // 租金月份
-	Purpose    string    `json:"purpose"`     // 收费目的
-	CreatedAt  time.Time `json:"created_at"`  // 创建时间
+	ID         string `json:"id"`          // 收据编号，由编号格式生成，如 NO101202509-001
+	Rent       Money  `json:"rent"`        // 租金金额
+	RentZh     string `json:"rent_zh"`     // 租金中文大写金额
+	RoomNumber string `json:"room_number"` // 房间号
+	Recipient  string `json:"recipient"`   // 收款人
+	Payer      string `json:"payer"`       // 付款人
+	Date       string `json:"date"`        // 收据日期
+	Month      string `json:"month"`       // 租金月份
+	Purpose    string `json:"purpose"`     // 收费目的
+	Renderer   string `json:"renderer"`    // 渲染后端
+	Template   string `json:"template"`    // 模板名称
+
+	PaymentMethod    string `json:"payment_method,omitempty"`    // 付款方式
+	PaymentReference string `json:"payment_reference,omitempty"` // 付款凭证号
+
+	Landlord string `json:"landlord,omitempty"` // 出租方
+
+	Items     []ReceiptItemData `json:"items,omitempty"`  // 收费明细
+	Copies    []string          `json:"copies,omitempty"` // 联次，按顺序每联一页
+	CreatedAt time.Time         `json:"created_at"`       // 创建时间
+}
+
+// ReceiptItemData 收费明细渲染数据
+type ReceiptItemData struct {
+	Description string `json:"description"` // 收费项目
+	Quantity    string `json:"quantity"`    // 数量
+	UnitPrice   Money  `json:"unit_price"`  // 单价
+	Amount      Money  `json:"amount"`      // 金额
+}
+
+// 收据状态
+const (
+	ReceiptStatusIssued = "issued" // 已开具
+	ReceiptStatusVoided = "voided" // 已作废
+)
+
+// ReceiptRecord 收据登记记录，保存收据数据及每次生成的文件信息
+type ReceiptRecord struct {
+	ReceiptData
+	Files []ReceiptFile `json:"files"` // 生成的文件，按生成时间排列
+
+	Status     string     `json:"status"`                // 收据状态：issued 或 voided
+	VoidedAt   *time.Time `json:"voided_at,omitempty"`   // 作废时间
+	VoidReason string     `json:"void_reason,omitempty"` // 作废原因
+	ReplacedBy string     `json:"replaced_by,omitempty"` // 重开后的新收据编号
+	Replaces   string     `json:"replaces,omitempty"`    // 本收据替代的原收据编号
+}
+
+// Voided 收据是否已作废
+func (r *ReceiptRecord) Voided() bool {
+	return r.Status == ReceiptStatusVoided
+}
+
+// VoidRequest 作废收据请求
+type VoidRequest struct {
+	Reason string `json:"reason" binding:"required,max=200"` // 作废原因
+}
+
+// ReissueRequest 重开收据请求
+//
+// Receipt为空时按原收据数据重开；原收据尚未作废时会一并作废，此时必须填写Reason。
+type ReissueRequest struct {
+	Reason  string          `json:"reason" binding:"max=200"` // 作废原收据的原因
+	Receipt *ReceiptRequest `json:"receipt"`                  // 更正后的收据信息
+}
+
+// 批量生成的输出方式
+const (
+	BatchOutputZip = "zip" // 每张收据一个文件，打包为ZIP
+	BatchOutputPDF = "pdf" // 合并为一个多页PDF
+)
+
+// BatchReceiptRequest 批量生成收据请求
+//
+// Receipts中的每一项按ReceiptRequest逐项解析和校验，单项错误只记入该项结果，不影响其他收据；
+// 单次最多500张。
+type BatchReceiptRequest struct {
+	Receipts []json.RawMessage `json:"receipts" binding:"required,min=1,max=500" swaggertype:"array,object"` // 收据信息，格式同ReceiptRequest
+	Output   string            `json:"output" binding:"omitempty,oneof=zip pdf" example:"zip"`               // 输出方式：zip（默认）或 pdf（合并PDF）
+	Format   string            `json:"format" binding:"omitempty,oneof=pdf png jpeg" example:"pdf"`          // ZIP中的文件格式，默认pdf；合并PDF时只能为pdf
+
+	Imposition *ImpositionRequest `json:"imposition"` // 拼版打印参数，只用于合并PDF
+
+	Async bool `json:"async" example:"false"` // 提交为异步任务，立即返回任务编号
+}
+
+// ImportRequest 导入表格生成收据的参数，表格文件以multipart表单的file字段上传
+//
+// 表格每行一张收据，按表头映射转换为ReceiptRequest后逐行校验，输出方式与批量生成相同。
+type ImportRequest struct {
+	Output    string `form:"output" binding:"omitempty,oneof=zip pdf" example:"zip"`      // 输出方式：zip（默认）或 pdf（合并PDF）
+	Format    string `form:"format" binding:"omitempty,oneof=pdf png jpeg" example:"pdf"` // ZIP中的文件格式，默认pdf；合并PDF时只能为pdf
+	Worksheet string `form:"worksheet" example:"9月"`                                      // XLSX工作表名称，默认第一个工作表
+	Mapping   string `form:"mapping" example:"{\"户号\":\"room_number\"}"`                  // 表头映射（JSON），叠加在服务端配置的映射之上
+	DryRun    bool   `form:"dry_run" example:"false"`                                     // 只校验表格，不生成收据
+	Async     bool   `form:"async" example:"false"`                                       // 提交为异步任务，立即返回任务编号
+
+	ImpositionRequest // 拼版打印参数，只用于合并PDF
+}
+
+// ImpositionRequest 拼版打印参数：将收据按原尺寸排列在A4/A5纸上，Sheet为空时不拼版
+type ImpositionRequest struct {
+	Sheet     string   `json:"sheet" form:"sheet" binding:"omitempty,oneof=A4 A5" example:"A4"`   // 纸张
+	Up        int      `json:"up" form:"up" binding:"omitempty,min=1,max=20" example:"3"`         // 每张纸的收据数，默认按纸张尺寸尽量多放
+	Gutter    *float64 `json:"gutter" form:"gutter" binding:"omitempty,min=0,max=50" example:"5"` // 收据之间的间距（mm），默认5
+	CropMarks bool     `json:"crop_marks" form:"crop_marks" example:"true"`                       // 在纸张边距中绘制裁切线
+}
+
+// BatchItemResult 批量生成中单张收据的结果
+type BatchItemResult struct {
+	Index      int    `json:"index"`                 // 在请求中的序号，从0开始
+	Row        int    `json:"row,omitempty"`         // 导入表格时在表格中的行号，从1开始
+	Success    bool   `json:"success"`               // 是否生成成功
+	ReceiptID  string `json:"receipt_id,omitempty"`  // 收据编号
+	RoomNumber string `json:"room_number,omitempty"` // 房间号
+	FileName   string `json:"file_name,omitempty"`   // ZIP中的文件名
+	Page       int    `json:"page,omitempty"`        // 在合并PDF中的起始页码，从1开始；拼版时为第一联所在纸张的页码
+	Message    string `json:"message,omitempty"`     // 失败原因
+}
+
+// ReceiptFile 收据文件信息
+type ReceiptFile struct {
+	Format    string    `json:"format"`              // 文件格式：pdf 或 png
+	FileName  string    `json:"file_name,omitempty"` // 备份文件名，未备份时为空
+	FileSize  int64     `json:"file_size"`           // 文件大小
+	SHA256    string    `json:"sha256"`              // 文件内容的SHA-256摘要
+	CreatedAt time.Time `json:"created_at"`          // 生成时间
+}
+
+// NewReceiptFile 按生成的文件内容创建文件信息，fileName为备份文件名，未备份时为空
+func NewReceiptFile(format, fileName string, content []byte) ReceiptFile {
+	sum := sha256.Sum256(content)
+	return ReceiptFile{
+		Format:    format,
+		FileName:  fileName,
+		FileSize:  int64(len(content)),
+		SHA256:    hex.EncodeToString(sum[:]),
+		CreatedAt: time.Now(),
+	}
+}
+
+// ReceiptQuery 收据查询条件，均为可选
+type ReceiptQuery struct {
+	RoomNumber string `form:"room_number"`                                                          // 房间号，精确匹配
+	Payer      string `form:"payer"`                                                                // 付款人，包含匹配
+	Recipient  string `form:"recipient"`                                                            // 收款人，包含匹配
+	Status     string `form:"status" binding:"omitempty,oneof=issued voided"`                       // 收据状态
+	Month      string `form:"month"`                                                                // 租金月份，如 2025年9月、2025-09
+	DateFrom   string `form:"date_from"`                                                            // 收据日期下限（含），写法同收据日期
+	DateTo     string `form:"date_to"`                                                              // 收据日期上限（含），写法同收据日期
+	MinAmount  string `form:"min_amount"`                                                           // 金额下限（含）
+	MaxAmount  string `form:"max_amount"`                                                           // 金额上限（含）
+	Sort       string `form:"sort" binding:"omitempty,oneof=created_at date amount id room_number"` // 排序字段，默认 created_at
+	Order      string `form:"order" binding:"omitempty,oneof=asc desc"`                             // 排序方向，默认 desc
+	Page       int    `form:"page" binding:"omitempty,min=1"`                                       // 页码，从1开始
+	PageSize   int    `form:"page_size" binding:"omitempty,min=1,max=100"`                          // 每页条数，默认20
+}
+
+// DateRange 将日期范围统一为 YYYY-MM-DD，未指定的一端为空
+func (q *ReceiptQuery) DateRange() (from, to string, err error) {
+	if q.DateFrom != "" {
+		if from, err = NormalizeDate(q.DateFrom); err != nil {
+			return "", "", err
+		}
+	}
+	if q.DateTo != "" {
+		if to, err = NormalizeDate(q.DateTo); err != nil {
+			return "", "", err
+		}
+	}
+	return from, to, nil
+}
+
+// AmountRange 解析金额范围，未指定的一端为nil
+func (q *ReceiptQuery) AmountRange() (lower, upper *Money, err error) {
+	if q.MinAmount != "" {
+		v, err := ParseMoney(q.MinAmount)
+		if err != nil {
+			return nil, nil, err
+		}
+		lower = &v
+	}
+	if q.MaxAmount != "" {
+		v, err := ParseMoney(q.MaxAmount)
+		if err != nil {
+			return nil, nil, err
+		}
+		upper = &v
+	}
+	return lower, upper, nil
 }
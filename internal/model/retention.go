@@ -0,0 +1,53 @@
+package model
+
+import "time"
+
+// 备份保留的处理方式
+const (
+	RetentionDelete  = "delete"  // 删除
+	RetentionArchive = "archive" // 归档到月度压缩包后删除原文件
+)
+
+// 备份保留的处理原因
+const (
+	RetentionExpired    = "expired"    // 超过保留年限
+	RetentionSuperseded = "superseded" // 同一收据编号有更新的备份
+	RetentionArchived   = "archived"   // 超过归档期限
+)
+
+// RetentionPolicy 收据备份的保留策略，各项为零值时不启用
+type RetentionPolicy struct {
+	KeepYears     int  `json:"keep_years"`     // 保留年限，超过的备份（包括月度压缩包）被删除
+	KeepLatest    bool `json:"keep_latest"`    // 每个收据编号只保留最新的一份备份
+	ArchiveMonths int  `json:"archive_months"` // 生成月份早于当月N个月的备份归档到 archive/yyyy-mm.zip
+}
+
+// Enabled 是否启用了任意一项保留规则
+func (p RetentionPolicy) Enabled() bool {
+	return p.KeepYears > 0 || p.KeepLatest || p.ArchiveMonths > 0
+}
+
+// RetentionAction 保留策略对一个备份文件的处理
+type RetentionAction struct {
+	Key       string    `json:"key"`              // 备份文件
+	Action    string    `json:"action"`           // 处理方式：delete 或 archive
+	Reason    string    `json:"reason"`           // 处理原因：expired、superseded 或 archived
+	ReceiptID string    `json:"receipt_id"`       // 收据编号，月度压缩包为空
+	IssuedAt  time.Time `json:"issued_at"`        // 生成时间，月度压缩包为所属月份
+	Size      int64     `json:"size"`             // 文件大小
+	Bundle    string    `json:"bundle,omitempty"` // 归档的目标压缩包
+}
+
+// RetentionReport 一次执行或预演保留策略的结果
+type RetentionReport struct {
+	Policy    RetentionPolicy    `json:"policy"`           // 使用的保留策略
+	DryRun    bool               `json:"dry_run"`          // 是否只是预演，未实际删除或归档
+	CheckedAt time.Time          `json:"checked_at"`       // 检查时间
+	Scanned   int                `json:"scanned"`          // 检查的文件数，包括月度压缩包
+	Kept      int                `json:"kept"`             // 保留的文件数
+	Deleted   int                `json:"deleted"`          // 删除的文件数
+	Archived  int                `json:"archived"`         // 归档的文件数
+	FreedSize int64              `json:"freed_size"`       // 删除和归档的文件总大小
+	Actions   []*RetentionAction `json:"actions"`          // 每个被删除或归档的文件
+	Errors    []string           `json:"errors,omitempty"` // 执行中的错误，出错的文件保留
+}
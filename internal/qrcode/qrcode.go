@@ -0,0 +1,489 @@
+// Package qrcode 实现QR码编码（ISO/IEC 18004），用于在收据上打印校验地址
+//
+// 只支持字节模式和M级纠错（约15%），版本1-10，最多可编码213字节，足以容纳收据校验地址。
+package qrcode
+
+import (
+	"errors"
+	"image"
+	"image/color"
+)
+
+// ErrTooLong 数据超过版本10、M级纠错的容量
+var ErrTooLong = errors.New("二维码数据过长")
+
+// maxVersion 支持的最高版本
+const maxVersion = 10
+
+// blockLayout 单个版本在M级纠错下的分块方式
+type blockLayout struct {
+	ecPerBlock int      // 每块纠错码字数
+	groups     [][2]int // 每组的块数和每块数据码字数
+}
+
+// versionBlocks 版本1-10在M级纠错下的分块方式，下标为版本号
+var versionBlocks = [maxVersion + 1]blockLayout{
+	1:  {10, [][2]int{{1, 16}}},
+	2:  {16, [][2]int{{1, 28}}},
+	3:  {26, [][2]int{{1, 44}}},
+	4:  {18, [][2]int{{2, 32}}},
+	5:  {24, [][2]int{{2, 43}}},
+	6:  {16, [][2]int{{4, 27}}},
+	7:  {18, [][2]int{{4, 31}}},
+	8:  {22, [][2]int{{2, 38}, {2, 39}}},
+	9:  {22, [][2]int{{3, 36}, {2, 37}}},
+	10: {26, [][2]int{{4, 43}, {1, 44}}},
+}
+
+// alignmentPositions 版本2-10校正图形的中心坐标
+var alignmentPositions = [maxVersion + 1][]int{
+	2:  {6, 18},
+	3:  {6, 22},
+	4:  {6, 26},
+	5:  {6, 30},
+	6:  {6, 34},
+	7:  {6, 22, 38},
+	8:  {6, 24, 42},
+	9:  {6, 26, 46},
+	10: {6, 28, 50},
+}
+
+// dataCodewords 返回版本的数据码字总数
+func (b blockLayout) dataCodewords() int {
+	n := 0
+	for _, g := range b.groups {
+		n += g[0] * g[1]
+	}
+	return n
+}
+
+// Code 编码后的QR码符号，不含四周的空白区
+type Code struct {
+	Version int
+	Size    int // 每边的模块数，17+4×版本
+
+	modules    [][]bool // [y][x]，true为深色
+	isFunction [][]bool // 定位、校正、格式等功能图形，不参与数据填充和掩模
+}
+
+// Encode 将数据编码为QR码，自动选择能容纳数据的最低版本和惩罚分最低的掩模
+func Encode(data []byte) (*Code, error) {
+	version := 0
+	for v := 1; v <= maxVersion; v++ {
+		if capacityBits(v) >= dataBits(v, len(data)) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	c := newCode(version)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addErrorCorrection(c.encodeData(data)))
+
+	bestMask, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		c.applyMask(mask)
+		c.drawFormatBits(mask)
+		if p := c.penalty(); bestPenalty < 0 || p < bestPenalty {
+			bestMask, bestPenalty = mask, p
+		}
+		c.applyMask(mask) // 异或两次即撤销
+	}
+	c.applyMask(bestMask)
+	c.drawFormatBits(bestMask)
+
+	return c, nil
+}
+
+// Dark 返回第y行第x列的模块是否为深色
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Image 生成黑白图片，每个模块为moduleSize像素，四周保留quiet个模块的空白
+func (c *Code) Image(moduleSize, quiet int) *image.Gray {
+	size := (c.Size + quiet*2) * moduleSize
+	img := image.NewGray(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < moduleSize; dy++ {
+				for dx := 0; dx < moduleSize; dx++ {
+					img.SetGray((x+quiet)*moduleSize+dx, (y+quiet)*moduleSize+dy, color.Gray{})
+				}
+			}
+		}
+	}
+	return img
+}
+
+// capacityBits 返回版本可容纳的数据位数
+func capacityBits(version int) int {
+	return versionBlocks[version].dataCodewords() * 8
+}
+
+// dataBits 返回字节模式下编码n字节所需的位数：模式指示符 + 字符计数 + 数据
+func dataBits(version, n int) int {
+	return 4 + countBits(version) + n*8
+}
+
+// countBits 返回字节模式字符计数指示符的位数
+func countBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+func newCode(version int) *Code {
+	size := 17 + version*4
+	c := &Code{Version: version, Size: size}
+	c.modules = make([][]bool, size)
+	c.isFunction = make([][]bool, size)
+	for i := range c.modules {
+		c.modules[i] = make([]bool, size)
+		c.isFunction[i] = make([]bool, size)
+	}
+	return c
+}
+
+// encodeData 生成数据码字：模式指示符、字符计数、数据、终止符和填充
+func (c *Code) encodeData(data []byte) []byte {
+	var bits bitBuffer
+	bits.append(0x4, 4) // 字节模式
+	bits.append(uint32(len(data)), countBits(c.Version))
+	for _, b := range data {
+		bits.append(uint32(b), 8)
+	}
+
+	capacity := capacityBits(c.Version)
+	terminator := capacity - len(bits)
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := uint32(0xEC); len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	return bits.bytes()
+}
+
+// addErrorCorrection 按分块方式计算纠错码字，并交织数据码字和纠错码字
+func (c *Code) addErrorCorrection(data []byte) []byte {
+	layout := versionBlocks[c.Version]
+	divisor := rsDivisor(layout.ecPerBlock)
+
+	var blocks, ecBlocks [][]byte
+	offset := 0
+	for _, g := range layout.groups {
+		for i := 0; i < g[0]; i++ {
+			block := data[offset : offset+g[1]]
+			offset += g[1]
+			blocks = append(blocks, block)
+			ecBlocks = append(ecBlocks, rsRemainder(block, divisor))
+		}
+	}
+
+	result := make([]byte, 0, len(data)+len(blocks)*layout.ecPerBlock)
+	maxLen := len(blocks[len(blocks)-1]) // 第二组的块比第一组多一个码字
+	for i := 0; i < maxLen; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < layout.ecPerBlock; i++ {
+		for _, ec := range ecBlocks {
+			result = append(result, ec[i])
+		}
+	}
+	return result
+}
+
+// drawFunctionPatterns 绘制定位图形、分隔符、定时图形、校正图形、暗模块，并预留格式和版本信息区域
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	positions := alignmentPositions[c.Version]
+	n := len(positions)
+	for i, y := range positions {
+		for j, x := range positions {
+			// 与定位图形重叠的位置不绘制
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			c.drawAlignment(x, y)
+		}
+	}
+
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder 以(x, y)为中心绘制定位图形及其分隔符
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawAlignment 以(x, y)为中心绘制校正图形
+func (c *Code) drawAlignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// drawFormatBits 绘制两份格式信息：M级纠错和掩模编号，BCH(15,5)编码
+func (c *Code) drawFormatBits(mask int) {
+	data := uint32(0)<<3 | uint32(mask) // M级纠错的格式位为00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true) // 暗模块
+}
+
+// drawVersion 版本7及以上绘制两份版本信息，BCH(18,6)编码
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+
+	rem := uint32(c.Version)
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := uint32(c.Version)<<12 | rem
+
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords 按之字形从右下角开始两列一组填充数据位，跳过功能图形和第6列的定时图形
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunction[y][x] {
+					continue
+				}
+				// 剩余位填0
+				if i < len(codewords)*8 {
+					c.modules[y][x] = codewords[i>>3]>>(7-uint(i&7))&1 == 1
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask 对数据区域应用掩模，再次调用可撤销
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty 按标准的四条规则计算惩罚分，用于选择掩模
+func (c *Code) penalty() int {
+	result := 0
+	get := func(x, y int, vertical bool) bool {
+		if vertical {
+			return c.modules[x][y]
+		}
+		return c.modules[y][x]
+	}
+
+	for _, vertical := range []bool{false, true} {
+		for y := 0; y < c.Size; y++ {
+			// 规则1：同色连续5个及以上的模块
+			run := 1
+			for x := 1; x < c.Size; x++ {
+				if get(x, y, vertical) == get(x-1, y, vertical) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					result += run - 2
+				}
+				run = 1
+			}
+			if run >= 5 {
+				result += run - 2
+			}
+
+			// 规则3：类似定位图形的 1:1:3:1:1 图案，一侧有4个浅色模块
+			for x := 0; x+11 <= c.Size; x++ {
+				if matchFinderLike(func(i int) bool { return get(x+i, y, vertical) }) {
+					result += 40
+				}
+			}
+		}
+	}
+
+	// 规则2：2×2同色块
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			v := c.modules[y][x]
+			if v == c.modules[y][x+1] && v == c.modules[y+1][x] && v == c.modules[y+1][x+1] {
+				result += 3
+			}
+		}
+	}
+
+	// 规则4：深色模块比例偏离50%
+	dark := 0
+	for _, row := range c.modules {
+		for _, v := range row {
+			if v {
+				dark++
+			}
+		}
+	}
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	result += k * 10
+
+	return result
+}
+
+// matchFinderLike 判断连续11个模块是否为 10111010000 或 00001011101
+func matchFinderLike(get func(i int) bool) bool {
+	patterns := [2][11]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, p := range patterns {
+		match := true
+		for i, v := range p {
+			if get(i) != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// bitBuffer 按位追加的缓冲区
+type bitBuffer []bool
+
+func (b *bitBuffer) append(value uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, value>>uint(i)&1 == 1)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, (len(b)+7)/8)
+	for i, v := range b {
+		if v {
+			result[i>>3] |= 1 << (7 - uint(i&7))
+		}
+	}
+	return result
+}
+
+func bit(x uint32, i int) bool {
+	return x>>uint(i)&1 == 1
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,419 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"receipt/internal/model"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdffont "github.com/pdfcpu/pdfcpu/pkg/font"
+	cjkfont "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/form"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// formFontID 表单默认资源中中文字体的资源名
+const formFontID = "CJKFont"
+
+// AcroFormRenderer 使用pdfcpu将收据数据填充到用户提供的AcroForm模板
+//
+// 模板中的文本域按名称与 model.ReceiptData 的JSON字段对应（id、rent、rent_zh、
+// room_number、recipient、payer、date、month、purpose、payment_method_zh、
+// payment_reference），缺失的字段会被忽略。付款方式勾选框按 payment_<方式> 命名，
+// 如 payment_cash、payment_transfer。
+type AcroFormRenderer struct {
+	templatePath string
+	fontPath     string
+
+	// Flatten 为true时将字段的值以中文字体绘制到页面内容中，并删除表单域和表单，
+	// 生成的收据不能再被编辑；为false时保留可编辑的表单
+	Flatten bool
+}
+
+// NewAcroFormRenderer 创建AcroForm渲染后端，fontPath为需要嵌入的中文字体
+func NewAcroFormRenderer(templatePath, fontPath string) (*AcroFormRenderer, error) {
+	if _, err := os.Stat(templatePath); err != nil {
+		return nil, fmt.Errorf("读取PDF模板失败: %v", err)
+	}
+
+	return &AcroFormRenderer{
+		templatePath: templatePath,
+		fontPath:     fontPath,
+		Flatten:      true,
+	}, nil
+}
+
+func (r *AcroFormRenderer) Name() string {
+	return RendererAcroForm
+}
+
+// Render 填充模板并将结果写入w
+func (r *AcroFormRenderer) Render(w io.Writer, data *model.ReceiptData) error {
+	// 未指定字体时使用PDF标准字体，只能显示西文
+	fontName := "Helvetica"
+	if r.fontPath != "" {
+		name, err := installPDFFont(r.fontPath)
+		if err != nil {
+			return err
+		}
+		fontName = name
+	}
+
+	template, err := os.Open(r.templatePath)
+	if err != nil {
+		return fmt.Errorf("打开PDF模板失败: %v", err)
+	}
+	defer template.Close()
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+	conf.Cmd = pdfmodel.FILLFORMFIELDS
+
+	ctx, err := api.ReadValidateAndOptimize(template, conf)
+	if err != nil {
+		return fmt.Errorf("读取PDF模板失败: %v", err)
+	}
+
+	if r.Flatten {
+		return r.flatten(ctx, w, fontName, data, conf)
+	}
+	return r.fill(ctx, w, fontName, data)
+}
+
+// fill 填充表单域，字段外观使用中文字体，生成的PDF仍可编辑
+func (r *AcroFormRenderer) fill(ctx *pdfmodel.Context, w io.Writer, fontName string, data *model.ReceiptData) error {
+	if r.fontPath != "" {
+		if err := setFormFont(ctx, fontName); err != nil {
+			return fmt.Errorf("设置表单字体失败: %v", err)
+		}
+	}
+
+	f := r.formGroup(data).Forms[0]
+	ok, _, err := form.FillForm(ctx, form.FillDetails(&f, nil), nil, form.JSON)
+	if err != nil {
+		return fmt.Errorf("填充PDF表单失败: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("填充PDF表单失败: 模板中没有可填充的字段")
+	}
+
+	if err := api.WriteContext(ctx, w); err != nil {
+		return fmt.Errorf("填充PDF表单失败: %v", err)
+	}
+	return nil
+}
+
+// flatten 删除表单域和表单，按各字段的位置将值绘制到页面内容中
+func (r *AcroFormRenderer) flatten(ctx *pdfmodel.Context, w io.Writer, fontName string, data *model.ReceiptData, conf *pdfmodel.Configuration) error {
+	widgets, err := removeFormWidgets(ctx)
+	if err != nil {
+		return fmt.Errorf("读取PDF表单失败: %v", err)
+	}
+
+	var stripped bytes.Buffer
+	if err := api.WriteContext(ctx, &stripped); err != nil {
+		return fmt.Errorf("生成收据PDF失败: %v", err)
+	}
+
+	values := layoutFields(data)
+	stamps := map[int][]*pdfmodel.Watermark{}
+	for _, widget := range widgets {
+		text := ""
+		switch widget.kind {
+		case "Tx":
+			text = values[widget.name]
+		case "Btn":
+			if method, ok := strings.CutPrefix(widget.name, "payment_"); ok && method == data.PaymentMethod {
+				text = "√"
+			}
+		}
+		if text == "" {
+			continue
+		}
+		wm, err := widget.watermark(text, fontName)
+		if err != nil {
+			return fmt.Errorf("绘制字段%s失败: %v", widget.name, err)
+		}
+		stamps[widget.page] = append(stamps[widget.page], wm)
+	}
+	if len(stamps) == 0 {
+		_, err := w.Write(stripped.Bytes())
+		return err
+	}
+
+	if err := api.AddWatermarksSliceMap(bytes.NewReader(stripped.Bytes()), w, stamps, conf); err != nil {
+		return fmt.Errorf("绘制字段失败: %v", err)
+	}
+	return nil
+}
+
+// formGroup 将收据数据转换为pdfcpu表单数据
+func (r *AcroFormRenderer) formGroup(data *model.ReceiptData) *form.FormGroup {
+	var fields []*form.TextField
+	for name, value := range layoutFields(data) {
+		fields = append(fields, &form.TextField{
+			Name:  name,
+			Value: value,
+		})
+	}
+
+	var checkBoxes []*form.CheckBox
+	for _, method := range model.PaymentMethods {
+		checkBoxes = append(checkBoxes, &form.CheckBox{
+			Name:  "payment_" + method,
+			Value: data.PaymentMethod == method,
+		})
+	}
+
+	return &form.FormGroup{
+		Forms: []form.Form{{TextFields: fields, CheckBoxes: checkBoxes}},
+	}
+}
+
+// formWidget 表单域在页面上的一个组件
+type formWidget struct {
+	page  int
+	name  string // 完整的字段名称
+	kind  string // 字段类型：Tx 文本域、Btn 按钮（勾选框）
+	rect  *types.Rectangle
+	size  float64 // DA中的字号，0为自动
+	align int     // 对齐方式：0 左对齐、1 居中、2 右对齐
+}
+
+// watermark 创建在组件位置绘制text的文字印记，字号为0时按组件高度计算，过长时缩小到组件宽度内
+func (wd *formWidget) watermark(text, fontName string) (*pdfmodel.Watermark, error) {
+	const padding = 2.0
+	width, height := wd.rect.Width()-2*padding, wd.rect.Height()
+
+	size := wd.size
+	if size <= 0 {
+		size = math.Min(12, height*0.7)
+	}
+	points := max(int(size), 4)
+	for points > 4 && pdffont.TextWidth(text, fontName, points) > width {
+		points--
+	}
+
+	// 勾选框中的勾号居中
+	align := wd.align
+	if wd.kind == "Btn" {
+		align = 1
+	}
+	x := wd.rect.LL.X + padding
+	switch textWidth := pdffont.TextWidth(text, fontName, points); align {
+	case 1:
+		x = wd.rect.LL.X + (wd.rect.Width()-textWidth)/2
+	case 2:
+		x = wd.rect.UR.X - padding - textWidth
+	}
+	y := wd.rect.LL.Y + (height-float64(points))/2
+
+	desc := fmt.Sprintf("fontname:%s, points:%d, rot:0, pos:bl, offset:%.2f %.2f, scale:1 abs, align:l, fillcolor:#000000, opacity:1",
+		fontName, points, x, y)
+	return api.TextWatermark(text, desc, true, false, types.POINTS)
+}
+
+// removeFormWidgets 从页面注释中删除全部表单组件并删除文档表单，返回删除的组件
+func removeFormWidgets(ctx *pdfmodel.Context) ([]*formWidget, error) {
+	var widgets []*formWidget
+	for page := 1; page <= ctx.PageCount; page++ {
+		pageDict, _, inherited, err := ctx.PageDict(page, false)
+		if err != nil {
+			return nil, err
+		}
+		// 文字印记的位置相对于裁剪框的左下角
+		origin := inherited.MediaBox
+		if inherited.CropBox != nil {
+			origin = inherited.CropBox
+		}
+		annots, err := ctx.DereferenceArray(pageDict["Annots"])
+		if err != nil {
+			return nil, err
+		}
+
+		var kept types.Array
+		for _, o := range annots {
+			d, err := ctx.DereferenceDict(o)
+			if err != nil {
+				return nil, err
+			}
+			if d == nil || d.Subtype() == nil || *d.Subtype() != "Widget" {
+				kept = append(kept, o)
+				continue
+			}
+			widget, err := readFormWidget(ctx, d)
+			if err != nil {
+				return nil, err
+			}
+			widget.page = page
+			if origin != nil {
+				widget.rect.Translate(-origin.LL.X, -origin.LL.Y)
+			}
+			widgets = append(widgets, widget)
+		}
+
+		if len(kept) == 0 {
+			delete(pageDict, "Annots")
+		} else {
+			pageDict["Annots"] = kept
+		}
+	}
+
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	delete(catalog, "AcroForm")
+	ctx.Form = nil
+	return widgets, nil
+}
+
+// readFormWidget 读取组件的字段名称、类型、位置和字号，字段属性可继承自上级字段和文档表单
+func readFormWidget(ctx *pdfmodel.Context, d types.Dict) (*formWidget, error) {
+	rect, err := ctx.RectForArray(d.ArrayEntry("Rect"))
+	if err != nil {
+		return nil, err
+	}
+	widget := &formWidget{rect: rect}
+
+	var names []string
+	da, ft, q := "", "", -1
+	for field := d; field != nil; {
+		if _, ok := field["T"]; ok {
+			name, err := types.StringOrHexLiteral(field["T"])
+			if err != nil {
+				return nil, err
+			}
+			names = append([]string{*name}, names...)
+		}
+		if s := field.StringEntry("DA"); s != nil && da == "" {
+			da = *s
+		}
+		if n := field.NameEntry("FT"); n != nil && ft == "" {
+			ft = *n
+		}
+		if i := field.IntEntry("Q"); i != nil && q < 0 {
+			q = *i
+		}
+		if field, err = ctx.DereferenceDict(field["Parent"]); err != nil {
+			return nil, err
+		}
+	}
+	if da == "" && ctx.Form != nil {
+		if s := ctx.Form.StringEntry("DA"); s != nil {
+			da = *s
+		}
+	}
+	if q < 0 && ctx.Form != nil {
+		if i := ctx.Form.IntEntry("Q"); i != nil {
+			q = *i
+		}
+	}
+
+	widget.name = strings.Join(names, ".")
+	widget.kind = ft
+	widget.size = fontSizeFromDA(da)
+	widget.align = max(q, 0)
+	return widget, nil
+}
+
+// fontSizeFromDA 读取DA中 Tf 操作的字号，没有时返回0
+func fontSizeFromDA(da string) float64 {
+	parts := strings.Fields(da)
+	for i, part := range parts {
+		if part == "Tf" && i >= 1 {
+			size, err := strconv.ParseFloat(parts[i-1], 64)
+			if err == nil {
+				return size
+			}
+		}
+	}
+	return 0
+}
+
+// setFormFont 将中文字体加入表单的默认资源，并让全部文本域的DA使用该字体，
+// 填充时生成的外观和阅读器重新生成的外观都使用中文字体
+//
+// pdfcpu不嵌入表单使用的中文字体（Adobe-GB1字符集），由阅读器使用系统中的中文字体显示。
+func setFormFont(ctx *pdfmodel.Context, fontName string) error {
+	if ctx.Form == nil {
+		return fmt.Errorf("模板中没有表单")
+	}
+
+	fontRef, err := cjkfont.EnsureFontDict(ctx.XRefTable, fontName, "zh", "HANS", false, nil)
+	if err != nil {
+		return err
+	}
+
+	dr, err := ctx.DereferenceDict(ctx.Form["DR"])
+	if err != nil {
+		return err
+	}
+	if dr == nil {
+		dr = types.Dict{}
+		ctx.Form["DR"] = dr
+	}
+	fonts, err := ctx.DereferenceDict(dr["Font"])
+	if err != nil {
+		return err
+	}
+	if fonts == nil {
+		fonts = types.Dict{}
+		dr["Font"] = fonts
+	}
+	fonts[formFontID] = *fontRef
+
+	fields, err := ctx.DereferenceArray(ctx.Form["Fields"])
+	if err != nil {
+		return err
+	}
+	return setFieldFont(ctx, fields)
+}
+
+// setFieldFont 递归修改字段及其组件的DA，删除已有的外观以便按新字体重新生成
+func setFieldFont(ctx *pdfmodel.Context, fields types.Array) error {
+	for _, o := range fields {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			continue
+		}
+		if da := d.StringEntry("DA"); da != nil {
+			d["DA"] = types.StringLiteral(replaceDAFont(*da, formFontID))
+		} else if ft := d.NameEntry("FT"); ft != nil && *ft == "Tx" {
+			d["DA"] = types.StringLiteral("/" + formFontID + " 0 Tf 0 g")
+		}
+		if ft := d.NameEntry("FT"); ft == nil || *ft == "Tx" {
+			delete(d, "AP")
+		}
+
+		kids, err := ctx.DereferenceArray(d["Kids"])
+		if err != nil {
+			return err
+		}
+		if err := setFieldFont(ctx, kids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceDAFont 将DA中 Tf 操作的字体替换为fontID，保留字号和颜色
+func replaceDAFont(da, fontID string) string {
+	parts := strings.Fields(da)
+	for i, part := range parts {
+		if part == "Tf" && i >= 2 {
+			parts[i-2] = "/" + fontID
+			return strings.Join(parts, " ")
+		}
+	}
+	return "/" + fontID + " 0 Tf " + da
+}
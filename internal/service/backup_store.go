@@ -0,0 +1,336 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path"
+	"receipt/internal/model"
+	"receipt/internal/storage"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultScrubInterval 默认的备份校验间隔
+const DefaultScrubInterval = 24 * time.Hour
+
+// objectPrefix 备份文件内容所在的目录，按摘要的前两位分目录：objects/ab/abcdef…
+const objectPrefix = "objects/"
+
+// maxBackupNameAttempts 同一秒内生成同一收据的备份时，文件名加序号区分的最大尝试次数
+const maxBackupNameAttempts = 100
+
+// ErrBackupCorrupt 备份文件内容与清单中的摘要不符
+var ErrBackupCorrupt = errors.New("备份文件已损坏")
+
+// BackupManifest 备份清单的持久化存储
+type BackupManifest interface {
+	// PutBackup 添加一项，同名的项已存在时不覆盖并返回false
+	PutBackup(entry *model.BackupEntry) (bool, error)
+	// ReplaceBackup 添加或覆盖一项，返回被覆盖的项以及其他备份是否仍引用它的文件内容
+	ReplaceBackup(entry *model.BackupEntry) (*model.BackupEntry, bool, error)
+	// GetBackup 按备份文件名获取，不存在时返回 store.ErrBackupNotFound
+	GetBackup(name string) (*model.BackupEntry, error)
+	ListBackups() ([]*model.BackupEntry, error)
+	// DeleteBackup 删除一项，返回删除的项以及其他备份是否仍引用同一文件内容
+	DeleteBackup(name string) (*model.BackupEntry, bool, error)
+}
+
+// BackupStore 按内容寻址的收据备份
+//
+// 文件内容以SHA-256摘要为键保存，内容相同的备份只保存一份；清单记录每个备份文件名对应的
+// 收据编号、生成时间和摘要，列出和下载备份都以清单为准。
+type BackupStore struct {
+	files    storage.Storage
+	manifest BackupManifest
+	mu       sync.Mutex // 保存和删除互斥，避免删除文件内容时另一个备份正要引用它
+
+	scrubMu   sync.Mutex         // 同一时间只执行一次校验
+	lastScrub *model.ScrubReport // 最近一次校验的结果，由mu保护
+}
+
+// NewBackupStore 创建备份存储，文件内容保存在files中，清单保存在manifest中
+func NewBackupStore(files storage.Storage, manifest BackupManifest) *BackupStore {
+	return &BackupStore{files: files, manifest: manifest}
+}
+
+// Save 保存收据备份，备份文件名为 receipt_<编号>_<生成时间>.<格式>；内容已存在时只在清单中添加一项
+//
+// 文件名精确到秒，同一秒内再次备份同一收据时文件名加序号，如 receipt_<编号>_<生成时间>_2.<格式>，
+// 不覆盖已有的备份。
+func (b *BackupStore) Save(receiptID, format string, issuedAt time.Time, content []byte) (*model.BackupEntry, error) {
+	sum := sha256.Sum256(content)
+	base := fmt.Sprintf("receipt_%s_%s", receiptID, issuedAt.Format("20060102_150405"))
+	entry := &model.BackupEntry{
+		ReceiptID: receiptID,
+		Format:    format,
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      int64(len(content)),
+		IssuedAt:  issuedAt,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.putObject(entry.SHA256, content); err != nil {
+		return nil, err
+	}
+	for n := 1; n <= maxBackupNameAttempts; n++ {
+		entry.Name = base + "." + format
+		if n > 1 {
+			entry.Name = fmt.Sprintf("%s_%d.%s", base, n, format)
+		}
+		added, err := b.manifest.PutBackup(entry)
+		if err != nil {
+			return nil, err
+		}
+		if added {
+			return entry, nil
+		}
+	}
+	return nil, fmt.Errorf("保存备份失败: 同一时间的备份文件过多: %s", base)
+}
+
+// Get 按备份文件名获取清单中的一项
+func (b *BackupStore) Get(name string) (*model.BackupEntry, error) {
+	return b.manifest.GetBackup(name)
+}
+
+// List 按文件名顺序列出全部备份
+func (b *BackupStore) List() ([]*model.BackupEntry, error) {
+	return b.manifest.ListBackups()
+}
+
+// Open 打开备份的文件内容，调用方负责关闭
+func (b *BackupStore) Open(entry *model.BackupEntry) (io.ReadCloser, error) {
+	return b.files.Get(objectKey(entry.SHA256))
+}
+
+// Read 读取备份的文件内容并校验摘要
+func (b *BackupStore) Read(entry *model.BackupEntry) ([]byte, error) {
+	content, err := storage.ReadAll(b.files, objectKey(entry.SHA256))
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != entry.SHA256 {
+		return nil, fmt.Errorf("%w: %s", ErrBackupCorrupt, entry.Name)
+	}
+	return content, nil
+}
+
+// Delete 从清单中删除备份，没有其他备份引用同一内容时删除文件
+func (b *BackupStore) Delete(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entry, referenced, err := b.manifest.DeleteBackup(name)
+	if err != nil {
+		return err
+	}
+	if referenced {
+		return nil
+	}
+	return b.files.Delete(objectKey(entry.SHA256))
+}
+
+// Location 返回备份文件内容的完整位置
+func (b *BackupStore) Location(entry *model.BackupEntry) string {
+	return b.files.Location(objectKey(entry.SHA256))
+}
+
+// Migrate 将以前按文件名直接保存的备份移入按内容寻址的存储并登记到清单，返回迁移的文件数
+//
+// 子目录中的文件和文件名不是 receipt_<编号>_<yyyymmdd_hhmmss>.<格式> 的文件保留原样。
+func (b *BackupStore) Migrate() (int, error) {
+	objects, err := b.files.List("")
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, object := range objects {
+		if strings.Contains(object.Key, "/") {
+			continue
+		}
+		id, issuedAt, ok := parseBackupName(object.Key, time.Local)
+		if !ok {
+			continue
+		}
+		if err := b.migrate(object.Key, id, issuedAt); err != nil {
+			return migrated, fmt.Errorf("迁移备份%s失败: %v", object.Key, err)
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// migrate 迁移一个备份文件，写入文件内容和清单后删除原文件
+func (b *BackupStore) migrate(key, receiptID string, issuedAt time.Time) error {
+	content, err := storage.ReadAll(b.files, key)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	entry := &model.BackupEntry{
+		Name:      key,
+		ReceiptID: receiptID,
+		Format:    strings.TrimPrefix(path.Ext(key), "."),
+		SHA256:    hex.EncodeToString(sum[:]),
+		Size:      int64(len(content)),
+		IssuedAt:  issuedAt,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.putObject(entry.SHA256, content); err != nil {
+		return err
+	}
+	// 上次迁移中断时清单中可能已有同名的项，覆盖后释放不再被引用的旧内容
+	replaced, referenced, err := b.manifest.ReplaceBackup(entry)
+	if err != nil {
+		return err
+	}
+	if replaced != nil && replaced.SHA256 != entry.SHA256 && !referenced {
+		if err := b.files.Delete(objectKey(replaced.SHA256)); err != nil {
+			return err
+		}
+	}
+	return b.files.Delete(key)
+}
+
+// putObject 保存文件内容；已存在且内容完好时不重复写入，已损坏时覆盖
+func (b *BackupStore) putObject(hash string, content []byte) error {
+	key := objectKey(hash)
+	if info, err := b.files.Stat(key); err == nil && info.Size == int64(len(content)) {
+		if existing, err := storage.ReadAll(b.files, key); err == nil {
+			sum := sha256.Sum256(existing)
+			if hex.EncodeToString(sum[:]) == hash {
+				return nil
+			}
+		}
+	}
+	return b.files.Put(key, content)
+}
+
+// StartScrub 每隔interval校验一次全部备份，启动后先等待一个间隔
+func (b *BackupStore) StartScrub(interval time.Duration) {
+	go func() {
+		for {
+			time.Sleep(interval)
+			report, err := b.Scrub()
+			if err != nil {
+				log.Printf("警告：校验备份失败: %v", err)
+				continue
+			}
+			for _, issue := range report.Issues {
+				log.Printf("警告：备份文件%s %s，受影响的备份: %s", issue.SHA256, issue.Problem, strings.Join(issue.Names, ", "))
+			}
+		}
+	}()
+}
+
+// Scrub 重新计算每个备份文件内容的摘要，报告丢失、损坏以及清单中没有引用的文件
+func (b *BackupStore) Scrub() (*model.ScrubReport, error) {
+	b.scrubMu.Lock()
+	defer b.scrubMu.Unlock()
+
+	report := &model.ScrubReport{StartedAt: time.Now(), Issues: []*model.ScrubIssue{}}
+
+	// 同时读取文件列表和清单，避免把正在保存的备份当作没有引用的文件
+	b.mu.Lock()
+	objects, err := b.files.List(objectPrefix)
+	var entries []*model.BackupEntry
+	if err == nil {
+		entries, err = b.manifest.ListBackups()
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	names := map[string][]string{}
+	var hashes []string
+	for _, entry := range entries {
+		if _, ok := names[entry.SHA256]; !ok {
+			hashes = append(hashes, entry.SHA256)
+		}
+		names[entry.SHA256] = append(names[entry.SHA256], entry.Name)
+	}
+	report.Entries = len(entries)
+	report.Objects = len(hashes)
+
+	for _, hash := range hashes {
+		issue := b.scrubObject(hash)
+		if issue != nil {
+			issue.Names = names[hash]
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	for _, object := range objects {
+		if _, ok := names[path.Base(object.Key)]; !ok {
+			report.Orphans = append(report.Orphans, object.Key)
+		}
+	}
+
+	report.FinishedAt = time.Now()
+	b.mu.Lock()
+	b.lastScrub = report
+	b.mu.Unlock()
+	return report, nil
+}
+
+// LastScrub 返回最近一次校验的结果，尚未校验时返回nil
+func (b *BackupStore) LastScrub() *model.ScrubReport {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastScrub
+}
+
+// scrubObject 重新计算一个文件的摘要，没有问题时返回nil
+func (b *BackupStore) scrubObject(hash string) *model.ScrubIssue {
+	r, err := b.files.Get(objectKey(hash))
+	if errors.Is(err, storage.ErrNotExist) {
+		return &model.ScrubIssue{SHA256: hash, Problem: model.ScrubMissing}
+	}
+	if err != nil {
+		return &model.ScrubIssue{SHA256: hash, Problem: model.ScrubUnreadable, Message: err.Error()}
+	}
+	defer r.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return &model.ScrubIssue{SHA256: hash, Problem: model.ScrubUnreadable, Message: err.Error()}
+	}
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != hash {
+		return &model.ScrubIssue{SHA256: hash, Problem: model.ScrubCorrupt, Actual: actual}
+	}
+	return nil
+}
+
+// objectKey 文件内容的存储键
+func objectKey(hash string) string {
+	return objectPrefix + hash[:2] + "/" + hash
+}
+
+// parseBackupName 从备份文件名 receipt_<编号>_<yyyymmdd_hhmmss>.<格式> 中解析收据编号和生成时间
+func parseBackupName(key string, loc *time.Location) (string, time.Time, bool) {
+	name := strings.TrimSuffix(path.Base(key), path.Ext(key))
+	const layout = "20060102_150405"
+	if !strings.HasPrefix(name, "receipt_") || len(name) < len("receipt_")+len(layout)+2 {
+		return "", time.Time{}, false
+	}
+	stamp := name[len(name)-len(layout):]
+	id := name[len("receipt_") : len(name)-len(layout)]
+	if !strings.HasSuffix(id, "_") || len(id) < 2 {
+		return "", time.Time{}, false
+	}
+	issuedAt, err := time.ParseInLocation(layout, stamp, loc)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return strings.TrimSuffix(id, "_"), issuedAt, true
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"receipt/internal/storage"
+	"receipt/internal/store"
+	"testing"
+	"time"
+)
+
+func newTestBackupStore(t *testing.T) (*BackupStore, *storage.FileSystem) {
+	t.Helper()
+	db, err := store.Open(filepath.Join(t.TempDir(), "receipt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	files := storage.NewFileSystem(t.TempDir())
+	return NewBackupStore(files, db), files
+}
+
+func TestBackupSaveSameSecond(t *testing.T) {
+	b, _ := newTestBackupStore(t)
+	issuedAt := time.Date(2025, 9, 21, 10, 30, 0, 0, time.Local)
+
+	first, err := b.Save("NO101202509-001", "pdf", issuedAt, []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := b.Save("NO101202509-001", "pdf", issuedAt.Add(300*time.Millisecond), []byte("second"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "receipt_NO101202509-001_20250921_103000.pdf" || second.Name != "receipt_NO101202509-001_20250921_103000_2.pdf" {
+		t.Fatalf("names = %s, %s", first.Name, second.Name)
+	}
+
+	// 两个备份都保留自己的内容
+	for _, want := range []struct{ name, content string }{{first.Name, "first"}, {second.Name, "second"}} {
+		entry, err := b.Get(want.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := b.Read(entry)
+		if err != nil || string(content) != want.content {
+			t.Errorf("Read(%s) = %q, %v", want.name, content, err)
+		}
+	}
+}
+
+func TestBackupMigrateReleasesReplacedContent(t *testing.T) {
+	b, files := newTestBackupStore(t)
+	issuedAt := time.Date(2025, 9, 21, 10, 30, 0, 0, time.Local)
+	old, err := b.Save("NO101202509-001", "pdf", issuedAt, []byte("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 以前按文件名保存的同名文件，迁移时覆盖清单中的项
+	if err := files.Put(old.Name, []byte("legacy")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.Migrate(); err != nil || n != 1 {
+		t.Fatalf("Migrate = %d, %v", n, err)
+	}
+
+	entry, err := b.Get(old.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.Read(entry); err != nil || string(content) != "legacy" {
+		t.Errorf("Read = %q, %v", content, err)
+	}
+	if _, err := files.Stat(objectKey(old.SHA256)); !errors.Is(err, storage.ErrNotExist) {
+		t.Errorf("replaced content not released: %v", err)
+	}
+	if report, err := b.Scrub(); err != nil || len(report.Orphans) != 0 {
+		t.Errorf("Scrub = %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"receipt/internal/model"
+	"time"
+)
+
+// 幂等窗口的默认值
+const (
+	DefaultIdempotencyWindow     = 24 * time.Hour   // 带 Idempotency-Key 的请求
+	DefaultIdempotencyBodyWindow = time.Duration(0) // 未带 Idempotency-Key、按请求内容判断的重复请求，默认不判断
+	DefaultIdempotencyPurge      = time.Hour        // 清理过期记录的间隔
+)
+
+// MaxIdempotencyKeyLength Idempotency-Key 的最大长度
+const MaxIdempotencyKeyLength = 255
+
+// idempotencyPendingTimeout 首次请求占用幂等键的时限，超过后视为处理中断，重复请求可重新生成
+const idempotencyPendingTimeout = time.Minute
+
+var (
+	// ErrIdempotencyMismatch 同一 Idempotency-Key 用于内容不同的请求
+	ErrIdempotencyMismatch = errors.New("Idempotency-Key已用于内容不同的请求")
+	// ErrIdempotencyInProgress 同一请求的首次请求尚未完成
+	ErrIdempotencyInProgress = errors.New("相同的请求正在处理中")
+)
+
+// IdempotencyStore 幂等记录的持久化存储
+type IdempotencyStore interface {
+	// ClaimIdempotencyKey 已有未过期的记录时返回该记录，否则保存record并返回nil
+	ClaimIdempotencyKey(record *model.IdempotencyRecord, now time.Time) (*model.IdempotencyRecord, error)
+	PutIdempotencyRecord(record *model.IdempotencyRecord) error
+	DeleteIdempotencyRecord(key string) error
+	PurgeIdempotencyRecords(now time.Time) (int, error)
+}
+
+// Idempotency 生成接口的幂等处理
+//
+// 带 Idempotency-Key 的请求在window内重复时返回首次生成的收据，同一键用于不同内容的请求被拒绝；
+// 未带键的请求以请求内容的摘要作为键，在bodyWindow内重复时同样返回首次的结果，bodyWindow为0时不判断。
+// 记录只保存收据编号，过期的记录由Start定期删除。
+type Idempotency struct {
+	store      IdempotencyStore
+	window     time.Duration
+	bodyWindow time.Duration
+}
+
+// NewIdempotency 创建幂等处理
+func NewIdempotency(store IdempotencyStore, window, bodyWindow time.Duration) *Idempotency {
+	return &Idempotency{store: store, window: window, bodyWindow: bodyWindow}
+}
+
+// RequestHash 计算请求的摘要，包括方法、路径、查询参数和请求体
+func RequestHash(method, path, query string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "?" + query + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Begin 开始处理一个请求，key为请求头中的 Idempotency-Key，可为空
+//
+// 返回未完成的记录时由调用方生成收据后调用Complete或Release；返回已完成的记录时按其中的收据编号
+// 重新返回首次生成的收据；不需要幂等处理时返回nil。
+func (i *Idempotency) Begin(key, requestHash string) (*model.IdempotencyRecord, error) {
+	window, recordKey := i.window, "key:"+key
+	if key == "" {
+		window, recordKey = i.bodyWindow, "body:"+requestHash
+	}
+	if window <= 0 {
+		return nil, nil
+	}
+
+	now := time.Now()
+	record := &model.IdempotencyRecord{
+		Key:         recordKey,
+		RequestHash: requestHash,
+		Status:      model.IdempotencyPending,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(min(window, idempotencyPendingTimeout)),
+	}
+	existing, err := i.store.ClaimIdempotencyKey(record, now)
+	if err != nil {
+		return nil, err
+	}
+	if existing == nil {
+		return record, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, ErrIdempotencyMismatch
+	}
+	if !existing.Completed() {
+		return nil, ErrIdempotencyInProgress
+	}
+	return existing, nil
+}
+
+// Complete 保存首次请求生成的收据编号，窗口期从首次请求时开始计算
+func (i *Idempotency) Complete(record *model.IdempotencyRecord, receiptID string) error {
+	window := i.window
+	if record.Key == "body:"+record.RequestHash {
+		window = i.bodyWindow
+	}
+	record.Status = model.IdempotencyCompleted
+	record.ReceiptID = receiptID
+	record.ExpiresAt = record.CreatedAt.Add(window)
+	return i.store.PutIdempotencyRecord(record)
+}
+
+// Release 首次请求失败时释放幂等键，之后的重复请求重新生成
+func (i *Idempotency) Release(record *model.IdempotencyRecord) error {
+	return i.store.DeleteIdempotencyRecord(record.Key)
+}
+
+// Start 启动时和之后每隔interval删除一次过期的记录
+func (i *Idempotency) Start(interval time.Duration) {
+	go func() {
+		for {
+			if _, err := i.Purge(time.Now()); err != nil {
+				log.Printf("警告：%v", err)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Purge 删除在now之前过期的记录，返回删除的条数
+func (i *Idempotency) Purge(now time.Time) (int, error) {
+	return i.store.PurgeIdempotencyRecords(now)
+}
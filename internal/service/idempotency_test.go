@@ -0,0 +1,66 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"receipt/internal/store"
+	"testing"
+	"time"
+)
+
+func newTestIdempotency(t *testing.T, window, bodyWindow time.Duration) (*Idempotency, *store.Store) {
+	t.Helper()
+	db, err := store.Open(filepath.Join(t.TempDir(), "receipt.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewIdempotency(db, window, bodyWindow), db
+}
+
+func TestIdempotencyReplaysReceiptID(t *testing.T) {
+	i, _ := newTestIdempotency(t, time.Hour, DefaultIdempotencyBodyWindow)
+	hash := RequestHash("POST", "/api/receipt/generate", "", []byte(`{"rent":1500}`))
+
+	record, err := i.Begin("k1", hash)
+	if err != nil || record == nil || record.Completed() {
+		t.Fatalf("Begin = %+v, %v", record, err)
+	}
+	if _, err := i.Begin("k1", hash); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Errorf("Begin while pending = %v", err)
+	}
+	if err := i.Complete(record, "NO101202509-001"); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := i.Begin("k1", hash)
+	if err != nil || !replay.Completed() || replay.ReceiptID != "NO101202509-001" {
+		t.Fatalf("replay = %+v, %v", replay, err)
+	}
+	if _, err := i.Begin("k1", hash+"x"); !errors.Is(err, ErrIdempotencyMismatch) {
+		t.Errorf("Begin with other body = %v", err)
+	}
+
+	// 默认不按请求内容判断
+	if record, err := i.Begin("", hash); record != nil || err != nil {
+		t.Errorf("Begin without key = %+v, %v", record, err)
+	}
+}
+
+func TestIdempotencyPurge(t *testing.T) {
+	i, _ := newTestIdempotency(t, time.Hour, 0)
+	record, err := i.Begin("k1", "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Complete(record, "NO1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := i.Purge(time.Now()); err != nil || n != 0 {
+		t.Errorf("Purge before expiry = %d, %v", n, err)
+	}
+	if n, err := i.Purge(time.Now().Add(2 * time.Hour)); err != nil || n != 1 {
+		t.Errorf("Purge after expiry = %d, %v", n, err)
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/signintech/gopdf"
+)
+
+// 拼版纸张
+const (
+	SheetA4 = "A4"
+	SheetA5 = "A5"
+)
+
+// sheetSizes 纸张竖放时的尺寸（pt）
+var sheetSizes = map[string]gopdf.Rect{
+	SheetA4: {W: 210 * PointsPerMM, H: 297 * PointsPerMM},
+	SheetA5: {W: 148 * PointsPerMM, H: 210 * PointsPerMM},
+}
+
+const (
+	// sheetMargin 纸张四周不放置收据的边距，留给打印机不可打印区域和裁切线（mm）
+	sheetMargin = 10
+	// DefaultGutter 收据之间的默认间距（mm）
+	DefaultGutter = 5
+	// cropMarkOffset 裁切线与收据边缘的距离（mm）
+	cropMarkOffset = 2
+	// cropMarkLength 裁切线长度（mm）
+	cropMarkLength = 6
+)
+
+var (
+	// ErrImpositionNotFit 收据无法按要求排列到纸张上
+	ErrImpositionNotFit = errors.New("收据无法排列到纸张上")
+	// ErrImpositionUnsupported 收据PDF无法拼版
+	ErrImpositionUnsupported = errors.New("不支持拼版")
+)
+
+// Imposition 拼版参数：将多张收据按原尺寸排列在一张纸上打印
+type Imposition struct {
+	Sheet     string  // 纸张，A4 | A5
+	Up        int     // 每张纸上的收据数，0表示按纸张尺寸尽量多放
+	Gutter    float64 // 收据之间的间距（mm）
+	CropMarks bool    // 在纸张边距中绘制裁切线
+}
+
+// sheetGrid 一张纸上收据的排列方式
+type sheetGrid struct {
+	sheet      gopdf.Rect
+	cols, rows int
+	cellW      float64 // 单元格尺寸，取所有收据中最大的宽和高（pt）
+	cellH      float64
+	gutter     float64 // 间距（pt）
+	x, y       float64 // 左上角第一张收据的位置，整组收据在纸张上居中
+}
+
+// perSheet 返回每张纸上的收据数
+func (g *sheetGrid) perSheet() int {
+	return g.cols * g.rows
+}
+
+// cell 返回第i个位置的收据左上角坐标，按从上到下、从左到右排列
+func (g *sheetGrid) cell(i int) (float64, float64) {
+	row, col := i/g.cols, i%g.cols
+	return g.x + float64(col)*(g.cellW+g.gutter), g.y + float64(row)*(g.cellH+g.gutter)
+}
+
+// fitCount 返回长度为length的区域中能放下的尺寸为size、间距为gutter的收据数
+func fitCount(length, size, gutter float64) int {
+	return int(math.Floor((length + gutter + 0.01) / (size + gutter)))
+}
+
+// planSheet 按收据尺寸选择纸张方向和排列方式，取竖放和横放中能放下更多收据的一种
+func (imp Imposition) planSheet(cellW, cellH float64) (*sheetGrid, error) {
+	size, ok := sheetSizes[imp.Sheet]
+	if !ok {
+		return nil, fmt.Errorf("不支持的纸张: %s", imp.Sheet)
+	}
+	if imp.Gutter < 0 {
+		return nil, fmt.Errorf("收据间距不能为负数")
+	}
+	gutter := imp.Gutter * PointsPerMM
+	margin := sheetMargin * PointsPerMM
+
+	var best *sheetGrid
+	for _, sheet := range []gopdf.Rect{size, {W: size.H, H: size.W}} {
+		g := &sheetGrid{
+			sheet:  sheet,
+			cols:   fitCount(sheet.W-2*margin, cellW, gutter),
+			rows:   fitCount(sheet.H-2*margin, cellH, gutter),
+			cellW:  cellW,
+			cellH:  cellH,
+			gutter: gutter,
+		}
+		if best == nil || g.perSheet() > best.perSheet() {
+			best = g
+		}
+	}
+	if best.perSheet() == 0 {
+		return nil, fmt.Errorf("%w: %.0fmm×%.0fmm的收据超出%s纸张的可打印区域", ErrImpositionNotFit,
+			cellW/PointsPerMM, cellH/PointsPerMM, imp.Sheet)
+	}
+
+	if imp.Up > 0 {
+		if imp.Up > best.perSheet() {
+			return nil, fmt.Errorf("%w: %s纸张最多放%d张收据", ErrImpositionNotFit, imp.Sheet, best.perSheet())
+		}
+		// 优先减少行数，单列时保持从上到下排列
+		if best.cols >= imp.Up {
+			best.cols, best.rows = imp.Up, 1
+		} else {
+			best.rows = (imp.Up + best.cols - 1) / best.cols
+		}
+	}
+
+	best.x = (best.sheet.W - float64(best.cols)*cellW - float64(best.cols-1)*gutter) / 2
+	best.y = (best.sheet.H - float64(best.rows)*cellH - float64(best.rows-1)*gutter) / 2
+	return best, nil
+}
+
+// ImposePDF 将每个PDF的各页按原尺寸依次排列到纸张上，返回拼版后的多页PDF和每个PDF第一页所在的纸张页码
+//
+// 多联收据的各联连续排列。收据页面以表单XObject的方式导入，拼版结果不包含原PDF的数字签名和表单域。
+func ImposePDF(pdfs [][]byte, imp Imposition) ([]byte, []int, error) {
+	if len(pdfs) == 0 {
+		return nil, nil, fmt.Errorf("没有需要拼版的收据")
+	}
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	// 所有收据使用相同大小的单元格，明细较多的收据会更高
+	sizes := make([][]types.Dim, len(pdfs))
+	total := 0
+	var cellW, cellH float64
+	for i, content := range pdfs {
+		dims, err := api.PageDims(bytes.NewReader(content), conf)
+		if err != nil || len(dims) == 0 {
+			return nil, nil, fmt.Errorf("读取收据页面尺寸失败: %v", err)
+		}
+		for _, dim := range dims {
+			cellW, cellH = math.Max(cellW, dim.Width), math.Max(cellH, dim.Height)
+		}
+		sizes[i] = dims
+		total += len(dims)
+	}
+
+	grid, err := imp.planSheet(cellW, cellH)
+	if err != nil {
+		return nil, nil, err
+	}
+	perSheet := grid.perSheet()
+	if imp.Up > 0 {
+		perSheet = imp.Up
+	}
+
+	pdf := gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: grid.sheet})
+
+	n := 0
+	pages := make([]int, len(pdfs))
+	for i, content := range pdfs {
+		tpls, err := importPages(&pdf, content, len(sizes[i]))
+		if err != nil {
+			return nil, nil, fmt.Errorf("导入第%d张收据失败: %v", i+1, err)
+		}
+
+		pages[i] = n/perSheet + 1
+		for j, tpl := range tpls {
+			pos := n % perSheet
+			if pos == 0 {
+				pdf.AddPage()
+				if imp.CropMarks {
+					drawCropMarks(&pdf, grid, min(perSheet, total-n))
+				}
+			}
+			x, y := grid.cell(pos)
+			pdf.UseImportedTemplate(tpl, x, y, sizes[i][j].Width, sizes[i][j].Height)
+			n++
+		}
+	}
+
+	var out bytes.Buffer
+	if _, err := pdf.WriteTo(&out); err != nil {
+		return nil, nil, fmt.Errorf("生成拼版PDF失败: %v", err)
+	}
+	return out.Bytes(), pages, nil
+}
+
+// importPages 导入PDF的前count页为模板
+//
+// 导入只保留页面内容，表单域的值会丢失，因此不接受AcroForm表单。
+// gofpdi不支持对象流，先用pdfcpu重写为传统交叉引用表；gofpdi解析失败时会panic，这里转换为错误。
+func importPages(pdf *gopdf.GoPdf, content []byte, count int) (tpls []int, err error) {
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+	conf.WriteObjectStream = false
+	conf.WriteXRefStream = false
+
+	ctx, err := api.ReadValidateAndOptimize(bytes.NewReader(content), conf)
+	if err != nil {
+		return nil, err
+	}
+	if hasFormFields(ctx) {
+		return nil, fmt.Errorf("%w: AcroForm模板生成的收据包含表单域", ErrImpositionUnsupported)
+	}
+
+	var plain bytes.Buffer
+	if err := api.WriteContext(ctx, &plain); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	// 同一来源的各页需使用同一个ReadSeeker，gofpdi按其地址复用解析结果
+	var rs io.ReadSeeker = bytes.NewReader(plain.Bytes())
+	for page := 1; page <= count; page++ {
+		tpls = append(tpls, pdf.ImportPageStream(&rs, page, "/MediaBox"))
+	}
+	return tpls, nil
+}
+
+// hasFormFields PDF是否包含签名以外的表单域，签名的可见文字绘制在页面内容中，不受影响
+func hasFormFields(ctx *pdfmodel.Context) bool {
+	if ctx.Form == nil {
+		return false
+	}
+	fields, err := ctx.DereferenceArray(ctx.Form["Fields"])
+	if err != nil {
+		return true
+	}
+	for _, o := range fields {
+		field, err := ctx.DereferenceDict(o)
+		if err != nil || field == nil {
+			return true
+		}
+		if ft := field.NameEntry("FT"); ft == nil || *ft != "Sig" {
+			return true
+		}
+	}
+	return false
+}
+
+// drawCropMarks 在纸张边距中沿每条裁切线的延长线绘制裁切线，count为当前纸张上的收据数
+func drawCropMarks(pdf *gopdf.GoPdf, g *sheetGrid, count int) {
+	cols, rows := g.cols, (count+g.cols-1)/g.cols
+	if count < g.cols {
+		cols = count
+	}
+
+	offset := cropMarkOffset * PointsPerMM
+	length := cropMarkLength * PointsPerMM
+	top, left := g.y, g.x
+	bottom := g.y + float64(rows)*g.cellH + float64(rows-1)*g.gutter
+	right := g.x + float64(cols)*g.cellW + float64(cols-1)*g.gutter
+
+	pdf.SetLineType("solid")
+	pdf.SetLineWidth(0.25)
+	pdf.SetStrokeColor(0, 0, 0)
+
+	// 每张收据的左右边缘在上下边距中的竖线
+	for col := 0; col < cols; col++ {
+		x0 := g.x + float64(col)*(g.cellW+g.gutter)
+		for _, x := range []float64{x0, x0 + g.cellW} {
+			pdf.Line(x, top-offset-length, x, top-offset)
+			pdf.Line(x, bottom+offset, x, bottom+offset+length)
+		}
+	}
+	// 每张收据的上下边缘在左右边距中的横线
+	for row := 0; row < rows; row++ {
+		y0 := g.y + float64(row)*(g.cellH+g.gutter)
+		for _, y := range []float64{y0, y0 + g.cellH} {
+			pdf.Line(left-offset-length, y, left-offset, y)
+			pdf.Line(right+offset, y, right+offset+length, y)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"receipt/internal/model"
+	"receipt/internal/storage"
+	"strconv"
+	"time"
+)
+
+// DefaultJobWorkers 默认同时执行的任务数
+const DefaultJobWorkers = 2
+
+// jobPollInterval 没有收到新任务通知时检查队列的间隔，用于读取队列出错后恢复
+const jobPollInterval = 30 * time.Second
+
+// 已结束任务的清理
+const (
+	DefaultJobRetention       = 7 * 24 * time.Hour // 任务结束后保留的时间，之后删除任务记录和文件
+	DefaultJobCleanupInterval = time.Hour          // 清理已结束任务的间隔
+)
+
+// JobStore 异步任务和收据登记的持久化存储
+type JobStore interface {
+	CreateJob(job *model.Job) error
+	// ClaimJob 从队列中取出最早的任务并标记为执行中，队列为空时返回nil
+	ClaimJob() (*model.Job, error)
+	// SaveJobItem 保存任务项的进度，返回任务是否已被请求取消
+	SaveJobItem(id string, item *model.JobItem) (bool, error)
+	FinishJob(id string) (*model.Job, error)
+	RetryJob(id string) (*model.Job, error)
+	// RecoverJobs 将上次退出时仍在执行的任务重新加入队列
+	RecoverJobs() (int, error)
+	// ExpiredJobs 返回在before之前结束的任务编号
+	ExpiredJobs(before time.Time) ([]string, error)
+	// DeleteJob 删除已结束的任务及其任务项
+	DeleteJob(id string) error
+	RecordReceipt(data *model.ReceiptData, file model.ReceiptFile) error
+}
+
+// JobQueue 异步生成收据的任务队列
+//
+// 任务保存在JobStore中，由固定数量的worker按提交顺序执行，每个任务内的收据逐张生成，
+// 生成的文件保存在任务存储中，服务重启后未完成的任务从未生成的项继续执行。
+// 收据编号在生成前随任务项保存，中断后重新生成时沿用同一编号。
+type JobQueue struct {
+	pdf     *PDFService
+	store   JobStore
+	files   storage.Storage // 任务文件存储，每个任务一个子目录
+	workers int
+	wake    chan struct{}
+}
+
+// NewJobQueue 创建任务队列，需调用Start后才开始执行任务
+func NewJobQueue(pdf *PDFService, store JobStore, files storage.Storage, workers int) (*JobQueue, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("任务并发数必须大于0: %d", workers)
+	}
+	return &JobQueue{
+		pdf:     pdf,
+		store:   store,
+		files:   files,
+		workers: workers,
+		wake:    make(chan struct{}, workers),
+	}, nil
+}
+
+// Start 将上次退出时未完成的任务重新加入队列并启动worker
+func (q *JobQueue) Start() error {
+	recovered, err := q.store.RecoverJobs()
+	if err != nil {
+		return err
+	}
+	if recovered > 0 {
+		log.Printf("继续执行%d个未完成的任务", recovered)
+	}
+
+	for i := 0; i < q.workers; i++ {
+		go q.work()
+	}
+	q.notify()
+	return nil
+}
+
+// Submit 提交任务，分配任务编号后加入队列
+func (q *JobQueue) Submit(job *model.Job) error {
+	id, err := newJobID()
+	if err != nil {
+		return err
+	}
+	job.ID = id
+	job.CreatedAt = time.Now()
+	if err := q.store.CreateJob(job); err != nil {
+		return err
+	}
+	q.notify()
+	return nil
+}
+
+// Retry 重新生成已结束任务中失败和取消的项
+func (q *JobQueue) Retry(id string) (*model.Job, error) {
+	job, err := q.store.RetryJob(id)
+	if err != nil {
+		return nil, err
+	}
+	q.notify()
+	return job, nil
+}
+
+// ReadItemFile 读取任务项生成的收据文件
+func (q *JobQueue) ReadItemFile(job *model.Job, item *model.JobItem) ([]byte, error) {
+	content, err := storage.ReadAll(q.files, itemKey(job, item))
+	if err != nil {
+		return nil, fmt.Errorf("读取任务文件失败: %v", err)
+	}
+	return content, nil
+}
+
+// itemKey 任务项的文件键，文件按序号命名，避免房间号中的特殊字符进入路径
+func itemKey(job *model.Job, item *model.JobItem) string {
+	return job.ID + "/" + strconv.Itoa(item.Index) + "." + job.Format
+}
+
+// Cleanup 删除在before之前结束的任务：先删除任务文件，全部删除后再删除任务记录，
+// 删除文件失败的任务保留到下次清理。返回删除的任务数。
+func (q *JobQueue) Cleanup(before time.Time) (int, error) {
+	ids, err := q.store.ExpiredJobs(before)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if err := q.deleteFiles(id); err != nil {
+			log.Printf("警告：删除任务%s的文件失败: %v", id, err)
+			continue
+		}
+		if err := q.store.DeleteJob(id); err != nil {
+			log.Printf("警告：%v", err)
+			continue
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// StartCleanup 每隔interval删除结束超过retention的任务，retention为0时不清理
+func (q *JobQueue) StartCleanup(retention, interval time.Duration) {
+	if retention <= 0 {
+		return
+	}
+	go func() {
+		for {
+			deleted, err := q.Cleanup(time.Now().Add(-retention))
+			if err != nil {
+				log.Printf("警告：清理任务失败: %v", err)
+			} else if deleted > 0 {
+				log.Printf("清理任务：删除%d个已结束的任务", deleted)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// deleteFiles 删除任务目录下的全部文件
+func (q *JobQueue) deleteFiles(id string) error {
+	files, err := q.files.List(id + "/")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if err := q.files.Delete(f.Key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// notify 唤醒空闲的worker检查队列
+func (q *JobQueue) notify() {
+	for i := 0; i < q.workers; i++ {
+		select {
+		case q.wake <- struct{}{}:
+		default:
+			return
+		}
+	}
+}
+
+// work 依次从队列中取出任务执行，队列为空时等待新任务
+func (q *JobQueue) work() {
+	for {
+		job, err := q.store.ClaimJob()
+		if err != nil {
+			log.Printf("警告：%v", err)
+		}
+		if job == nil {
+			select {
+			case <-q.wake:
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+		q.run(job)
+	}
+}
+
+// run 逐张生成任务中等待生成的收据，每张完成后保存进度，请求取消时在当前一张完成后停止
+func (q *JobQueue) run(job *model.Job) {
+	for _, item := range job.Items {
+		if item.Status != model.JobItemPending || item.Request == nil {
+			continue
+		}
+
+		item.Attempts++
+		if err := q.generate(job, item); err != nil {
+			item.Status, item.Success, item.Message = model.JobItemFailed, false, err.Error()
+		} else {
+			item.Status, item.Success, item.Message = model.JobItemSucceeded, true, ""
+		}
+
+		canceled, err := q.store.SaveJobItem(job.ID, item)
+		if err != nil {
+			log.Printf("警告：保存任务%s进度失败: %v", job.ID, err)
+			break
+		}
+		if canceled {
+			break
+		}
+	}
+
+	if _, err := q.store.FinishJob(job.ID); err != nil {
+		log.Printf("警告：结束任务%s失败: %v", job.ID, err)
+	}
+}
+
+// generate 生成任务项的收据，保存到任务存储并登记；登记失败时删除文件，任务项记为失败
+func (q *JobQueue) generate(job *model.Job, item *model.JobItem) error {
+	data, err := ConvertReceiptToData(item.Request)
+	if err != nil {
+		return fmt.Errorf("请求参数错误: %v", err)
+	}
+
+	if item.ReceiptID != "" {
+		data.ID = item.ReceiptID
+	} else {
+		if err := q.pdf.AssignNumber(data); err != nil {
+			return fmt.Errorf("分配收据编号失败: %v", err)
+		}
+		// 编号在生成前保存，中断后重新生成时沿用；只写入这一项，不重写整个任务
+		item.ReceiptID = data.ID
+		if _, err := q.store.SaveJobItem(job.ID, item); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := q.pdf.RenderReceipt(&buf, data, job.Format); err != nil {
+		return fmt.Errorf("生成收据失败: %v", err)
+	}
+
+	if err := q.files.Put(itemKey(job, item), buf.Bytes()); err != nil {
+		return fmt.Errorf("保存收据文件失败: %v", err)
+	}
+	item.FileName = fmt.Sprintf("receipt_%s.%s", data.ID, job.Format)
+
+	if err := q.store.RecordReceipt(data, model.NewReceiptFile(job.Format, "", buf.Bytes())); err != nil {
+		if derr := q.files.Delete(itemKey(job, item)); derr != nil {
+			log.Printf("警告：删除未登记收据的文件失败: %v", derr)
+		}
+		item.FileName = ""
+		return err
+	}
+	return nil
+}
+
+// newJobID 生成任务编号：提交时间加随机后缀，按字典序即为提交顺序
+func newJobID() (string, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("生成任务编号失败: %v", err)
+	}
+	return time.Now().Format("20060102150405") + "-" + hex.EncodeToString(suffix), nil
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"os"
+	"receipt/internal/model"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// PointsPerMM 每毫米对应的PDF点数
+const PointsPerMM = 2.83465
+
+// 布局元素类型
+const (
+	ElementRect     = "rect"     // 矩形边框
+	ElementLine     = "line"     // 直线
+	ElementText     = "text"     // 文本，可包含 {字段名} 占位符
+	ElementItems    = "items"    // 收费明细表格，表格下方的元素随行数下移
+	ElementCheckbox = "checkbox" // 勾选框，字段值在values中时绘制勾号
+	ElementSeal     = "seal"     // 印章或签名图片，按所有者从印章图片库取图，未登记时不绘制
+	ElementQRCode   = "qrcode"   // 边长为w的二维码，内容为text，默认为收据在线校验地址
+)
+
+// defaultQRCodeText qrcode元素未指定text时编码的内容
+const defaultQRCodeText = "{verify_url}"
+
+// maxSealRotate seal元素随机旋转角度的上限（度）
+const maxSealRotate = 30
+
+// itemsTableGap 明细表格与下方元素之间的间距
+const itemsTableGap = 6
+
+// 文本对齐方式
+const (
+	AlignLeft   = "left"
+	AlignCenter = "center"
+	AlignRight  = "right"
+)
+
+//go:embed layouts/default.json
+var defaultLayoutJSON []byte
+
+// Layout 收据版式描述，PDF和图片渲染共用
+//
+// 所有坐标、尺寸均以PDF点(pt)为单位，原点在左上角；文本的Y坐标为基线位置。
+type Layout struct {
+	Name        string            `json:"name"`
+	Width       float64           `json:"width"`        // 页面宽度
+	Height      float64           `json:"height"`       // 页面高度
+	Fonts       map[string]string `json:"fonts"`        // 字体名称 -> TTF文件路径
+	DefaultFont string            `json:"default_font"` // 元素未指定字体时使用
+	Elements    []LayoutElement   `json:"elements"`
+
+	Copies map[string]LayoutCopy `json:"copies,omitempty"` // 多联收据各联的标签和底色，按联次名称（stub、customer、accounting）
+}
+
+// LayoutCopy 多联收据中一联的样式
+type LayoutCopy struct {
+	Label string `json:"label"`          // 联次标签，如 第一联 存根联，在文本中以 {copy_label} 引用
+	Tint  string `json:"tint,omitempty"` // 页面底色 #RRGGBB，默认白色
+}
+
+// LayoutElement 版式中的单个元素
+type LayoutElement struct {
+	Type      string  `json:"type"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	W         float64 `json:"w,omitempty"`          // rect宽度
+	H         float64 `json:"h,omitempty"`          // rect高度
+	X2        float64 `json:"x2,omitempty"`         // line终点
+	Y2        float64 `json:"y2,omitempty"`         // line终点
+	LineWidth float64 `json:"line_width,omitempty"` // 线宽，默认1
+	Text      string  `json:"text,omitempty"`       // 文本内容，如 "交来: {month} {purpose}"
+	Font      string  `json:"font,omitempty"`
+	FontSize  float64 `json:"font_size,omitempty"`
+	Color     string  `json:"color,omitempty"`    // #RRGGBB，默认黑色
+	Align     string  `json:"align,omitempty"`    // left | center | right，相对X坐标对齐
+	Vertical  bool    `json:"vertical,omitempty"` // text竖排，每个字符一行，行距为字号的1.2倍，Y为第一个字符的基线
+
+	RowHeight float64        `json:"row_height,omitempty"` // items表格行高
+	Columns   []LayoutColumn `json:"columns,omitempty"`    // items表格列定义
+
+	Field  string   `json:"field,omitempty"`  // checkbox对应的收据字段，如 payment_method
+	Values []string `json:"values,omitempty"` // checkbox勾选条件，字段值为其中之一时勾选
+
+	Seals   []string `json:"seals,omitempty"`   // seal图片类型，按顺序查找，如 ["finance", "company"]
+	Owners  []string `json:"owners,omitempty"`  // seal图片所有者，可包含占位符，如 ["{landlord}", "{recipient}"]
+	Rotate  float64  `json:"rotate,omitempty"`  // seal随机旋转的最大角度，模拟手工盖章
+	Opacity float64  `json:"opacity,omitempty"` // seal不透明度，0-1，默认1
+}
+
+// LayoutColumn 明细表格的列
+type LayoutColumn struct {
+	Title string  `json:"title"` // 表头
+	Field string  `json:"field"` // description | quantity | unit_price | amount
+	Width float64 `json:"width"`
+	Align string  `json:"align,omitempty"`
+}
+
+// DefaultLayout 返回内置的176mm×85mm收款收据版式
+func DefaultLayout() *Layout {
+	layout, err := ParseLayout(defaultLayoutJSON)
+	if err != nil {
+		panic(fmt.Sprintf("内置版式无效: %v", err))
+	}
+	return layout
+}
+
+// LoadLayout 从JSON文件加载版式
+func LoadLayout(path string) (*Layout, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取版式文件失败: %v", err)
+	}
+	return ParseLayout(content)
+}
+
+// ParseLayout 解析并校验JSON版式
+func ParseLayout(content []byte) (*Layout, error) {
+	var layout Layout
+	if err := json.Unmarshal(content, &layout); err != nil {
+		return nil, fmt.Errorf("解析版式失败: %v", err)
+	}
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+	return &layout, nil
+}
+
+// Validate 校验版式是否可用
+func (l *Layout) Validate() error {
+	if l.Width <= 0 || l.Height <= 0 {
+		return fmt.Errorf("版式页面尺寸无效: %.2f×%.2f", l.Width, l.Height)
+	}
+	if _, ok := l.Fonts[l.DefaultFont]; !ok {
+		return fmt.Errorf("版式默认字体未定义: %s", l.DefaultFont)
+	}
+
+	for i, e := range l.Elements {
+		switch e.Type {
+		case ElementRect, ElementLine:
+		case ElementText:
+			if e.Align != "" && e.Align != AlignLeft && e.Align != AlignCenter && e.Align != AlignRight {
+				return fmt.Errorf("版式元素%d对齐方式未知: %s", i, e.Align)
+			}
+			if _, ok := l.Fonts[l.fontName(e)]; !ok {
+				return fmt.Errorf("版式元素%d使用了未定义的字体: %s", i, e.Font)
+			}
+			if e.FontSize <= 0 {
+				return fmt.Errorf("版式元素%d字号无效", i)
+			}
+		case ElementItems:
+			if e.RowHeight <= 0 || e.FontSize <= 0 || len(e.Columns) == 0 {
+				return fmt.Errorf("版式元素%d明细表格需要row_height、font_size和columns", i)
+			}
+			if _, ok := l.Fonts[l.fontName(e)]; !ok {
+				return fmt.Errorf("版式元素%d使用了未定义的字体: %s", i, e.Font)
+			}
+			for _, col := range e.Columns {
+				if _, ok := itemColumnValue(model.ReceiptItemData{}, col.Field); !ok {
+					return fmt.Errorf("版式元素%d明细列字段未知: %s", i, col.Field)
+				}
+			}
+		case ElementCheckbox:
+			if e.W <= 0 || len(e.Values) == 0 {
+				return fmt.Errorf("版式元素%d勾选框需要w和values", i)
+			}
+			if _, ok := layoutFields(&model.ReceiptData{})[e.Field]; !ok {
+				return fmt.Errorf("版式元素%d勾选框字段未知: %s", i, e.Field)
+			}
+		case ElementQRCode:
+			if e.W <= 0 {
+				return fmt.Errorf("版式元素%d二维码需要w", i)
+			}
+		case ElementSeal:
+			if e.W <= 0 || e.H <= 0 || len(e.Seals) == 0 || len(e.Owners) == 0 {
+				return fmt.Errorf("版式元素%d印章需要w、h、seals和owners", i)
+			}
+			for _, kind := range e.Seals {
+				if SealKindName(kind) == "" {
+					return fmt.Errorf("版式元素%d印章类型未知: %s", i, kind)
+				}
+			}
+			if e.Rotate < 0 || e.Rotate > maxSealRotate {
+				return fmt.Errorf("版式元素%d印章旋转角度应在0-%d之间", i, maxSealRotate)
+			}
+			if e.Opacity < 0 || e.Opacity > 1 {
+				return fmt.Errorf("版式元素%d印章不透明度应在0-1之间", i)
+			}
+		default:
+			return fmt.Errorf("版式元素%d类型未知: %s", i, e.Type)
+		}
+		if _, err := parseColor(e.Color); err != nil {
+			return fmt.Errorf("版式元素%d颜色无效: %v", i, err)
+		}
+	}
+
+	for name, c := range l.Copies {
+		if !slices.Contains(model.Copies, name) {
+			return fmt.Errorf("版式联次未知: %s", name)
+		}
+		if _, err := parseColor(c.Tint); err != nil {
+			return fmt.Errorf("版式联次%s底色无效: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// copyStyle 返回联次的样式，name为空表示单联收据，没有标签和底色
+func (l *Layout) copyStyle(name string) LayoutCopy {
+	if name == "" {
+		return LayoutCopy{}
+	}
+	if c, ok := l.Copies[name]; ok {
+		return c
+	}
+	return LayoutCopy{Label: copyNames[name]}
+}
+
+// copyNames 版式未定义联次样式时使用的标签
+var copyNames = map[string]string{
+	model.CopyStub:       "存根联",
+	model.CopyCustomer:   "收据联",
+	model.CopyAccounting: "记账联",
+}
+
+// receiptCopies 返回需要渲染的联次，单联收据返回一个空名称
+func receiptCopies(data *model.ReceiptData) []string {
+	if len(data.Copies) == 0 {
+		return []string{""}
+	}
+	return data.Copies
+}
+
+// textLines 返回text元素逐行绘制的文本和每行的基线Y坐标，竖排时每个字符一行，空白字符只占位
+func (e LayoutElement) textLines(text string) ([]string, []float64) {
+	if !e.Vertical {
+		return []string{text}, []float64{e.Y}
+	}
+
+	var lines []string
+	var ys []float64
+	for i, r := range []rune(text) {
+		if !unicode.IsSpace(r) {
+			lines = append(lines, string(r))
+			ys = append(ys, e.Y+float64(i)*e.FontSize*1.2)
+		}
+	}
+	return lines, ys
+}
+
+// fontName 返回元素实际使用的字体名称
+func (l *Layout) fontName(e LayoutElement) string {
+	if e.Font != "" {
+		return e.Font
+	}
+	return l.DefaultFont
+}
+
+// lineWidth 返回元素线宽，未设置时为1
+func (e LayoutElement) lineWidth() float64 {
+	if e.LineWidth > 0 {
+		return e.LineWidth
+	}
+	return 1
+}
+
+// opacity 返回seal元素的不透明度，未设置时为1
+func (e LayoutElement) opacity() float64 {
+	if e.Opacity > 0 {
+		return e.Opacity
+	}
+	return 1
+}
+
+// alignX 根据对齐方式和文本宽度计算文本起始X坐标
+func alignX(x, textWidth float64, align string) float64 {
+	switch align {
+	case AlignCenter:
+		return x - textWidth/2
+	case AlignRight:
+		return x - textWidth
+	default:
+		return x
+	}
+}
+
+// arrange 展开收费明细表格，返回实际绘制的元素和页面高度
+//
+// 没有收费明细时表格不占空间；有明细时位于表格起始Y坐标及其下方的元素整体下移，
+// 跨越表格位置的矩形和直线随之拉长。
+func (l *Layout) arrange(data *model.ReceiptData) ([]LayoutElement, float64) {
+	type table struct {
+		y, extra float64
+	}
+	var tables []table
+	if len(data.Items) > 0 {
+		for _, e := range l.Elements {
+			if e.Type == ElementItems {
+				rows := float64(len(data.Items) + 2) // 表头 + 明细 + 合计
+				tables = append(tables, table{y: e.Y, extra: rows*e.RowHeight + itemsTableGap})
+			}
+		}
+	}
+
+	// shift 计算坐标下移量：inclusive为true时位于表格起点上的坐标也下移（用于上边缘和文本基线）
+	shift := func(y float64, inclusive bool) float64 {
+		offset := 0.0
+		for _, t := range tables {
+			if y > t.y || (inclusive && y == t.y) {
+				offset += t.extra
+			}
+		}
+		return y + offset
+	}
+
+	fields := layoutFields(data)
+	elements := make([]LayoutElement, 0, len(l.Elements))
+	for _, e := range l.Elements {
+		switch e.Type {
+		case ElementItems:
+			if len(data.Items) > 0 {
+				e.Y = shift(e.Y, false)
+				elements = append(elements, l.expandItems(e, data)...)
+			}
+		case ElementRect:
+			top, bottom := shift(e.Y, true), shift(e.Y+e.H, false)
+			e.Y, e.H = top, bottom-top
+			elements = append(elements, e)
+		case ElementLine:
+			e.Y, e.Y2 = shift(e.Y, e.Y <= e.Y2), shift(e.Y2, e.Y2 <= e.Y)
+			elements = append(elements, e)
+		case ElementCheckbox:
+			e.Y = shift(e.Y, true)
+			elements = append(elements, expandCheckbox(e, fields)...)
+		default:
+			e.Y = shift(e.Y, true)
+			elements = append(elements, e)
+		}
+	}
+
+	return elements, shift(l.Height, false)
+}
+
+// expandItems 将明细表格展开为矩形、直线和文本元素
+func (l *Layout) expandItems(e LayoutElement, data *model.ReceiptData) []LayoutElement {
+	rowHeight := e.RowHeight
+	rows := len(data.Items) + 2
+	width := 0.0
+	for _, col := range e.Columns {
+		width += col.Width
+	}
+	height := float64(rows) * rowHeight
+	lastColumnX := e.X + width - e.Columns[len(e.Columns)-1].Width
+
+	elements := []LayoutElement{
+		{Type: ElementRect, X: e.X, Y: e.Y, W: width, H: height, LineWidth: e.LineWidth, Color: e.Color},
+	}
+
+	// 行分隔线
+	for r := 1; r < rows; r++ {
+		y := e.Y + float64(r)*rowHeight
+		elements = append(elements, LayoutElement{Type: ElementLine, X: e.X, Y: y, X2: e.X + width, Y2: y, LineWidth: e.LineWidth, Color: e.Color})
+	}
+
+	// 列分隔线：合计行只保留金额列的分隔线
+	x := e.X
+	for i, col := range e.Columns[:len(e.Columns)-1] {
+		x += col.Width
+		bottom := e.Y + float64(rows-1)*rowHeight
+		if i == len(e.Columns)-2 {
+			bottom = e.Y + height
+		}
+		elements = append(elements, LayoutElement{Type: ElementLine, X: x, Y: e.Y, X2: x, Y2: bottom, LineWidth: e.LineWidth, Color: e.Color})
+	}
+
+	// cell 生成单元格文本，基线位于行内垂直居中位置
+	cell := func(row int, x, w float64, align, text string) LayoutElement {
+		textX := x + 3
+		switch align {
+		case AlignCenter:
+			textX = x + w/2
+		case AlignRight:
+			textX = x + w - 3
+		}
+		return LayoutElement{
+			Type:     ElementText,
+			X:        textX,
+			Y:        e.Y + float64(row)*rowHeight + (rowHeight+e.FontSize*0.7)/2,
+			Text:     text,
+			Font:     e.Font,
+			FontSize: e.FontSize,
+			Color:    e.Color,
+			Align:    align,
+		}
+	}
+
+	x = e.X
+	for _, col := range e.Columns {
+		elements = append(elements, cell(0, x, col.Width, AlignCenter, col.Title))
+		for r, item := range data.Items {
+			value, _ := itemColumnValue(item, col.Field)
+			elements = append(elements, cell(r+1, x, col.Width, col.Align, value))
+		}
+		x += col.Width
+	}
+
+	elements = append(elements,
+		cell(rows-1, e.X, lastColumnX-e.X, AlignLeft, "合计  人民币 {rent_zh}"),
+		cell(rows-1, lastColumnX, e.X+width-lastColumnX, AlignRight, "{rent}"),
+	)
+
+	return elements
+}
+
+// expandCheckbox 将勾选框展开为W×W的方框，字段值匹配时在框内绘制勾号
+func expandCheckbox(e LayoutElement, fields map[string]string) []LayoutElement {
+	size := e.W
+	elements := []LayoutElement{
+		{Type: ElementRect, X: e.X, Y: e.Y, W: size, H: size, LineWidth: e.LineWidth, Color: e.Color},
+	}
+
+	value := fields[e.Field]
+	for _, v := range e.Values {
+		if value != "" && value == v {
+			tickWidth := e.lineWidth() * 1.5
+			elements = append(elements,
+				LayoutElement{Type: ElementLine, X: e.X + size*0.2, Y: e.Y + size*0.5, X2: e.X + size*0.42, Y2: e.Y + size*0.78, LineWidth: tickWidth, Color: e.Color},
+				LayoutElement{Type: ElementLine, X: e.X + size*0.42, Y: e.Y + size*0.78, X2: e.X + size*0.85, Y2: e.Y + size*0.18, LineWidth: tickWidth, Color: e.Color},
+			)
+			break
+		}
+	}
+
+	return elements
+}
+
+// itemColumnValue 返回明细项在指定列的值
+func itemColumnValue(item model.ReceiptItemData, field string) (string, bool) {
+	switch field {
+	case "description":
+		return item.Description, true
+	case "quantity":
+		return item.Quantity, true
+	case "unit_price":
+		return item.UnitPrice.String(), true
+	case "amount":
+		return item.Amount.String(), true
+	}
+	return "", false
+}
+
+// layoutFields 将收据数据转换为版式占位符可引用的字段
+func layoutFields(data *model.ReceiptData) map[string]string {
+	return map[string]string{
+		"id":          data.ID,
+		"rent":        data.Rent.String(),
+		"rent_zh":     data.RentZh,
+		"room_number": data.RoomNumber,
+		"recipient":   data.Recipient,
+		"payer":       data.Payer,
+		"date":        data.Date,
+		"month":       data.Month,
+		"purpose":     data.Purpose,
+		"landlord":    data.Landlord,
+
+		"payment_method":    data.PaymentMethod,
+		"payment_method_zh": model.PaymentMethodName(data.PaymentMethod),
+		"payment_reference": data.PaymentReference,
+	}
+}
+
+// expandText 将文本中的 {字段名} 替换为收据数据
+func expandText(text string, fields map[string]string) string {
+	if !strings.Contains(text, "{") {
+		return text
+	}
+
+	pairs := make([]string, 0, len(fields)*2)
+	for name, value := range fields {
+		pairs = append(pairs, "{"+name+"}", value)
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// parseColor 解析 #RRGGBB 颜色，空字符串为黑色
+func parseColor(s string) (color.RGBA, error) {
+	if s == "" {
+		return color.RGBA{0, 0, 0, 255}, nil
+	}
+
+	hex := strings.TrimPrefix(s, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("颜色格式应为#RRGGBB: %s", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("颜色格式应为#RRGGBB: %s", s)
+	}
+
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
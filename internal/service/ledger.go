@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"receipt/internal/model"
+	"sort"
+	"time"
+)
+
+// VerifyLedger 按给定顺序校验开具记录的哈希链，records不为nil时再与收据登记记录逐张比对
+//
+// 哈希链能发现记录被修改（哈希不符）、删除或插入（序号不连续、prev_hash对不上）以及调换顺序；
+// 与登记记录比对能发现收据被删除、金额或付款人被修改，以及绕过开具记录登记的收据。
+func VerifyLedger(entries []*model.LedgerEntry, records []*model.ReceiptRecord) *model.LedgerReport {
+	report := &model.LedgerReport{
+		CheckedAt: time.Now(),
+		Entries:   len(entries),
+		Head:      model.LedgerGenesisHash,
+		Problems:  []*model.LedgerProblem{},
+	}
+	problem := func(seq uint64, receiptID, kind, format string, args ...interface{}) {
+		report.Problems = append(report.Problems, &model.LedgerProblem{
+			Seq:       seq,
+			ReceiptID: receiptID,
+			Problem:   kind,
+			Message:   fmt.Sprintf(format, args...),
+		})
+	}
+
+	var prevSeq uint64
+	for _, entry := range entries {
+		if entry.Seq != prevSeq+1 {
+			problem(entry.Seq, entry.ReceiptID, model.LedgerGap, "序号应为%d，实际为%d", prevSeq+1, entry.Seq)
+		}
+		if entry.PrevHash != report.Head {
+			problem(entry.Seq, entry.ReceiptID, model.LedgerBrokenLink, "prev_hash与上一条记录的哈希%s不符", report.Head)
+		}
+		if hash := entry.ComputeHash(); hash != entry.Hash {
+			problem(entry.Seq, entry.ReceiptID, model.LedgerHashMismatch, "记录内容的哈希为%s，记录的哈希为%s", hash, entry.Hash)
+		}
+		prevSeq, report.Head = entry.Seq, entry.Hash
+	}
+
+	if records != nil {
+		compareLedgerRecords(entries, records, problem)
+	}
+
+	report.Valid = len(report.Problems) == 0
+	return report
+}
+
+// compareLedgerRecords 逐张比对开具记录和收据登记记录
+func compareLedgerRecords(entries []*model.LedgerEntry, records []*model.ReceiptRecord,
+	problem func(seq uint64, receiptID, kind, format string, args ...interface{})) {
+	type ledgerReceipt struct {
+		issue     *model.LedgerEntry
+		documents []string // 开具和再次生成文件的摘要，按记录顺序
+		voided    bool
+	}
+	receipts := map[string]*ledgerReceipt{}
+	var ids []string
+	for _, entry := range entries {
+		r := receipts[entry.ReceiptID]
+		if r == nil {
+			r = &ledgerReceipt{}
+			receipts[entry.ReceiptID] = r
+			ids = append(ids, entry.ReceiptID)
+		}
+		switch entry.Event {
+		case model.LedgerIssue:
+			if r.issue == nil {
+				r.issue = entry
+			}
+			r.documents = append(r.documents, entry.DocumentHash)
+		case model.LedgerFile:
+			r.documents = append(r.documents, entry.DocumentHash)
+		case model.LedgerVoid:
+			r.voided = true
+		}
+	}
+
+	byID := make(map[string]*model.ReceiptRecord, len(records))
+	for _, record := range records {
+		byID[record.ID] = record
+	}
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		r := receipts[id]
+		if r.issue == nil {
+			continue
+		}
+		record := byID[id]
+		if record == nil {
+			problem(r.issue.Seq, id, model.LedgerRecordMissing, "收据登记记录不存在")
+			continue
+		}
+		if record.Rent != r.issue.Amount {
+			problem(r.issue.Seq, id, model.LedgerRecordAltered, "金额为%s，开具时为%s", record.Rent, r.issue.Amount)
+		}
+		if record.Payer != r.issue.Payer {
+			problem(r.issue.Seq, id, model.LedgerRecordAltered, "付款人为%s，开具时为%s", record.Payer, r.issue.Payer)
+		}
+		if !sameDocuments(record.Files, r.documents) {
+			problem(r.issue.Seq, id, model.LedgerRecordAltered, "生成文件的摘要与开具记录不符")
+		}
+		if record.Voided() != r.voided {
+			problem(r.issue.Seq, id, model.LedgerRecordAltered, "作废状态与开具记录不符")
+		}
+	}
+
+	var unrecorded []string
+	for _, record := range records {
+		if r := receipts[record.ID]; r == nil || r.issue == nil {
+			unrecorded = append(unrecorded, record.ID)
+		}
+	}
+	sort.Strings(unrecorded)
+	for _, id := range unrecorded {
+		problem(0, id, model.LedgerUnrecorded, "收据登记记录没有对应的开具记录")
+	}
+}
+
+// sameDocuments 登记记录中的文件摘要是否与开具记录一致；补记的没有文件的收据摘要为空
+func sameDocuments(files []model.ReceiptFile, documents []string) bool {
+	if len(files) == 0 {
+		return len(documents) == 1 && documents[0] == ""
+	}
+	if len(files) != len(documents) {
+		return false
+	}
+	for i, file := range files {
+		if file.SHA256 != documents[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadLedger 读取导出的开具记录（每行一条JSON），空行忽略
+func ReadLedger(r io.Reader) ([]*model.LedgerEntry, error) {
+	var entries []*model.LedgerEntry
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Bytes()
+		if len(text) == 0 {
+			continue
+		}
+		entry := &model.LedgerEntry{}
+		if err := json.Unmarshal(text, entry); err != nil {
+			return nil, fmt.Errorf("第%d行不是有效的开具记录: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
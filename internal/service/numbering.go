@@ -0,0 +1,173 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"receipt/internal/model"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultNumberPattern 默认收据编号格式，如 NO101202509-001
+const DefaultNumberPattern = "{prefix}{room}{yyyymm}-{seq:03}"
+
+// DefaultNumberPrefix 默认收据编号前缀
+const DefaultNumberPrefix = "NO"
+
+// maxSeqWidth 序号补零的最大位数
+const maxSeqWidth = 12
+
+// numberTokenPattern 编号格式中的占位符，如 {room}、{seq:03}
+var numberTokenPattern = regexp.MustCompile(`\{([a-z]+)(?::(\d+))?\}`)
+
+// NumberAllocator 编号序列的持久化存储
+type NumberAllocator interface {
+	// AllocateNumber 在作用域内递增序号并返回由format生成的唯一编号
+	AllocateNumber(scope string, format func(seq int64) string) (string, error)
+	// CurrentSequence 返回作用域最近分配的序号
+	CurrentSequence(scope string) (int64, error)
+}
+
+// Numbering 收据编号分配器
+//
+// 编号格式支持以下占位符：
+//
+//	{prefix}   编号前缀
+//	{room}     房间号
+//	{yyyy}     收据月份的年份，如 2025
+//	{mm}       收据月份，如 09
+//	{yyyymm}   收据年月，如 202509
+//	{yyyymmdd} 收据日期，如 20250921
+//	{seq}      序号，{seq:03} 表示补零到3位
+//
+// 除 {seq} 外的部分展开后作为序列作用域，因此默认格式下每个房间每月的序号从1开始。
+type Numbering struct {
+	pattern   string
+	prefix    string
+	allocator NumberAllocator
+}
+
+// NewNumbering 创建编号分配器，格式中必须包含且只能包含一个 {seq}
+func NewNumbering(pattern, prefix string, allocator NumberAllocator) (*Numbering, error) {
+	seqCount := 0
+	for _, m := range numberTokenPattern.FindAllStringSubmatch(pattern, -1) {
+		switch m[1] {
+		case "seq":
+			seqCount++
+			if m[2] != "" {
+				if width, _ := strconv.Atoi(m[2]); width > maxSeqWidth {
+					return nil, fmt.Errorf("编号格式中序号位数不能超过%d: %s", maxSeqWidth, m[0])
+				}
+			}
+		case "prefix", "room", "yyyy", "mm", "yyyymm", "yyyymmdd":
+			if m[2] != "" {
+				return nil, fmt.Errorf("编号格式中只有{seq}可以指定位数: %s", m[0])
+			}
+		default:
+			return nil, fmt.Errorf("编号格式中的占位符未知: %s", m[0])
+		}
+	}
+	if seqCount != 1 {
+		return nil, fmt.Errorf("编号格式必须包含一个{seq}: %s", pattern)
+	}
+
+	return &Numbering{
+		pattern:   pattern,
+		prefix:    prefix,
+		allocator: allocator,
+	}, nil
+}
+
+// Next 为收据分配新的编号
+func (n *Numbering) Next(data *model.ReceiptData) (string, error) {
+	scope, format, err := n.expand(data)
+	if err != nil {
+		return "", err
+	}
+	return n.allocator.AllocateNumber(scope, format)
+}
+
+// Preview 返回下一个可能分配的编号，不占用序号，仅用于预览
+func (n *Numbering) Preview(data *model.ReceiptData) (string, error) {
+	scope, format, err := n.expand(data)
+	if err != nil {
+		return "", err
+	}
+	seq, err := n.allocator.CurrentSequence(scope)
+	if err != nil {
+		return "", err
+	}
+	return format(seq + 1), nil
+}
+
+// expand 展开除序号外的占位符，返回序列作用域和按序号生成编号的函数
+//
+// 格式中用到的月份或日期无法识别时返回错误，不使用当前时间代替，避免编号落入错误的序列。
+func (n *Numbering) expand(data *model.ReceiptData) (string, func(seq int64) string, error) {
+	values := map[string]string{
+		"prefix": n.prefix,
+		"room":   data.RoomNumber,
+	}
+	for _, m := range numberTokenPattern.FindAllStringSubmatch(n.pattern, -1) {
+		switch m[1] {
+		case "yyyy", "mm", "yyyymm":
+			yearMonth, err := monthCode(data.Month)
+			if err != nil {
+				return "", nil, err
+			}
+			values["yyyy"], values["mm"], values["yyyymm"] = yearMonth[:4], yearMonth[4:], yearMonth
+		case "yyyymmdd":
+			date, err := dateCode(data.Date)
+			if err != nil {
+				return "", nil, err
+			}
+			values["yyyymmdd"] = date
+		}
+	}
+
+	expandTokens := func(text string) string {
+		return numberTokenPattern.ReplaceAllStringFunc(text, func(token string) string {
+			return values[numberTokenPattern.FindStringSubmatch(token)[1]]
+		})
+	}
+
+	// 以序号为界分别展开前后两部分，避免房间号等字段中的花括号被误当作占位符
+	var before, after string
+	seqWidth := 0
+	for _, loc := range numberTokenPattern.FindAllStringSubmatchIndex(n.pattern, -1) {
+		if n.pattern[loc[2]:loc[3]] == "seq" {
+			if loc[4] >= 0 {
+				seqWidth, _ = strconv.Atoi(n.pattern[loc[4]:loc[5]])
+			}
+			before, after = expandTokens(n.pattern[:loc[0]]), expandTokens(n.pattern[loc[1]:])
+			break
+		}
+	}
+
+	format := func(seq int64) string {
+		return fmt.Sprintf("%s%0*d%s", before, seqWidth, seq, after)
+	}
+	return before + "{seq}" + after, format, nil
+}
+
+// ErrNumberField 收据的月份或日期无法用于生成编号
+var ErrNumberField = errors.New("无法生成收据编号")
+
+// monthCode 将收据月份转换为 yyyymm，如"2025年9月"、"2025-09" -> "202509"
+func monthCode(month string) (string, error) {
+	code, err := model.NormalizeMonth(month)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNumberField, err)
+	}
+	return code, nil
+}
+
+// dateCode 将收据日期转换为 yyyymmdd，如"2025-09-21"、"2025年9月21日" -> "20250921"
+func dateCode(date string) (string, error) {
+	normalized, err := model.NormalizeDate(date)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNumberField, err)
+	}
+	return strings.ReplaceAll(normalized, "-", ""), nil
+}
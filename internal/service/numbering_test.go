@@ -0,0 +1,73 @@
+package service
+
+import (
+	"errors"
+	"receipt/internal/model"
+	"testing"
+)
+
+// memoryAllocator 内存中的编号序列
+type memoryAllocator map[string]int64
+
+func (a memoryAllocator) AllocateNumber(scope string, format func(seq int64) string) (string, error) {
+	a[scope]++
+	return format(a[scope]), nil
+}
+
+func (a memoryAllocator) CurrentSequence(scope string) (int64, error) {
+	return a[scope], nil
+}
+
+func TestNumberingMonthFormats(t *testing.T) {
+	numbering, err := NewNumbering(DefaultNumberPattern, DefaultNumberPrefix, memoryAllocator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		month string
+		want  string
+	}{
+		{"2025年9月", "NO101202509-001"},
+		{"2025年09月", "NO101202509-002"},
+		{"2025-09", "NO101202509-003"},
+		{"2025/9", "NO101202509-004"},
+		{"202510", "NO101202510-001"},
+	}
+	for _, tt := range tests {
+		got, err := numbering.Next(&model.ReceiptData{RoomNumber: "101", Month: tt.month})
+		if err != nil {
+			t.Fatalf("Next(%q): %v", tt.month, err)
+		}
+		if got != tt.want {
+			t.Errorf("Next(%q) = %q, want %q", tt.month, got, tt.want)
+		}
+	}
+
+	for _, month := range []string{"", "九月", "2025年13月", "2025-09房租"} {
+		if _, err := numbering.Next(&model.ReceiptData{RoomNumber: "101", Month: month}); !errors.Is(err, ErrNumberField) {
+			t.Errorf("Next(%q) error = %v, want ErrNumberField", month, err)
+		}
+	}
+}
+
+func TestNumberingDateFormats(t *testing.T) {
+	numbering, err := NewNumbering("{yyyymmdd}-{seq:02}", "", memoryAllocator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, date := range []string{"2025-09-21", "2025-9-21", "2025/09/21", "2025年9月21日", "20250921"} {
+		got, err := numbering.Preview(&model.ReceiptData{Date: date, Month: "无法识别"})
+		if err != nil {
+			t.Fatalf("Preview(%q): %v", date, err)
+		}
+		if got != "20250921-01" {
+			t.Errorf("Preview(%q) = %q, want %q", date, got, "20250921-01")
+		}
+	}
+
+	if _, err := numbering.Next(&model.ReceiptData{Date: "9月21日"}); !errors.Is(err, ErrNumberField) {
+		t.Errorf("Next error = %v, want ErrNumberField", err)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"receipt/internal/model"
+	"testing"
+	"time"
+)
+
+func TestNumberToChinese(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		{"0", "零元整"},
+		{"0.05", "零元伍分"},
+		{"0.29", "零元贰角玖分"},
+		{"1", "壹元整"},
+		{"10", "壹拾元整"},
+		{"15", "壹拾伍元整"},
+		{"101", "壹佰零壹元整"},
+		{"110", "壹佰壹拾元整"},
+		{"1001", "壹仟零壹元整"},
+		{"1010", "壹仟零壹拾元整"},
+		{"1500", "壹仟伍佰元整"},
+		{"1680.50", "壹仟陆佰捌拾元伍角"},
+		{"10000", "壹万元整"},
+		{"10001", "壹万零壹元整"},
+		{"10100", "壹万零壹佰元整"},
+		{"11000", "壹万壹仟元整"},
+		{"100000", "壹拾万元整"},
+		{"100010.05", "壹拾万零壹拾元零伍分"},
+		{"1000100", "壹佰万零壹佰元整"},
+		{"99999999.99", "玖仟玖佰玖拾玖万玖仟玖佰玖拾玖元玖角玖分"},
+		{"100000000", "壹亿元整"},
+		{"100000001", "壹亿零壹元整"},
+		{"100010000", "壹亿零壹万元整"},
+		{"110000000", "壹亿壹仟万元整"},
+		{"1000000000", "壹拾亿元整"},
+	}
+
+	for _, tt := range tests {
+		amount, err := model.ParseMoney(tt.amount)
+		if err != nil {
+			t.Fatalf("ParseMoney(%q): %v", tt.amount, err)
+		}
+		if got := NumberToChinese(amount); got != tt.want {
+			t.Errorf("NumberToChinese(%s) = %q, want %q", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestConvertReceiptToDataRejectsNegative(t *testing.T) {
+	tests := []struct {
+		name string
+		req  model.ReceiptRequest
+	}{
+		{"rent", model.ReceiptRequest{Rent: -500}},
+		{"item amount", model.ReceiptRequest{Items: []model.ReceiptItem{{Description: "押金退还", Amount: -500}}}},
+		{"item unit price", model.ReceiptRequest{Items: []model.ReceiptItem{{Description: "水费", Quantity: 2, UnitPrice: -350}}}},
+		{"item quantity", model.ReceiptRequest{Items: []model.ReceiptItem{{Description: "水费", Quantity: -2, UnitPrice: 350}}}},
+	}
+
+	for _, tt := range tests {
+		if _, err := ConvertReceiptToData(&tt.req); err == nil {
+			t.Errorf("%s: negative amount accepted", tt.name)
+		}
+	}
+}
+
+func TestConvertReceiptToDataNonMonth(t *testing.T) {
+	numbering, err := NewNumbering("{prefix}{room}-{seq:04}", DefaultNumberPrefix, memoryAllocator{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, month := range []string{"押金", "2025年9-10月", "2025年第三季度"} {
+		data, err := ConvertReceiptToData(&model.ReceiptRequest{Rent: 1500, RoomNumber: "101", Month: month})
+		if err != nil {
+			t.Fatalf("ConvertReceiptToData(%q): %v", month, err)
+		}
+		if data.Month != month {
+			t.Errorf("Month = %q, want %q", data.Month, month)
+		}
+		if want := "NO101" + time.Now().Format("200601"); data.ID != want {
+			t.Errorf("ID = %q, want %q", data.ID, want)
+		}
+
+		// 编号格式不用月份时不要求月份可识别
+		if _, err := numbering.Next(data); err != nil {
+			t.Errorf("Next(%q): %v", month, err)
+		}
+	}
+}
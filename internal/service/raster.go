@@ -0,0 +1,205 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"receipt/internal/model"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+// 图片渲染方式
+const (
+	RasterizerLayout = "layout" // 按版式直接绘制图片，纯Go实现
+	RasterizerMuPDF  = "mupdf"  // 生成PDF后使用MuPDF转换，需使用 -tags mupdf 构建
+)
+
+// ErrRasterUnsupported 当前图片渲染方式无法将收据渲染为图片
+var ErrRasterUnsupported = errors.New("不支持渲染为图片")
+
+// pdfRasterizers 将PDF每一页转换为图片的渲染方式，由构建标签启用的文件注册
+var pdfRasterizers = map[string]func(pdf []byte) ([]image.Image, error){}
+
+// copyGap 多联收据图片中各联之间的间隔（pt）
+const copyGap = 12
+
+// SetRasterizer 设置图片渲染方式
+//
+// layout 按与PDF相同的版式直接绘制，不依赖PDF渲染库，只支持按版式渲染的收据；
+// mupdf 先生成PDF再转换，可渲染AcroForm模板，需使用 -tags mupdf 构建。
+func (s *PDFService) SetRasterizer(name string) error {
+	if name != RasterizerLayout {
+		if _, ok := pdfRasterizers[name]; !ok {
+			return fmt.Errorf("不可用的图片渲染方式: %s，可用: %s", name, strings.Join(RasterizerNames(), ", "))
+		}
+	}
+	s.rasterizer = name
+	return nil
+}
+
+// RasterizerNames 返回当前构建可用的图片渲染方式
+func RasterizerNames() []string {
+	names := []string{RasterizerLayout}
+	for name := range pdfRasterizers {
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// rasterize 按配置的图片渲染方式将收据渲染为图片，stamps为叠加在收据上的印记
+//
+// 多联收据的各联从上到下排列在同一张图片中。
+func (s *PDFService) rasterize(data *model.ReceiptData, stamps []Stamp) (image.Image, error) {
+	if convert, ok := pdfRasterizers[s.rasterizer]; ok {
+		pdfBytes, err := s.renderPDF(data, stamps)
+		if err != nil {
+			return nil, err
+		}
+		pages, err := convert(pdfBytes)
+		if err != nil {
+			return nil, err
+		}
+		return stackImages(pages), nil
+	}
+
+	r, err := s.renderer(data)
+	if err != nil {
+		return nil, err
+	}
+	layoutRenderer, ok := r.(*gopdfRenderer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s渲染的收据没有版式，请使用PDF格式", ErrRasterUnsupported, r.Name())
+	}
+
+	layout := layoutRenderer.pageLayout()
+	scale := float64(rasterDPI) / 72
+	var pages []image.Image
+	for i, name := range receiptCopies(data) {
+		img, err := s.rasterizeLayout(layout, data, name)
+		if err != nil {
+			return nil, err
+		}
+
+		// 与PDF一致，签章文字只出现在第一联，印记出现在每一联
+		if s.signer != nil && i == 0 {
+			// 图片无法携带数字签名，只绘制与PDF相同的签章文字
+			if rect, ok := layoutRenderer.sealRect(data); ok {
+				if err := drawSignatureImage(img, s.signatureText(), rect, scale); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, stamp := range stamps {
+			if err := drawStampImage(img, stamp, scale); err != nil {
+				return nil, err
+			}
+		}
+		pages = append(pages, img)
+	}
+	return stackImages(pages), nil
+}
+
+// stackImages 将多页图片从上到下排列为一张图片，页与页之间留白
+func stackImages(pages []image.Image) image.Image {
+	if len(pages) == 1 {
+		return pages[0]
+	}
+
+	gap := rasterSize(copyGap, float64(rasterDPI)/72)
+	width, height := 0, gap*(len(pages)-1)
+	for _, page := range pages {
+		width = max(width, page.Bounds().Dx())
+		height += page.Bounds().Dy()
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	y := 0
+	for _, page := range pages {
+		b := page.Bounds()
+		draw.Draw(img, image.Rect(0, y, b.Dx(), y+b.Dy()), page, b.Min, draw.Src)
+		y += b.Dy() + gap
+	}
+	return img
+}
+
+// encodeImage 将图片按输出格式编码后写入w
+func encodeImage(w io.Writer, img image.Image, format string) error {
+	var err error
+	switch format {
+	case FormatPNG:
+		err = png.Encode(w, img)
+	case FormatJPEG:
+		err = jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	default:
+		return fmt.Errorf("不支持的图片格式: %s", format)
+	}
+	if err != nil {
+		return fmt.Errorf("编码图片失败: %v", err)
+	}
+	return nil
+}
+
+var (
+	rasterFontsMu sync.Mutex
+	rasterFonts   = make(map[string]*truetype.Font) // 字体文件路径 -> 解析后的字体
+)
+
+// loadRasterFont 读取并解析TrueType字体，解析结果按路径缓存
+func loadRasterFont(path string) (*truetype.Font, error) {
+	rasterFontsMu.Lock()
+	defer rasterFontsMu.Unlock()
+
+	if f, ok := rasterFonts[path]; ok {
+		return f, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取字体文件失败: %v", err)
+	}
+	f, err := truetype.Parse(content)
+	if err != nil {
+		return nil, fmt.Errorf("解析字体失败: %v", err)
+	}
+
+	rasterFonts[path] = f
+	return f, nil
+}
+
+// drawSignatureImage 在签章位置绘制与PDF可见签名相同的文字，每行一条，7pt红色
+func drawSignatureImage(img *image.RGBA, text string, rect SignatureRect, scale float64) error {
+	f, err := loadRasterFont(chineseFontPath)
+	if err != nil {
+		return err
+	}
+
+	const points = 7
+	face := truetype.NewFace(f, &truetype.Options{Size: points, DPI: rasterDPI})
+	defer face.Close()
+
+	// 与pdfcpu相同逐行排列，行高为上行高度与下行高度之和
+	ascent, descent := stampMetrics(f, points)
+	lineHeight := ascent + descent
+	col, _ := parseColor("#C00000")
+	d := &font.Drawer{Dst: img, Src: image.NewUniform(col), Face: face}
+	for i, line := range strings.Split(text, "\n") {
+		baseline := rect.Y + 4 + lineHeight*float64(i+1) - math.Ceil(descent)
+		d.Dot = fixed.P(int(math.Round((rect.X+4)*scale)), int(math.Round(baseline*scale)))
+		d.DrawString(line)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build mupdf
+
+package service
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/gen2brain/go-fitz"
+)
+
+func init() {
+	pdfRasterizers[RasterizerMuPDF] = rasterizeMuPDF
+}
+
+// rasterizeMuPDF 使用MuPDF将PDF的每一页渲染为图片
+func rasterizeMuPDF(pdf []byte) ([]image.Image, error) {
+	doc, err := fitz.NewFromMemory(pdf)
+	if err != nil {
+		return nil, fmt.Errorf("打开PDF文档失败: %v", err)
+	}
+	defer doc.Close()
+
+	pages := make([]image.Image, doc.NumPage())
+	for i := range pages {
+		if pages[i], err = doc.ImageDPI(i, rasterDPI); err != nil {
+			return nil, fmt.Errorf("获取PDF页面图片失败: %v", err)
+		}
+	}
+	return pages, nil
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"fmt"
+	"receipt/internal/model"
+	"strconv"
+	"strings"
+)
+
+// buildItems 校验收费明细并计算合计金额
+func buildItems(items []model.ReceiptItem) ([]model.ReceiptItemData, model.Money, error) {
+	result := make([]model.ReceiptItemData, 0, len(items))
+	var total model.Money
+
+	for i, item := range items {
+		quantity := item.Quantity
+		if quantity == 0 {
+			quantity = 1
+		}
+
+		amount := item.Amount
+		unitPrice := item.UnitPrice
+		if quantity < 0 || unitPrice < 0 || amount < 0 {
+			return nil, 0, fmt.Errorf("第%d项%s的数量、单价和金额不能为负数", i+1, item.Description)
+		}
+		switch {
+		case unitPrice != 0 && amount != 0:
+			if computed := unitPrice.MulQuantity(quantity); computed != amount {
+				return nil, 0, fmt.Errorf("第%d项%s金额%s与数量×单价%s不一致",
+					i+1, item.Description, amount, computed)
+			}
+		case unitPrice != 0:
+			amount = unitPrice.MulQuantity(quantity)
+		case amount != 0:
+			unitPrice = amount.DivQuantity(quantity)
+		default:
+			return nil, 0, fmt.Errorf("第%d项%s缺少单价或金额", i+1, item.Description)
+		}
+
+		total += amount
+		result = append(result, model.ReceiptItemData{
+			Description: item.Description,
+			Quantity:    strconv.FormatFloat(quantity, 'f', -1, 64),
+			UnitPrice:   unitPrice,
+			Amount:      amount,
+		})
+	}
+
+	return result, total, nil
+}
+
+// itemsPurpose 由收费明细生成收费目的，如 "房租、水费、电费"
+func itemsPurpose(items []model.ReceiptItemData) string {
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Description)
+	}
+	return strings.Join(names, "、")
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"receipt/internal/model"
+	"sort"
+	"strings"
+)
+
+// 渲染后端名称
+const (
+	RendererGopdf    = "gopdf"    // 使用gopdf从头绘制
+	RendererAcroForm = "acroform" // 使用pdfcpu填充AcroForm模板
+)
+
+// ErrCopiesUnsupported 渲染后端不支持多联收据
+var ErrCopiesUnsupported = errors.New("不支持多联收据")
+
+// Renderer 收据PDF渲染后端
+type Renderer interface {
+	// Name 返回渲染后端名称
+	Name() string
+	// Render 将收据数据渲染为PDF并写入w
+	Render(w io.Writer, data *model.ReceiptData) error
+}
+
+// sealLocator 可以给出盖章位置的渲染后端，签名时可见签名放在该位置
+type sealLocator interface {
+	sealRect(data *model.ReceiptData) (SignatureRect, bool)
+}
+
+// gopdfRenderer 使用gopdf按版式绘制收据
+type gopdfRenderer struct {
+	service *PDFService
+	layout  *Layout // 为空时使用服务的默认版式
+}
+
+func (r *gopdfRenderer) Name() string {
+	return RendererGopdf
+}
+
+func (r *gopdfRenderer) Render(w io.Writer, data *model.ReceiptData) error {
+	return r.service.generateSimplePDF(data, r.pageLayout(), w)
+}
+
+// pageLayout 返回渲染使用的版式
+func (r *gopdfRenderer) pageLayout() *Layout {
+	if r.layout == nil {
+		return r.service.layout
+	}
+	return r.layout
+}
+
+// sealRect 将可见签名放在版式中"盖章"文字的下方
+func (r *gopdfRenderer) sealRect(data *model.ReceiptData) (SignatureRect, bool) {
+	layout := r.pageLayout()
+	elements, _ := layout.arrange(data)
+	for _, e := range elements {
+		if e.Type != ElementText || !strings.Contains(e.Text, "盖章") {
+			continue
+		}
+		rect := SignatureRect{W: 110, H: 40}
+		rect.X = e.X + e.FontSize*1.5 - rect.W/2
+		if limit := layout.Width - rect.W - 10; rect.X > limit {
+			rect.X = limit
+		}
+		rect.Y = e.Y + 6
+		return rect, true
+	}
+	return SignatureRect{}, false
+}
+
+// RegisterRenderer 注册渲染后端，同名后端会被覆盖
+func (s *PDFService) RegisterRenderer(r Renderer) {
+	s.renderers[r.Name()] = r
+}
+
+// SetDefaultRenderer 设置默认渲染后端
+func (s *PDFService) SetDefaultRenderer(name string) error {
+	if _, ok := s.renderers[name]; !ok {
+		return fmt.Errorf("未知的渲染后端: %s", name)
+	}
+	s.defaultRenderer = name
+	return nil
+}
+
+// RendererNames 返回已注册的渲染后端名称
+func (s *PDFService) RendererNames() []string {
+	names := make([]string, 0, len(s.renderers))
+	for name := range s.renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// renderer 为收据选择渲染后端
+//
+// 优先级：请求指定的模板 > 请求指定的渲染后端 > 模板库的默认模板 > 默认渲染后端。
+// 实际使用的模板或渲染后端会写回 data，登记后补打时可使用相同的模板。
+func (s *PDFService) renderer(data *model.ReceiptData) (Renderer, error) {
+	if data.Template != "" {
+		if s.templates == nil {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, data.Template)
+		}
+		return s.templates.renderer(data.Template)
+	}
+
+	name := data.Renderer
+	if name == "" && s.templates != nil {
+		if defaultTemplate := s.templates.Default(); defaultTemplate != "" {
+			data.Template = defaultTemplate
+			return s.templates.renderer(defaultTemplate)
+		}
+	}
+	if name == "" {
+		name = s.defaultRenderer
+	}
+
+	r, ok := s.renderers[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的渲染后端: %s", name)
+	}
+	data.Renderer = name
+	return r, nil
+}
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"receipt/internal/model"
+	"receipt/internal/storage"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultRetentionInterval 默认的备份清理间隔
+const DefaultRetentionInterval = 24 * time.Hour
+
+// archivePrefix 月度压缩包所在的目录，压缩包命名为 yyyy-mm.zip
+const archivePrefix = "archive/"
+
+// Janitor 按保留策略清理收据备份：删除过期和被替代的备份，将较早的备份归档到月度压缩包
+type Janitor struct {
+	backups *BackupStore
+	policy  model.RetentionPolicy
+	mu      sync.Mutex // 同一时间只执行一次清理
+}
+
+// NewJanitor 创建备份清理器
+func NewJanitor(backups *BackupStore, policy model.RetentionPolicy) (*Janitor, error) {
+	if policy.KeepYears < 0 || policy.ArchiveMonths < 0 {
+		return nil, fmt.Errorf("保留年限和归档期限不能为负数")
+	}
+	if policy.KeepYears > 0 && policy.ArchiveMonths >= policy.KeepYears*12 {
+		return nil, fmt.Errorf("归档期限（%d个月）必须短于保留年限（%d年）", policy.ArchiveMonths, policy.KeepYears)
+	}
+	return &Janitor{backups: backups, policy: policy}, nil
+}
+
+// Policy 返回保留策略
+func (j *Janitor) Policy() model.RetentionPolicy {
+	return j.policy
+}
+
+// Start 每隔interval执行一次清理，启动时先执行一次；未启用任何保留规则时不执行
+func (j *Janitor) Start(interval time.Duration) {
+	if !j.policy.Enabled() {
+		return
+	}
+	go func() {
+		for {
+			report, err := j.Run(time.Now())
+			if err != nil {
+				log.Printf("警告：清理备份失败: %v", err)
+			} else {
+				if report.Deleted > 0 || report.Archived > 0 {
+					log.Printf("清理备份：删除%d个文件，归档%d个文件", report.Deleted, report.Archived)
+				}
+				for _, e := range report.Errors {
+					log.Printf("警告：清理备份失败: %s", e)
+				}
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// Plan 预演保留策略，返回将被删除和归档的备份，不修改任何文件
+func (j *Janitor) Plan(now time.Time) (*model.RetentionReport, error) {
+	entries, bundles, err := j.list()
+	if err != nil {
+		return nil, err
+	}
+	report := j.plan(entries, bundles, now)
+	report.DryRun = true
+	return report, nil
+}
+
+// Run 执行保留策略：先写入月度压缩包再删除原文件，出错的文件保留，下次清理时重试
+func (j *Janitor) Run(now time.Time) (*model.RetentionReport, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries, bundleObjects, err := j.list()
+	if err != nil {
+		return nil, err
+	}
+	planned := j.plan(entries, bundleObjects, now)
+
+	report := &model.RetentionReport{
+		Policy:    planned.Policy,
+		CheckedAt: planned.CheckedAt,
+		Scanned:   planned.Scanned,
+		Kept:      planned.Kept,
+		Actions:   []*model.RetentionAction{},
+	}
+	done := func(action *model.RetentionAction) {
+		report.Actions = append(report.Actions, action)
+	}
+	failed := func(action *model.RetentionAction, err error) {
+		report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", action.Key, err))
+		report.Kept++
+	}
+
+	// 归档：同一压缩包的文件一起写入
+	bundles := map[string][]*model.RetentionAction{}
+	var bundleKeys []string
+	for _, action := range planned.Actions {
+		if action.Action != model.RetentionArchive {
+			continue
+		}
+		if _, ok := bundles[action.Bundle]; !ok {
+			bundleKeys = append(bundleKeys, action.Bundle)
+		}
+		bundles[action.Bundle] = append(bundles[action.Bundle], action)
+	}
+	for _, bundle := range bundleKeys {
+		actions := bundles[bundle]
+		if err := j.archive(bundle, actions); err != nil {
+			for _, action := range actions {
+				failed(action, err)
+			}
+			continue
+		}
+		for _, action := range actions {
+			if err := j.backups.Delete(action.Key); err != nil {
+				failed(action, err)
+				continue
+			}
+			done(action)
+		}
+	}
+
+	for _, action := range planned.Actions {
+		if action.Action != model.RetentionDelete {
+			continue
+		}
+		var err error
+		if strings.HasPrefix(action.Key, archivePrefix) {
+			err = j.backups.files.Delete(action.Key)
+		} else {
+			err = j.backups.Delete(action.Key)
+		}
+		if err != nil {
+			failed(action, err)
+			continue
+		}
+		done(action)
+	}
+
+	sortRetentionActions(report.Actions)
+	tallyRetention(report)
+	return report, nil
+}
+
+// plan 按保留策略决定每个文件的处理方式
+//
+// 超过保留年限的文件删除；同一收据编号有更新备份的删除；其余生成月份早于归档期限的归档。
+// 月度压缩包只按保留年限整体删除。
+func (j *Janitor) plan(entries []*model.BackupEntry, bundles []storage.ObjectInfo, now time.Time) *model.RetentionReport {
+	report := &model.RetentionReport{
+		Policy:    j.policy,
+		CheckedAt: now,
+		Scanned:   len(entries) + len(bundles),
+		Actions:   []*model.RetentionAction{},
+	}
+
+	var expireBefore, archiveBefore time.Time
+	if j.policy.KeepYears > 0 {
+		expireBefore = now.AddDate(-j.policy.KeepYears, 0, 0)
+	}
+	if j.policy.ArchiveMonths > 0 {
+		year, month, _ := now.Date()
+		archiveBefore = time.Date(year, month-time.Month(j.policy.ArchiveMonths)+1, 1, 0, 0, 0, 0, now.Location())
+	}
+
+	// 整个月份都超过保留年限时删除压缩包
+	for _, bundle := range bundles {
+		month, ok := parseBundleMonth(bundle.Key, now.Location())
+		if ok && !expireBefore.IsZero() && !month.AddDate(0, 1, 0).After(expireBefore) {
+			report.Actions = append(report.Actions, &model.RetentionAction{
+				Key:      bundle.Key,
+				Action:   model.RetentionDelete,
+				Reason:   model.RetentionExpired,
+				IssuedAt: month,
+				Size:     bundle.Size,
+			})
+		}
+	}
+
+	backups := make([]*model.RetentionAction, len(entries))
+	latest := map[string]*model.RetentionAction{}
+	for i, entry := range entries {
+		backup := &model.RetentionAction{
+			Key:       entry.Name,
+			ReceiptID: entry.ReceiptID,
+			IssuedAt:  entry.IssuedAt,
+			Size:      entry.Size,
+		}
+		if prev := latest[entry.ReceiptID]; prev == nil || newerBackup(backup, prev) {
+			latest[entry.ReceiptID] = backup
+		}
+		backups[i] = backup
+	}
+
+	for _, backup := range backups {
+		switch {
+		case !expireBefore.IsZero() && backup.IssuedAt.Before(expireBefore):
+			backup.Action, backup.Reason = model.RetentionDelete, model.RetentionExpired
+		case j.policy.KeepLatest && latest[backup.ReceiptID] != backup:
+			backup.Action, backup.Reason = model.RetentionDelete, model.RetentionSuperseded
+		case !archiveBefore.IsZero() && backup.IssuedAt.Before(archiveBefore):
+			backup.Action, backup.Reason = model.RetentionArchive, model.RetentionArchived
+			backup.Bundle = archivePrefix + backup.IssuedAt.In(now.Location()).Format("2006-01") + ".zip"
+		default:
+			continue
+		}
+		report.Actions = append(report.Actions, backup)
+	}
+
+	sortRetentionActions(report.Actions)
+	tallyRetention(report)
+	report.Kept = report.Scanned - report.Deleted - report.Archived
+	return report
+}
+
+// archive 将文件追加到月度压缩包，压缩包中已有的同名文件不重复写入
+func (j *Janitor) archive(bundle string, actions []*model.RetentionAction) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	existing := map[string]bool{}
+
+	files := j.backups.files
+	content, err := storage.ReadAll(files, bundle)
+	switch {
+	case err == nil:
+		zr, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+		if err != nil {
+			return fmt.Errorf("读取压缩包%s失败: %v", bundle, err)
+		}
+		for _, f := range zr.File {
+			if err := zw.Copy(f); err != nil {
+				return fmt.Errorf("读取压缩包%s失败: %v", bundle, err)
+			}
+			existing[f.Name] = true
+		}
+	case !errors.Is(err, storage.ErrNotExist):
+		return err
+	}
+
+	for _, action := range actions {
+		if existing[action.Key] {
+			continue
+		}
+		entry, err := j.backups.Get(action.Key)
+		if err != nil {
+			return err
+		}
+		content, err := j.backups.Read(entry)
+		if err != nil {
+			return err
+		}
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     action.Key,
+			Method:   zip.Deflate,
+			Modified: action.IssuedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(content); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return files.Put(bundle, buf.Bytes())
+}
+
+// list 读取备份清单和月度压缩包
+func (j *Janitor) list() ([]*model.BackupEntry, []storage.ObjectInfo, error) {
+	entries, err := j.backups.List()
+	if err != nil {
+		return nil, nil, err
+	}
+	bundles, err := j.backups.files.List(archivePrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	return entries, bundles, nil
+}
+
+// parseBundleMonth 从压缩包名 archive/yyyy-mm.zip 中解析月份
+func parseBundleMonth(key string, loc *time.Location) (time.Time, bool) {
+	name := strings.TrimPrefix(key, archivePrefix)
+	if path.Ext(name) != ".zip" {
+		return time.Time{}, false
+	}
+	month, err := time.ParseInLocation("2006-01", strings.TrimSuffix(name, ".zip"), loc)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return month, true
+}
+
+// newerBackup a是否比b更新，生成时间相同时按文件名
+func newerBackup(a, b *model.RetentionAction) bool {
+	if !a.IssuedAt.Equal(b.IssuedAt) {
+		return a.IssuedAt.After(b.IssuedAt)
+	}
+	return a.Key > b.Key
+}
+
+func sortRetentionActions(actions []*model.RetentionAction) {
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].Key < actions[j].Key
+	})
+}
+
+// tallyRetention 统计删除和归档的文件数及大小
+func tallyRetention(report *model.RetentionReport) {
+	report.Deleted, report.Archived, report.FreedSize = 0, 0, 0
+	for _, action := range report.Actions {
+		if action.Action == model.RetentionArchive {
+			report.Archived++
+		} else {
+			report.Deleted++
+		}
+		report.FreedSize += action.Size
+	}
+}
@@ -0,0 +1,291 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 印章图片类型
+const (
+	SealKindCompany   = "company"   // 公章
+	SealKindFinance   = "finance"   // 财务专用章
+	SealKindSignature = "signature" // 经手人签名
+)
+
+// SealKinds 全部印章图片类型
+var SealKinds = []string{SealKindCompany, SealKindFinance, SealKindSignature}
+
+// SealKindName 返回印章图片类型的中文名称，未知类型返回空字符串
+func SealKindName(kind string) string {
+	switch kind {
+	case SealKindCompany:
+		return "公章"
+	case SealKindFinance:
+		return "财务专用章"
+	case SealKindSignature:
+		return "签名"
+	}
+	return ""
+}
+
+// maxSealPixels 印章图片的最大边长（像素）
+const maxSealPixels = 2000
+
+var (
+	ErrSealNotFound = errors.New("印章图片不存在")
+	ErrSealExists   = errors.New("印章图片已存在")
+)
+
+// Seal 已登记的印章或签名图片
+type Seal struct {
+	Owner     string    `json:"owner"` // 所有者：收款人姓名或出租方名称
+	Kind      string    `json:"kind"`  // company | finance | signature
+	KindName  string    `json:"kind_name"`
+	Width     int       `json:"width"`  // 像素宽度
+	Height    int       `json:"height"` // 像素高度
+	FileSize  int64     `json:"file_size"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	path    string
+	content []byte
+	image   image.Image
+}
+
+// Path 返回印章图片文件路径
+func (s *Seal) Path() string {
+	return s.path
+}
+
+// SealRegistry 印章图片库，图片以 <所有者>/<类型>.png 的形式保存在目录中
+//
+// 所有者可以是收款人（经手人签名）或出租方（公章、财务专用章），版式中的seal元素
+// 按所有者和类型查找图片。
+type SealRegistry struct {
+	dir string
+
+	mu    sync.RWMutex
+	seals map[string]*Seal // <所有者>/<类型> -> 图片
+}
+
+// LoadSeals 加载印章目录并挂载到PDF服务，版式中的seal元素将从该图片库取图
+func (s *PDFService) LoadSeals(dir string) (*SealRegistry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建印章目录失败: %v", err)
+	}
+
+	r := &SealRegistry{
+		dir:   dir,
+		seals: make(map[string]*Seal),
+	}
+
+	owners, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取印章目录失败: %v", err)
+	}
+	for _, owner := range owners {
+		if !owner.IsDir() || validateSealOwner(owner.Name()) != nil {
+			continue
+		}
+		for _, kind := range SealKinds {
+			seal, err := r.load(owner.Name(), kind)
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				log.Printf("警告：跳过无法加载的印章图片%s/%s.png: %v", owner.Name(), kind, err)
+				continue
+			}
+			r.seals[sealKey(owner.Name(), kind)] = seal
+		}
+	}
+
+	s.seals = r
+	return r, nil
+}
+
+// List 返回全部印章图片，按所有者和类型排序
+func (r *SealRegistry) List() []*Seal {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*Seal, 0, len(r.seals))
+	for _, seal := range r.seals {
+		list = append(list, seal)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Owner != list[j].Owner {
+			return list[i].Owner < list[j].Owner
+		}
+		return list[i].Kind < list[j].Kind
+	})
+	return list
+}
+
+// Get 按所有者和类型获取印章图片
+func (r *SealRegistry) Get(owner, kind string) (*Seal, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seal, ok := r.seals[sealKey(owner, kind)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s/%s", ErrSealNotFound, owner, kind)
+	}
+	return seal, nil
+}
+
+// Save 校验并保存印章图片，图片须为PNG，透明背景的图片叠加效果最好；
+// overwrite为false时已存在的图片返回 ErrSealExists
+func (r *SealRegistry) Save(owner, kind string, content []byte, overwrite bool) (*Seal, error) {
+	if err := validateSealOwner(owner); err != nil {
+		return nil, err
+	}
+	if SealKindName(kind) == "" {
+		return nil, fmt.Errorf("印章类型未知: %s", kind)
+	}
+	if _, err := decodeSeal(content); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := sealKey(owner, kind)
+	if _, exists := r.seals[key]; exists && !overwrite {
+		return nil, fmt.Errorf("%w: %s", ErrSealExists, key)
+	}
+
+	if err := os.MkdirAll(filepath.Join(r.dir, owner), 0755); err != nil {
+		return nil, fmt.Errorf("创建印章目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, owner, kind+".png"), content, 0644); err != nil {
+		return nil, fmt.Errorf("保存印章图片失败: %v", err)
+	}
+
+	seal, err := r.load(owner, kind)
+	if err != nil {
+		return nil, err
+	}
+	r.seals[key] = seal
+	return seal, nil
+}
+
+// Delete 删除印章图片，所有者目录为空时一并删除
+func (r *SealRegistry) Delete(owner, kind string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := sealKey(owner, kind)
+	seal, ok := r.seals[key]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrSealNotFound, key)
+	}
+
+	if err := os.Remove(seal.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除印章图片失败: %v", err)
+	}
+	os.Remove(filepath.Join(r.dir, owner)) // 目录非空时删除失败，忽略
+	delete(r.seals, key)
+	return nil
+}
+
+// lookup 按所有者顺序查找第一个已登记的印章图片，每个所有者按kinds顺序查找类型
+func (r *SealRegistry) lookup(owners, kinds []string) (*Seal, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, owner := range owners {
+		if owner == "" {
+			continue
+		}
+		for _, kind := range kinds {
+			if seal, ok := r.seals[sealKey(owner, kind)]; ok {
+				return seal, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// load 从印章目录加载单个图片
+func (r *SealRegistry) load(owner, kind string) (*Seal, error) {
+	path := filepath.Join(r.dir, owner, kind+".png")
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取印章图片失败: %v", err)
+	}
+	img, err := decodeSeal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Seal{
+		Owner:     owner,
+		Kind:      kind,
+		KindName:  SealKindName(kind),
+		Width:     img.Bounds().Dx(),
+		Height:    img.Bounds().Dy(),
+		FileSize:  info.Size(),
+		UpdatedAt: info.ModTime(),
+		path:      path,
+		content:   content,
+		image:     img,
+	}, nil
+}
+
+// decodeSeal 解码并校验印章PNG图片
+func decodeSeal(content []byte) (image.Image, error) {
+	config, err := png.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("印章图片须为PNG格式: %v", err)
+	}
+	if config.Width > maxSealPixels || config.Height > maxSealPixels {
+		return nil, fmt.Errorf("印章图片尺寸过大: %d×%d，最大%d像素", config.Width, config.Height, maxSealPixels)
+	}
+
+	img, err := png.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("解码印章图片失败: %v", err)
+	}
+	return img, nil
+}
+
+// validateSealOwner 校验所有者名称，所有者名称用作目录名，不允许路径分隔符和控制字符
+func validateSealOwner(owner string) error {
+	if owner == "" || utf8.RuneCountInString(owner) > 64 || !utf8.ValidString(owner) {
+		return fmt.Errorf("所有者名称无效: %q", owner)
+	}
+	if strings.HasPrefix(owner, ".") || strings.ContainsAny(owner, `/\:*?"<>|`) {
+		return fmt.Errorf("所有者名称无效: %q", owner)
+	}
+	for _, r := range owner {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("所有者名称无效: %q", owner)
+		}
+	}
+	return nil
+}
+
+// sealKey 返回印章图片在图片库中的键
+func sealKey(owner, kind string) string {
+	return owner + "/" + kind
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/hhrutter/pkcs7"
+)
+
+// SignatureVerification PDF中单个签名的校验结果
+type SignatureVerification struct {
+	Signer       string    `json:"signer"`                 // 签名人，证书主题的通用名称
+	Organization string    `json:"organization,omitempty"` // 签名人所属组织
+	Issuer       string    `json:"issuer"`                 // 证书颁发者
+	SerialNumber string    `json:"serial_number"`          // 证书序列号
+	SigningTime  time.Time `json:"signing_time,omitempty"` // 签名时间
+	NotBefore    time.Time `json:"not_before"`             // 证书有效期起
+	NotAfter     time.Time `json:"not_after"`              // 证书有效期止
+
+	Valid          bool   `json:"valid"`            // 签名与签名范围内的字节一致
+	CoversWholePDF bool   `json:"covers_whole_pdf"` // 签名范围覆盖整个文件，即签名后未追加内容
+	Altered        bool   `json:"altered"`          // 签名后文件被修改
+	Trusted        bool   `json:"trusted"`          // 由本服务配置的签名证书签署
+	Problem        string `json:"problem,omitempty"`
+
+	certificate *x509.Certificate // 签名中的签名证书
+}
+
+// ErrNotSigned PDF中没有签名
+var ErrNotSigned = errors.New("PDF中没有数字签名")
+
+// byteRangePattern 匹配签名字典中的ByteRange
+var byteRangePattern = regexp.MustCompile(`/ByteRange\s*\[\s*(\d+)\s+(\d+)\s+(\d+)\s+(\d+)\s*\]`)
+
+// VerifyPDFSignatures 校验PDF中的全部PKCS#7签名
+//
+// 逐个查找签名字典的ByteRange，按范围取出签名覆盖的字节和签名值进行校验；只校验签名数据本身，
+// 不校验证书链是否可信。
+func VerifyPDFSignatures(pdf []byte) ([]SignatureVerification, error) {
+	matches := byteRangePattern.FindAllSubmatch(pdf, -1)
+	if len(matches) == 0 {
+		return nil, ErrNotSigned
+	}
+
+	results := make([]SignatureVerification, 0, len(matches))
+	for _, m := range matches {
+		var r [4]int
+		for i := range r {
+			r[i], _ = strconv.Atoi(string(m[i+1]))
+		}
+		results = append(results, verifyByteRange(pdf, r))
+	}
+	return results, nil
+}
+
+func verifyByteRange(pdf []byte, r [4]int) SignatureVerification {
+	result := SignatureVerification{Altered: true}
+
+	if r[0] != 0 || r[1] <= 0 || r[2] <= r[1] || r[3] < 0 || r[2]+r[3] > len(pdf) {
+		result.Problem = "签名范围无效"
+		return result
+	}
+	result.CoversWholePDF = r[2]+r[3] == len(pdf)
+
+	contents := bytes.TrimSpace(pdf[r[1]:r[2]])
+	if len(contents) < 2 || contents[0] != '<' || contents[len(contents)-1] != '>' {
+		result.Problem = "签名值无效"
+		return result
+	}
+	der, err := hex.DecodeString(string(contents[1 : len(contents)-1]))
+	if err != nil {
+		result.Problem = "签名值无效"
+		return result
+	}
+	if n := derLength(der); n > 0 && n <= len(der) {
+		der = der[:n]
+	}
+
+	p7, err := pkcs7.Parse(der)
+	if err != nil {
+		result.Problem = fmt.Sprintf("解析签名失败: %v", err)
+		return result
+	}
+	if cert := p7.GetOnlySigner(); cert != nil {
+		result.certificate = cert
+		result.Signer = certificateName(cert)
+		if len(cert.Subject.Organization) > 0 {
+			result.Organization = cert.Subject.Organization[0]
+		}
+		result.Issuer = cert.Issuer.String()
+		result.SerialNumber = cert.SerialNumber.Text(16)
+		result.NotBefore = cert.NotBefore
+		result.NotAfter = cert.NotAfter
+	}
+	var signingTime time.Time
+	if err := p7.UnmarshalSignedAttribute(pkcs7.OIDAttributeSigningTime, &signingTime); err == nil {
+		result.SigningTime = signingTime
+	}
+
+	signed := make([]byte, 0, r[1]+r[3])
+	signed = append(signed, pdf[:r[1]]...)
+	signed = append(signed, pdf[r[2]:r[2]+r[3]]...)
+	p7.Content = signed
+	if err := p7.Verify(); err != nil {
+		var mismatch *pkcs7.MessageDigestMismatchError
+		if errors.As(err, &mismatch) {
+			result.Problem = "签名后的内容已被修改"
+		} else {
+			result.Problem = fmt.Sprintf("签名校验失败: %v", err)
+		}
+		return result
+	}
+
+	result.Valid = true
+	result.Altered = !result.CoversWholePDF
+	if result.Altered {
+		result.Problem = "签名后文件末尾追加了内容"
+	}
+	return result
+}
+
+// derLength 返回DER编码的完整长度，签名值末尾补齐的0不计入
+func derLength(der []byte) int {
+	if len(der) < 2 {
+		return 0
+	}
+	n := int(der[1])
+	if n < 0x80 {
+		return 2 + n
+	}
+	octets := n & 0x7f
+	if octets == 0 || octets > 4 || len(der) < 2+octets {
+		return 0
+	}
+	n = 0
+	for _, b := range der[2 : 2+octets] {
+		n = n<<8 | int(b)
+	}
+	return 2 + octets + n
+}
+
+// VerifyReceipt 校验收据PDF的数字签名，由本服务签名证书签署的签名标记为可信
+func (s *PDFService) VerifyReceipt(pdf []byte) ([]SignatureVerification, error) {
+	results, err := VerifyPDFSignatures(pdf)
+	if err != nil {
+		return nil, err
+	}
+	if s.signer == nil {
+		return results, nil
+	}
+
+	// 比较完整的证书而不是序列号和颁发者：任何人都可以自签一张序列号和颁发者相同的证书
+	cert := s.signer.Certificate()
+	for i := range results {
+		results[i].Trusted = results[i].Valid &&
+			results[i].certificate != nil && results[i].certificate.Equal(cert)
+	}
+	return results, nil
+}
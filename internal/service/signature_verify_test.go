@@ -0,0 +1,90 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/signintech/gopdf"
+)
+
+// newTestSigner 创建自签名证书的签名器，serial和subject相同的两张证书只有密钥不同
+func newTestSigner(t *testing.T, serial int64, subject pkix.Name) *Signer {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := newSigner(cert, nil, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+func blankPDF(t *testing.T) []byte {
+	t.Helper()
+	pdf := &gopdf.GoPdf{}
+	pdf.Start(gopdf.Config{PageSize: *gopdf.PageSizeA5})
+	pdf.AddPage()
+	return pdf.GetBytesPdf()
+}
+
+func TestVerifyReceiptTrust(t *testing.T) {
+	subject := pkix.Name{CommonName: "幸福物业", Organization: []string{"幸福物业"}}
+	ours := newTestSigner(t, 1001, subject)
+	forged := newTestSigner(t, 1001, subject)
+	s := &PDFService{signer: ours}
+
+	tests := []struct {
+		name    string
+		signer  *Signer
+		trusted bool
+	}{
+		{"ours", ours, true},
+		{"same serial and issuer, different key", forged, false},
+	}
+	for _, tt := range tests {
+		signed, err := tt.signer.Sign(blankPDF(t), SignatureRect{X: 20, Y: 20, W: 120, H: 40}, "收据")
+		if err != nil {
+			t.Fatalf("%s: Sign: %v", tt.name, err)
+		}
+		results, err := s.VerifyReceipt(signed)
+		if err != nil {
+			t.Fatalf("%s: VerifyReceipt: %v", tt.name, err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: got %d signatures, want 1", tt.name, len(results))
+		}
+		r := results[0]
+		if !r.Valid {
+			t.Errorf("%s: signature invalid: %s", tt.name, r.Problem)
+		}
+		if r.SerialNumber != ours.Certificate().SerialNumber.Text(16) || r.Issuer != ours.Certificate().Issuer.String() {
+			t.Errorf("%s: serial %s issuer %s do not match ours", tt.name, r.SerialNumber, r.Issuer)
+		}
+		if r.Trusted != tt.trusted {
+			t.Errorf("%s: Trusted = %v, want %v", tt.name, r.Trusted, tt.trusted)
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package service
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"receipt/internal/model"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hhrutter/pkcs7"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// signatureSize 签名数据预留的字节数，足够容纳签名证书及2-3级证书链
+const signatureSize = 16384
+
+// byteRangePlaceholder ByteRange占位，签名前替换为实际范围并用空格补齐
+const byteRangePlaceholder = "/ByteRange [0 0000000000 0000000000 0000000000]"
+
+// SignatureRect 可见签名区域，坐标以页面左上角为原点，单位pt，与收据版式一致
+type SignatureRect struct {
+	X, Y, W, H float64
+}
+
+// Signer 使用证书和私钥对收据PDF进行PKCS#7签名
+type Signer struct {
+	cert  *x509.Certificate
+	chain []*x509.Certificate // 中间证书，不含签名证书
+	key   crypto.Signer
+}
+
+// NewSignerFromPEM 从PEM文件加载签名证书和私钥
+//
+// certPath中第一个证书为签名证书，其余为证书链；keyPath为空时从certPath中读取私钥。
+func NewSignerFromPEM(certPath, keyPath string) (*Signer, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取签名证书失败: %v", err)
+	}
+	keyPEM := certPEM
+	if keyPath != "" {
+		if keyPEM, err = os.ReadFile(keyPath); err != nil {
+			return nil, fmt.Errorf("读取签名私钥失败: %v", err)
+		}
+	}
+
+	var certs []*x509.Certificate
+	for rest := certPEM; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("解析签名证书失败: %v", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%s 中没有证书", certPath)
+	}
+
+	var key crypto.PrivateKey
+	for rest := keyPEM; key == nil; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			return nil, fmt.Errorf("没有找到签名私钥")
+		}
+		if strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			if key, err = parsePrivateKey(block.Bytes); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return newSigner(certs[0], certs[1:], key)
+}
+
+// NewSignerFromPKCS12 从PKCS#12（.p12/.pfx）文件加载签名证书、证书链和私钥
+func NewSignerFromPKCS12(path, password string) (*Signer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取PKCS#12文件失败: %v", err)
+	}
+	key, cert, chain, err := pkcs12.DecodeChain(content, password)
+	if err != nil {
+		return nil, fmt.Errorf("解析PKCS#12文件失败: %v", err)
+	}
+	return newSigner(cert, chain, key)
+}
+
+func newSigner(cert *x509.Certificate, chain []*x509.Certificate, key crypto.PrivateKey) (*Signer, error) {
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("不支持的私钥类型: %T", key)
+	}
+	if !publicKeyEqual(cert.PublicKey, signer.Public()) {
+		return nil, fmt.Errorf("签名私钥与证书不匹配")
+	}
+	return &Signer{cert: cert, chain: chain, key: signer}, nil
+}
+
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("解析签名私钥失败，请使用未加密的PKCS#8、PKCS#1或EC私钥")
+}
+
+func publicKeyEqual(a, b crypto.PublicKey) bool {
+	switch k := a.(type) {
+	case *rsa.PublicKey:
+		return k.Equal(b)
+	case *ecdsa.PublicKey:
+		return k.Equal(b)
+	case ed25519.PublicKey:
+		return k.Equal(b)
+	}
+	return false
+}
+
+// Certificate 返回签名证书
+func (s *Signer) Certificate() *x509.Certificate {
+	return s.cert
+}
+
+// Name 返回签名人名称，取证书主题的通用名称，没有时取组织名称
+func (s *Signer) Name() string {
+	return certificateName(s.cert)
+}
+
+func certificateName(cert *x509.Certificate) string {
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.Subject.Organization) > 0 {
+		return cert.Subject.Organization[0]
+	}
+	return cert.Subject.String()
+}
+
+// Sign 以增量更新的方式为PDF第一页添加签名域并签名
+//
+// 签名域的组件注释位于rect，签名类型为 adbe.pkcs7.detached，签名覆盖除签名值以外的全部字节；
+// 签名后对文件的任何修改都会使签名校验失败。
+func (s *Signer) Sign(pdf []byte, rect SignatureRect, reason string) ([]byte, error) {
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+	ctx, err := api.ReadContext(bytes.NewReader(pdf), conf)
+	if err == nil {
+		err = ctx.EnsurePageCount()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF失败: %v", err)
+	}
+	prevXRef, err := lastStartXRef(pdf)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := ctx.Catalog()
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF目录失败: %v", err)
+	}
+	page, pageRef, _, err := ctx.PageDict(1, false)
+	if err != nil || page == nil {
+		return nil, fmt.Errorf("读取PDF页面失败: %v", err)
+	}
+	dims, err := ctx.PageDims()
+	if err != nil || len(dims) == 0 {
+		return nil, fmt.Errorf("读取PDF页面尺寸失败: %v", err)
+	}
+	pageHeight := dims[0].Height
+
+	size := *ctx.Size
+	sigNr, widgetNr, apNr := size, size+1, size+2
+	widgetRef := types.NewIndirectRef(widgetNr, 0)
+
+	// 签名域加入页面注释和文档表单
+	annots, err := ctx.DereferenceArray(page["Annots"])
+	if err != nil {
+		return nil, fmt.Errorf("读取页面注释失败: %v", err)
+	}
+	page["Annots"] = append(annots, *widgetRef)
+
+	objects := map[int]string{
+		int(pageRef.ObjectNumber): page.PDFString(),
+	}
+
+	acroForm, err := ctx.DereferenceDict(catalog["AcroForm"])
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF表单失败: %v", err)
+	}
+	if acroForm == nil {
+		acroForm = types.Dict{}
+	}
+	fields, err := ctx.DereferenceArray(acroForm["Fields"])
+	if err != nil {
+		return nil, fmt.Errorf("读取PDF表单失败: %v", err)
+	}
+	acroForm["Fields"] = append(fields, *widgetRef)
+	acroForm["SigFlags"] = types.Integer(3)
+	if ref, ok := catalog["AcroForm"].(types.IndirectRef); ok {
+		objects[int(ref.ObjectNumber)] = acroForm.PDFString()
+	} else {
+		catalog["AcroForm"] = acroForm
+		objects[int(ctx.Root.ObjectNumber)] = catalog.PDFString()
+	}
+
+	// 签名字典，Contents和ByteRange先占位
+	objects[sigNr] = fmt.Sprintf("<< /Type /Sig /Filter /Adobe.PPKLite /SubFilter /adbe.pkcs7.detached %s /Contents <%s> /M %s /Name %s /Reason %s >>",
+		byteRangePlaceholder, strings.Repeat("0", signatureSize*2),
+		pdfString(pdfDate(time.Now())), pdfString(s.Name()), pdfString(reason))
+
+	// 签名域与组件注释合并，外观为红色边框，签名文字已绘制在页面内容中
+	llx, lly := rect.X, pageHeight-rect.Y-rect.H
+	objects[widgetNr] = fmt.Sprintf("<< /Type /Annot /Subtype /Widget /FT /Sig /T %s /V %d 0 R /F 132 /P %d 0 R /Rect [%.2f %.2f %.2f %.2f] /AP << /N %d 0 R >> >>",
+		pdfString("收据签章"), sigNr, pageRef.ObjectNumber, llx, lly, llx+rect.W, lly+rect.H, apNr)
+	appearance := fmt.Sprintf("q 0.8 0 0 RG 0.8 w 0.4 0.4 %.2f %.2f re S Q", rect.W-0.8, rect.H-0.8)
+	objects[apNr] = fmt.Sprintf("<< /Type /XObject /Subtype /Form /BBox [0 0 %.2f %.2f] /Length %d >>\nstream\n%s\nendstream",
+		rect.W, rect.H, len(appearance), appearance)
+
+	// 写入增量更新
+	var buf bytes.Buffer
+	buf.Write(pdf)
+	if !bytes.HasSuffix(pdf, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	offsets := make(map[int]int, len(objects))
+	numbers := make([]int, 0, len(objects))
+	for nr := range objects {
+		numbers = append(numbers, nr)
+	}
+	sort.Ints(numbers)
+	for _, nr := range numbers {
+		offsets[nr] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", nr, objects[nr])
+	}
+
+	xrefOffset := buf.Len()
+	buf.WriteString("xref\n")
+	for _, nr := range numbers {
+		fmt.Fprintf(&buf, "%d 1\n%010d 00000 n \n", nr, offsets[nr])
+	}
+	trailer := types.Dict{
+		"Size": types.Integer(size + 3),
+		"Root": *ctx.Root,
+		"Prev": types.Integer(prevXRef),
+	}
+	if ctx.Info != nil {
+		trailer["Info"] = *ctx.Info
+	}
+	if ctx.ID != nil {
+		trailer["ID"] = ctx.ID
+	}
+	fmt.Fprintf(&buf, "trailer\n%s\nstartxref\n%d\n%%%%EOF\n", trailer.PDFString(), xrefOffset)
+
+	// 计算签名范围并填入ByteRange
+	out := buf.Bytes()
+	sigStart := offsets[sigNr]
+	contentsStart := sigStart + bytes.Index(out[sigStart:], []byte("/Contents <")) + len("/Contents ")
+	contentsEnd := contentsStart + signatureSize*2 + 2
+	byteRange := fmt.Sprintf("/ByteRange [0 %d %d %d]", contentsStart, contentsEnd, len(out)-contentsEnd)
+	byteRange += strings.Repeat(" ", len(byteRangePlaceholder)-len(byteRange))
+	brStart := sigStart + bytes.Index(out[sigStart:], []byte(byteRangePlaceholder))
+	copy(out[brStart:], byteRange)
+
+	signed := make([]byte, 0, len(out)-(contentsEnd-contentsStart))
+	signed = append(signed, out[:contentsStart]...)
+	signed = append(signed, out[contentsEnd:]...)
+
+	sd, err := pkcs7.NewSignedData(signed)
+	if err != nil {
+		return nil, fmt.Errorf("创建签名失败: %v", err)
+	}
+	sd.SetDigestAlgorithm(pkcs7.OIDDigestAlgorithmSHA256)
+	if err := sd.AddSignerChain(s.cert, s.key, s.chain, pkcs7.SignerInfoConfig{}); err != nil {
+		return nil, fmt.Errorf("签名失败: %v", err)
+	}
+	sd.Detach()
+	signature, err := sd.Finish()
+	if err != nil {
+		return nil, fmt.Errorf("签名失败: %v", err)
+	}
+	if len(signature) > signatureSize {
+		return nil, fmt.Errorf("签名数据过大（%d字节），请减少证书链", len(signature))
+	}
+	hex.Encode(out[contentsStart+1:], signature)
+
+	return out, nil
+}
+
+// startXRefPattern 匹配文件末尾的 startxref
+var startXRefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+
+// lastStartXRef 返回最后一个交叉引用表的偏移量
+func lastStartXRef(pdf []byte) (int, error) {
+	tail := pdf
+	if len(tail) > 1024 {
+		tail = tail[len(tail)-1024:]
+	}
+	m := startXRefPattern.FindSubmatch(tail)
+	if m == nil {
+		return 0, fmt.Errorf("PDF缺少startxref")
+	}
+	return strconv.Atoi(string(m[1]))
+}
+
+// pdfString 将文本编码为PDF字符串，非ASCII文本使用UTF-16BE
+func pdfString(s string) string {
+	escape := types.Escape
+	for _, r := range s {
+		if r > 0x7e {
+			escape = types.EscapedUTF16String
+			break
+		}
+	}
+	escaped, err := escape(s)
+	if err != nil {
+		return "()"
+	}
+	return "(" + *escaped + ")"
+}
+
+// pdfDate 格式化为PDF日期，如 D:20250921143022+08'00'
+func pdfDate(t time.Time) string {
+	_, offset := t.Zone()
+	sign := "+"
+	if offset < 0 {
+		sign, offset = "-", -offset
+	}
+	return fmt.Sprintf("D:%s%s%02d'%02d'", t.Format("20060102150405"), sign, offset/3600, offset%3600/60)
+}
+
+// signPDF 绘制可见签名并签名，签名位置取渲染后端给出的盖章位置，没有时放在页面右下角
+func (s *PDFService) signPDF(pdf []byte, r Renderer, data *model.ReceiptData) ([]byte, error) {
+	var rect SignatureRect
+	ok := false
+	if locator, isLocator := r.(sealLocator); isLocator {
+		rect, ok = locator.sealRect(data)
+	}
+	if !ok {
+		dims, err := api.PageDims(bytes.NewReader(pdf), nil)
+		if err != nil || len(dims) == 0 {
+			return nil, fmt.Errorf("读取PDF页面尺寸失败: %v", err)
+		}
+		rect = SignatureRect{X: dims[0].Width - 130, Y: dims[0].Height - 60, W: 110, H: 40}
+	}
+
+	pdf, err := drawText(pdf, chineseFontPath, s.signatureText(), rect.X+4, rect.Y+4, 7, "#C00000")
+	if err != nil {
+		return nil, err
+	}
+
+	signed, err := s.signer.Sign(pdf, rect, "收据 "+data.ID)
+	if err != nil {
+		return nil, fmt.Errorf("签名失败: %v", err)
+	}
+	return signed, nil
+}
+
+// signatureText 可见签名的文字：签章名称、签名人和签名时间
+func (s *PDFService) signatureText() string {
+	return fmt.Sprintf("电子签章\n%s\n%s", s.signer.Name(), time.Now().Format("2006-01-02 15:04:05"))
+}
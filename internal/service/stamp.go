@@ -0,0 +1,199 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/golang/freetype/truetype"
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/f64"
+	"golang.org/x/image/math/fixed"
+)
+
+// Stamp 叠加在收据PDF上的文字印记
+type Stamp struct {
+	Text     string
+	Color    string  // #RRGGBB
+	Diagonal bool    // true时沿页面对角线放大显示，否则显示在左上角
+	Opacity  float64 // 不透明度，0-1
+}
+
+var (
+	// StampReprint 补打或副本印记，用于从登记记录重新渲染的收据
+	StampReprint = Stamp{Text: "补打/副本", Color: "#C00000", Opacity: 0.9}
+	// StampVoid 作废印记，沿对角线覆盖整张收据
+	StampVoid = Stamp{Text: "作废", Color: "#FF0000", Diagonal: true, Opacity: 0.5}
+)
+
+// StampPDF 在已生成的收据PDF上叠加印记
+func (s *PDFService) StampPDF(pdf []byte, stamps ...Stamp) ([]byte, error) {
+	return applyStamps(pdf, chineseFontPath, stamps)
+}
+
+// applyStamps 将印记叠加到PDF的每一页，fontPath为印记使用的中文字体
+func applyStamps(pdf []byte, fontPath string, stamps []Stamp) ([]byte, error) {
+	if len(stamps) == 0 {
+		return pdf, nil
+	}
+
+	fontName, err := installPDFFont(fontPath)
+	if err != nil {
+		return nil, err
+	}
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	for _, stamp := range stamps {
+		desc := fmt.Sprintf("fontname:%s, points:16, rot:0, pos:tl, offset:24 -16, scale:1 abs, fillcolor:%s, opacity:%.2f",
+			fontName, stamp.Color, stamp.Opacity)
+		if stamp.Diagonal {
+			desc = fmt.Sprintf("fontname:%s, points:96, diagonal:1, scale:0.6 rel, fillcolor:%s, opacity:%.2f",
+				fontName, stamp.Color, stamp.Opacity)
+		}
+
+		wm, err := api.TextWatermark(stamp.Text, desc, true, false, types.POINTS)
+		if err != nil {
+			return nil, fmt.Errorf("创建印记失败: %v", err)
+		}
+
+		var out bytes.Buffer
+		if err := api.AddWatermarks(bytes.NewReader(pdf), &out, nil, wm, conf); err != nil {
+			return nil, fmt.Errorf("添加印记失败: %v", err)
+		}
+		pdf = out.Bytes()
+	}
+
+	return pdf, nil
+}
+
+// drawText 在第一页的指定位置绘制文字，x、y为文字左上角，以页面左上角为原点
+func drawText(pdf []byte, fontPath, text string, x, y float64, points int, color string) ([]byte, error) {
+	fontName, err := installPDFFont(fontPath)
+	if err != nil {
+		return nil, err
+	}
+
+	desc := fmt.Sprintf("fontname:%s, points:%d, rot:0, pos:tl, offset:%.2f %.2f, scale:1 abs, align:l, fillcolor:%s, opacity:1",
+		fontName, points, x, -y, color)
+	wm, err := api.TextWatermark(text, desc, true, false, types.POINTS)
+	if err != nil {
+		return nil, fmt.Errorf("创建文字失败: %v", err)
+	}
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	var out bytes.Buffer
+	if err := api.AddWatermarks(bytes.NewReader(pdf), &out, []string{"1"}, wm, conf); err != nil {
+		return nil, fmt.Errorf("添加文字失败: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+var (
+	pdfFontsMu sync.Mutex
+	pdfFonts   = make(map[string]string) // 字体文件路径 -> PostScript名称
+)
+
+// installPDFFont 将TrueType字体安装到pdfcpu的用户字体目录，返回pdfcpu中引用该字体的名称
+func installPDFFont(path string) (string, error) {
+	pdfFontsMu.Lock()
+	defer pdfFontsMu.Unlock()
+
+	if name, ok := pdfFonts[path]; ok {
+		return name, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("加载字体失败: %v", err)
+	}
+	f, err := truetype.Parse(content)
+	if err != nil {
+		return "", fmt.Errorf("解析字体失败: %v", err)
+	}
+	name := f.Name(truetype.NameIDPostscriptName)
+
+	// 加载pdfcpu配置以初始化用户字体目录
+	pdfmodel.NewDefaultConfiguration()
+	if err := api.InstallFonts([]string{path}); err != nil {
+		return "", fmt.Errorf("安装字体失败: %v", err)
+	}
+
+	pdfFonts[path] = name
+	return name, nil
+}
+
+// drawStampImage 在图片上绘制与PDF相同位置和大小的印记，scale为每个PDF点对应的像素数
+//
+// 普通印记以16pt显示在左上角；对角印记的宽度为页面宽度的60%，居中并沿左下到右上的对角线旋转。
+func drawStampImage(img *image.RGBA, stamp Stamp, scale float64) error {
+	f, err := loadRasterFont(chineseFontPath)
+	if err != nil {
+		return err
+	}
+	col, err := parseColor(stamp.Color)
+	if err != nil {
+		return err
+	}
+	src := image.NewUniform(color.NRGBA{R: col.R, G: col.G, B: col.B, A: uint8(math.Round(stamp.Opacity * 255))})
+
+	if !stamp.Diagonal {
+		const points = 16
+		face := truetype.NewFace(f, &truetype.Options{Size: points, DPI: rasterDPI})
+		defer face.Close()
+
+		// 文字框上边缘距页面顶部16pt，基线在文字框底部之上一个下行高度（向上取整到pt）
+		_, descent := stampMetrics(f, points)
+		d := &font.Drawer{Dst: img, Src: src, Face: face}
+		d.Dot = fixed.P(int(math.Round(24*scale)), int(math.Round((16+points-math.Ceil(descent))*scale)))
+		d.DrawString(stamp.Text)
+		return nil
+	}
+
+	// 与pdfcpu相同按宽度计算整数字号，先绘制到透明图片上再旋转叠加
+	bounds := img.Bounds()
+	pageWidth, pageHeight := float64(bounds.Dx()), float64(bounds.Dy())
+	advance := float64(font.MeasureString(truetype.NewFace(f, &truetype.Options{Size: 100, DPI: 72}), stamp.Text)) / 64 / 100
+	points := math.Floor(pageWidth / scale * 0.6 / advance)
+	face := truetype.NewFace(f, &truetype.Options{Size: points, DPI: rasterDPI})
+	defer face.Close()
+
+	ascent, descent := stampMetrics(f, points)
+	width := font.MeasureString(face, stamp.Text).Ceil()
+	height := int(math.Ceil((ascent + descent) * scale))
+	text := image.NewRGBA(image.Rect(0, 0, width, height))
+	d := &font.Drawer{Dst: text, Src: src, Face: face}
+	d.Dot = fixed.P(0, int(math.Round((ascent+descent-math.Ceil(descent))*scale)))
+	d.DrawString(stamp.Text)
+
+	// 文字中心 -> 页面中心，逆时针旋转到对角线方向（图片坐标系Y轴向下）
+	rad := math.Atan(pageHeight / pageWidth)
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	sx, sy := float64(width)/2, (ascent+descent)*scale/2
+	cx, cy := pageWidth/2, pageHeight/2
+	m := f64.Aff3{
+		cos, sin, cx - cos*sx - sin*sy,
+		-sin, cos, cy + sin*sx - cos*sy,
+	}
+	xdraw.CatmullRom.Transform(img, m, text, text.Bounds(), xdraw.Over, nil)
+	return nil
+}
+
+// stampMetrics 返回字体在指定字号下的上行高度和下行高度（pt）
+func stampMetrics(f *truetype.Font, points float64) (float64, float64) {
+	face := truetype.NewFace(f, &truetype.Options{Size: points, DPI: 72})
+	defer face.Close()
+	metrics := face.Metrics()
+	return float64(metrics.Ascent) / 64, float64(metrics.Descent) / 64
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+// 模板类型
+const (
+	TemplateKindLayout   = "layout"   // JSON版式，由gopdf绘制
+	TemplateKindAcroForm = "acroform" // AcroForm PDF模板，由pdfcpu填充
+)
+
+// BuiltinTemplate 内置模板名称，使用服务的默认版式，不可删除或覆盖
+const BuiltinTemplate = "builtin"
+
+// defaultTemplateFile 记录默认模板名称的文件
+const defaultTemplateFile = ".default"
+
+var (
+	ErrTemplateNotFound = errors.New("模板不存在")
+	ErrTemplateExists   = errors.New("模板已存在")
+	ErrTemplateReadOnly = errors.New("内置模板不可修改")
+	ErrTemplateInUse    = errors.New("默认模板不可删除")
+)
+
+// templateNamePattern 模板名称只允许字母、数字、下划线和短横线，避免路径穿越
+var templateNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Template 模板信息
+type Template struct {
+	Name      string    `json:"name"`
+	Kind      string    `json:"kind"`
+	FileSize  int64     `json:"file_size"`
+	UpdatedAt time.Time `json:"updated_at"`
+	IsDefault bool      `json:"is_default"`
+	Builtin   bool      `json:"builtin"`
+
+	path     string
+	layout   *Layout
+	renderer Renderer
+}
+
+// Layout 返回版式模板的版式，AcroForm模板返回nil
+func (t *Template) Layout() *Layout {
+	return t.layout
+}
+
+// FieldNames 返回AcroForm模板中的表单字段名称
+func (t *Template) FieldNames() ([]string, error) {
+	if t.Kind != TemplateKindAcroForm {
+		return nil, nil
+	}
+
+	f, err := os.Open(t.path)
+	if err != nil {
+		return nil, fmt.Errorf("打开PDF模板失败: %v", err)
+	}
+	defer f.Close()
+
+	fields, err := api.FormFields(f, nil)
+	if err != nil {
+		return nil, fmt.Errorf("读取表单字段失败: %v", err)
+	}
+
+	names := make([]string, 0, len(fields))
+	for _, field := range fields {
+		names = append(names, field.Name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Path 返回模板文件路径，内置模板为空
+func (t *Template) Path() string {
+	return t.path
+}
+
+// TemplateRegistry 命名模板库，模板以文件形式保存在目录中：
+// <name>.json 为版式模板，<name>.pdf 为AcroForm模板。
+type TemplateRegistry struct {
+	dir     string
+	service *PDFService
+
+	mu              sync.RWMutex
+	templates       map[string]*Template
+	defaultTemplate string
+}
+
+// LoadTemplates 加载模板目录并挂载到PDF服务，请求中的 template 字段将从该模板库解析
+func (s *PDFService) LoadTemplates(dir string) (*TemplateRegistry, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建模板目录失败: %v", err)
+	}
+
+	r := &TemplateRegistry{
+		dir:       dir,
+		service:   s,
+		templates: make(map[string]*Template),
+	}
+
+	r.templates[BuiltinTemplate] = &Template{
+		Name:     BuiltinTemplate,
+		Kind:     TemplateKindLayout,
+		Builtin:  true,
+		layout:   s.layout,
+		renderer: &gopdfRenderer{service: s},
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取模板目录失败: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name, kind, ok := parseTemplateFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		t, err := r.load(name, kind)
+		if err != nil {
+			log.Printf("警告：跳过无法加载的模板%s: %v", entry.Name(), err)
+			continue
+		}
+		r.templates[name] = t
+	}
+
+	if content, err := os.ReadFile(filepath.Join(dir, defaultTemplateFile)); err == nil {
+		name := strings.TrimSpace(string(content))
+		if _, ok := r.templates[name]; ok {
+			r.defaultTemplate = name
+		}
+	}
+
+	s.templates = r
+	return r, nil
+}
+
+// List 返回全部模板，按名称排序
+func (r *TemplateRegistry) List() []*Template {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list := make([]*Template, 0, len(r.templates))
+	for _, t := range r.templates {
+		list = append(list, r.withDefault(t))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Get 按名称获取模板
+func (r *TemplateRegistry) Get(name string) (*Template, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return r.withDefault(t), nil
+}
+
+// Save 校验并保存模板，kind由文件内容决定；overwrite为false时同名模板返回 ErrTemplateExists
+func (r *TemplateRegistry) Save(name, kind string, content []byte, overwrite bool) (*Template, error) {
+	if !templateNamePattern.MatchString(name) {
+		return nil, fmt.Errorf("模板名称无效: %s", name)
+	}
+	if name == BuiltinTemplate {
+		return nil, ErrTemplateReadOnly
+	}
+
+	switch kind {
+	case TemplateKindLayout:
+		if _, err := ParseLayout(content); err != nil {
+			return nil, err
+		}
+	case TemplateKindAcroForm:
+		fields, err := api.FormFields(bytes.NewReader(content), nil)
+		if err != nil {
+			return nil, fmt.Errorf("读取表单字段失败: %v", err)
+		}
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("PDF模板中没有表单字段")
+		}
+	default:
+		return nil, fmt.Errorf("未知的模板类型: %s", kind)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.templates[name]
+	if exists && !overwrite {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateExists, name)
+	}
+
+	path := filepath.Join(r.dir, name+templateExt(kind))
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return nil, fmt.Errorf("保存模板失败: %v", err)
+	}
+	// 类型变化时删除旧文件
+	if exists && existing.path != path {
+		os.Remove(existing.path)
+	}
+
+	t, err := r.load(name, kind)
+	if err != nil {
+		return nil, err
+	}
+	r.templates[name] = t
+	return r.withDefault(t), nil
+}
+
+// Delete 删除模板，内置模板和默认模板不可删除
+func (r *TemplateRegistry) Delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.templates[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if t.Builtin {
+		return ErrTemplateReadOnly
+	}
+	if name == r.defaultTemplate {
+		return ErrTemplateInUse
+	}
+
+	if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除模板失败: %v", err)
+	}
+	delete(r.templates, name)
+	return nil
+}
+
+// SetDefault 设置默认模板，未指定模板的请求将使用该模板
+func (r *TemplateRegistry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.templates[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	if err := os.WriteFile(filepath.Join(r.dir, defaultTemplateFile), []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("保存默认模板失败: %v", err)
+	}
+	r.defaultTemplate = name
+	return nil
+}
+
+// Default 返回默认模板名称，未设置时为空
+func (r *TemplateRegistry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.defaultTemplate
+}
+
+// renderer 返回模板对应的渲染后端
+func (r *TemplateRegistry) renderer(name string) (Renderer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.templates[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrTemplateNotFound, name)
+	}
+	return t.renderer, nil
+}
+
+// load 从模板目录加载单个模板
+func (r *TemplateRegistry) load(name, kind string) (*Template, error) {
+	path := filepath.Join(r.dir, name+templateExt(kind))
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取模板失败: %v", err)
+	}
+
+	t := &Template{
+		Name:      name,
+		Kind:      kind,
+		FileSize:  info.Size(),
+		UpdatedAt: info.ModTime(),
+		path:      path,
+	}
+
+	switch kind {
+	case TemplateKindLayout:
+		layout, err := LoadLayout(path)
+		if err != nil {
+			return nil, err
+		}
+		t.layout = layout
+		t.renderer = &gopdfRenderer{service: r.service, layout: layout}
+	case TemplateKindAcroForm:
+		renderer, err := NewAcroFormRenderer(path, chineseFontPath)
+		if err != nil {
+			return nil, err
+		}
+		t.renderer = renderer
+	}
+
+	return t, nil
+}
+
+// withDefault 返回带有默认标记的模板副本，调用方需持有读锁
+func (r *TemplateRegistry) withDefault(t *Template) *Template {
+	c := *t
+	c.IsDefault = t.Name == r.defaultTemplate
+	return &c
+}
+
+// TemplateKindFromFileName 根据上传文件的扩展名判断模板类型
+func TemplateKindFromFileName(fileName string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".json":
+		return TemplateKindLayout, true
+	case ".pdf":
+		return TemplateKindAcroForm, true
+	}
+	return "", false
+}
+
+// parseTemplateFileName 从模板目录中的文件名解析模板名称和类型
+func parseTemplateFileName(fileName string) (string, string, bool) {
+	kind, ok := TemplateKindFromFileName(fileName)
+	if !ok {
+		return "", "", false
+	}
+	name := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+	if !templateNamePattern.MatchString(name) || name == BuiltinTemplate {
+		return "", "", false
+	}
+	return name, kind, true
+}
+
+// templateExt 返回模板类型对应的文件扩展名
+func templateExt(kind string) string {
+	if kind == TemplateKindAcroForm {
+		return ".pdf"
+	}
+	return ".json"
+}
@@ -0,0 +1,220 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/url"
+	"receipt/internal/model"
+	"receipt/internal/qrcode"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	pdfmodel "github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/signintech/gopdf"
+)
+
+// verifyMACSize 校验码长度（字节），截断的HMAC-SHA256
+const verifyMACSize = 10
+
+// minVerifyKeySize 校验密钥的最小长度（字节）
+const minVerifyKeySize = 16
+
+// ErrInvalidToken 校验码格式错误或与收据数据不符
+var ErrInvalidToken = errors.New("收据校验码无效")
+
+// Verifier 生成和校验收据上二维码中的在线校验地址
+//
+// 校验码由收据编号和以收据编号、金额、日期计算的HMAC组成：<base64url(编号)>.<base64url(HMAC)>，
+// 持有密钥的服务可以确认收据由本服务开具且关键数据未被篡改，无需保存校验码。
+type Verifier struct {
+	baseURL string
+	key     []byte
+}
+
+// NewVerifier 创建校验地址生成器，baseURL为服务对外的访问地址，如 https://receipt.example.com
+func NewVerifier(baseURL string, key []byte) (*Verifier, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("校验地址无效: %s", baseURL)
+	}
+	if len(key) < minVerifyKeySize {
+		return nil, fmt.Errorf("校验密钥至少需要%d字节", minVerifyKeySize)
+	}
+
+	return &Verifier{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		key:     key,
+	}, nil
+}
+
+// Token 返回收据的校验码
+func (v *Verifier) Token(data *model.ReceiptData) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(data.ID)) + "." +
+		base64.RawURLEncoding.EncodeToString(v.mac(data))
+}
+
+// URL 返回收据的在线校验地址，未配置校验时返回空字符串
+func (v *Verifier) URL(data *model.ReceiptData) string {
+	if v == nil || data.ID == "" {
+		return ""
+	}
+	return v.baseURL + "/verify/" + v.Token(data)
+}
+
+// ReceiptID 从校验码中取出收据编号，不校验HMAC
+func (v *Verifier) ReceiptID(token string) (string, error) {
+	idPart, _, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	id, err := base64.RawURLEncoding.DecodeString(idPart)
+	if err != nil || len(id) == 0 {
+		return "", ErrInvalidToken
+	}
+	return string(id), nil
+}
+
+// Check 校验码是否与登记的收据数据一致
+func (v *Verifier) Check(token string, data *model.ReceiptData) bool {
+	id, err := v.ReceiptID(token)
+	if err != nil || id != data.ID {
+		return false
+	}
+	_, macPart, _ := strings.Cut(token, ".")
+	mac, err := base64.RawURLEncoding.DecodeString(macPart)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, v.mac(data))
+}
+
+// mac 以收据编号、金额和日期计算截断的HMAC-SHA256
+func (v *Verifier) mac(data *model.ReceiptData) []byte {
+	h := hmac.New(sha256.New, v.key)
+	fmt.Fprintf(h, "receipt-verify\x00%s\x00%s\x00%s", data.ID, data.Rent, data.Date)
+	return h.Sum(nil)[:verifyMACSize]
+}
+
+// SetVerifier 设置收据校验地址生成器，设置后收据上打印在线校验二维码
+func (s *PDFService) SetVerifier(verifier *Verifier) {
+	s.verifier = verifier
+}
+
+// Verifier 返回收据校验地址生成器，未配置时为nil
+func (s *PDFService) Verifier() *Verifier {
+	return s.verifier
+}
+
+// receiptFields 返回版式占位符字段，包括服务生成的 {verify_url}
+func (s *PDFService) receiptFields(data *model.ReceiptData) map[string]string {
+	fields := layoutFields(data)
+	fields["verify_url"] = s.verifier.URL(data)
+	return fields
+}
+
+// copyFields 返回绘制指定联次时使用的字段，在收据字段之外增加 copy_label
+func (s *PDFService) copyFields(layout *Layout, data *model.ReceiptData, copyName string) map[string]string {
+	fields := s.receiptFields(data)
+	fields["copy_label"] = layout.copyStyle(copyName).Label
+	return fields
+}
+
+// encodeQRCode 编码qrcode元素的内容，内容为空（如未配置校验地址）时返回false
+func encodeQRCode(e LayoutElement, fields map[string]string) (*qrcode.Code, bool, error) {
+	text := e.Text
+	if text == "" {
+		text = defaultQRCodeText
+	}
+	text = expandText(text, fields)
+	if text == "" {
+		return nil, false, nil
+	}
+
+	code, err := qrcode.Encode([]byte(text))
+	if err != nil {
+		return nil, false, err
+	}
+	return code, true, nil
+}
+
+// drawQRCodePDF 使用gopdf在 x、y 处绘制边长为size的二维码，相邻的深色模块合并为一个矩形
+func drawQRCodePDF(pdf *gopdf.GoPdf, code *qrcode.Code, x, y, size float64) {
+	module := size / float64(code.Size)
+
+	pdf.SetFillColor(0, 0, 0)
+	for row := 0; row < code.Size; row++ {
+		for col := 0; col < code.Size; {
+			if !code.Dark(col, row) {
+				col++
+				continue
+			}
+			start := col
+			for col < code.Size && code.Dark(col, row) {
+				col++
+			}
+			pdf.RectFromUpperLeftWithStyle(x+float64(start)*module, y+float64(row)*module,
+				float64(col-start)*module, module, "F")
+		}
+	}
+}
+
+// drawQRCodeImage 在图片的 x、y 像素处绘制边长为size像素的二维码
+func drawQRCodeImage(img *image.RGBA, code *qrcode.Code, x, y, size float64) {
+	module := size / float64(code.Size)
+	black := image.NewUniform(color.Black)
+	for row := 0; row < code.Size; row++ {
+		for col := 0; col < code.Size; col++ {
+			if !code.Dark(col, row) {
+				continue
+			}
+			// 模块边界取整到像素，相邻模块之间不留缝隙
+			r := image.Rect(
+				int(math.Round(x+float64(col)*module)), int(math.Round(y+float64(row)*module)),
+				int(math.Round(x+float64(col+1)*module)), int(math.Round(y+float64(row+1)*module)),
+			)
+			draw.Draw(img, r, black, image.Point{}, draw.Src)
+		}
+	}
+}
+
+// qrCodeSize AcroForm模板上二维码的边长（pt）
+const qrCodeSize = 56
+
+// stampQRCode 在没有版式信息的PDF（如AcroForm模板）第一页左下角叠加校验二维码
+func stampQRCode(pdf []byte, verifyURL string) ([]byte, error) {
+	code, err := qrcode.Encode([]byte(verifyURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var img bytes.Buffer
+	if err := png.Encode(&img, code.Image(4, 2)); err != nil {
+		return nil, fmt.Errorf("编码二维码失败: %v", err)
+	}
+	scale := float64(qrCodeSize) / float64((code.Size+4)*4)
+
+	desc := fmt.Sprintf("pos:bl, offset:12 12, scale:%.4f abs, rot:0, opacity:1", scale)
+	wm, err := api.ImageWatermarkForReader(&img, desc, true, false, types.POINTS)
+	if err != nil {
+		return nil, fmt.Errorf("创建二维码失败: %v", err)
+	}
+
+	conf := pdfmodel.NewDefaultConfiguration()
+	conf.ValidationMode = pdfmodel.ValidationRelaxed
+
+	var out bytes.Buffer
+	if err := api.AddWatermarks(bytes.NewReader(pdf), &out, []string{"1"}, wm, conf); err != nil {
+		return nil, fmt.Errorf("添加二维码失败: %v", err)
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,330 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config S3兼容对象存储的连接参数
+type S3Config struct {
+	Endpoint  string // 服务地址，如 https://s3.ap-east-1.amazonaws.com、http://minio:9000
+	Region    string // 区域，默认 us-east-1
+	Bucket    string // 存储桶
+	AccessKey string
+	SecretKey string
+	Prefix    string // 键的前缀，如 receipt/backup/，同一存储桶可供多个用途使用
+	PathStyle bool   // 使用 endpoint/bucket/key 形式的地址，MinIO等自建服务通常需要
+}
+
+// s3Timeout 单次请求的超时时间
+const s3Timeout = 60 * time.Second
+
+// emptyPayloadHash 空请求体的SHA-256
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 S3兼容的对象存储，使用AWS签名V4直接调用REST接口
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 创建S3兼容的对象存储
+func NewS3(config S3Config) (*S3, error) {
+	if config.Endpoint == "" || config.Bucket == "" {
+		return nil, fmt.Errorf("S3存储需要配置服务地址和存储桶")
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("S3存储需要配置访问密钥")
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("S3服务地址无效: %s", config.Endpoint)
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	return &S3{
+		config:   config,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: s3Timeout},
+	}, nil
+}
+
+func (s *S3) Put(key string, content []byte) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, s.config.Prefix+key, nil, content)
+	if err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Get(key string) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodGet, s.config.Prefix+key, nil, nil)
+	if err != nil {
+		return nil, s.wrapError(key, "读取文件失败", err)
+	}
+	return resp.Body, nil
+}
+
+func (s *S3) Stat(key string) (*ObjectInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	resp, err := s.do(http.MethodHead, s.config.Prefix+key, nil, nil)
+	if err != nil {
+		return nil, s.wrapError(key, "读取文件信息失败", err)
+	}
+	resp.Body.Close()
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &ObjectInfo{Key: key, Size: resp.ContentLength, ModTime: modTime}, nil
+}
+
+// List 使用ListObjectsV2分页列出全部文件
+func (s *S3) List(prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("列出文件失败: %v", err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key          string
+				Size         int64
+				LastModified time.Time
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("解析文件列表失败: %v", err)
+		}
+
+		for _, c := range result.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:     strings.TrimPrefix(c.Key, s.config.Prefix),
+				Size:    c.Size,
+				ModTime: c.LastModified,
+			})
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	return objects, nil
+}
+
+func (s *S3) Delete(key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, s.config.Prefix+key, nil, nil)
+	if err != nil {
+		if e, ok := err.(*s3Error); ok && e.status == http.StatusNotFound {
+			return nil
+		}
+		return fmt.Errorf("删除文件失败: %v", err)
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3) Location(key string) string {
+	return fmt.Sprintf("s3://%s/%s%s", s.config.Bucket, s.config.Prefix, key)
+}
+
+// s3Error 对象存储返回的错误
+type s3Error struct {
+	status  int
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("对象存储返回 %d", e.status)
+	}
+	return fmt.Sprintf("对象存储返回 %d %s: %s", e.status, e.Code, e.Message)
+}
+
+// wrapError 文件不存在时返回ErrNotExist
+func (s *S3) wrapError(key, action string, err error) error {
+	if e, ok := err.(*s3Error); ok && e.status == http.StatusNotFound {
+		return fmt.Errorf("%w: %s", ErrNotExist, key)
+	}
+	return fmt.Errorf("%s: %v", action, err)
+}
+
+// do 发送签名后的请求，非2xx响应转换为s3Error
+func (s *S3) do(method, key string, query url.Values, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	u.RawQuery = ""
+	if query != nil {
+		u.RawQuery = strings.ReplaceAll(query.Encode(), "+", "%20")
+	}
+	objectPath := "/" + key
+	if key == "" {
+		objectPath = "/"
+	}
+	if s.config.PathStyle {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.config.Bucket + objectPath
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + objectPath
+	}
+	u.RawPath = uriEncode(u.Path, false)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body == nil {
+		req.Body = http.NoBody
+		req.ContentLength = 0
+	}
+	payloadHash := emptyPayloadHash
+	if len(body) > 0 {
+		sum := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(sum[:])
+	}
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	s.sign(req, payloadHash, time.Now().UTC())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	e := &s3Error{status: resp.StatusCode}
+	if method != http.MethodHead {
+		content, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		xml.Unmarshal(content, e)
+	}
+	return nil, e
+}
+
+// sign 按AWS签名V4为请求添加Authorization头，签名覆盖host、range、content-type和全部x-amz-*请求头
+func (s *S3) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.config.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery 按参数名排序并编码查询参数
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := append([]string(nil), query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode 按签名V4的规则编码：只保留字母、数字和 -_.~，encodeSlash为false时保留路径中的/
+func uriEncode(s string, encodeSlash bool) string {
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			sb.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			sb.WriteByte(b)
+		default:
+			fmt.Fprintf(&sb, "%%%02X", b)
+		}
+	}
+	return sb.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
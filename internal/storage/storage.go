@@ -0,0 +1,68 @@
+// Package storage 收据备份和任务文件的存储后端：本地文件系统或S3兼容的对象存储
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// 存储错误
+var (
+	ErrNotExist   = errors.New("文件不存在")
+	ErrInvalidKey = errors.New("文件键无效")
+)
+
+// ObjectInfo 存储中的文件信息
+type ObjectInfo struct {
+	Key     string    // 文件键，以/分隔的相对路径
+	Size    int64     // 文件大小
+	ModTime time.Time // 最后修改时间
+}
+
+// Storage 文件存储后端，键为以/分隔的相对路径，如 receipt_NO101202509-001.pdf、20250921103000-1a2b3c4d/0.pdf
+type Storage interface {
+	// Put 写入文件，已存在时覆盖
+	Put(key string, content []byte) error
+	// Get 读取文件，不存在时返回ErrNotExist，调用方负责关闭
+	Get(key string) (io.ReadCloser, error)
+	// Stat 获取文件信息，不存在时返回ErrNotExist
+	Stat(key string) (*ObjectInfo, error)
+	// List 按键的顺序列出以prefix开头的文件
+	List(prefix string) ([]ObjectInfo, error)
+	// Delete 删除文件，不存在时不返回错误
+	Delete(key string) error
+	// Location 返回文件的完整位置，用于日志和接口响应
+	Location(key string) string
+}
+
+// 存储后端类型
+const (
+	BackendFS = "fs" // 本地文件系统
+	BackendS3 = "s3" // S3兼容的对象存储
+)
+
+// ReadAll 读取整个文件
+func ReadAll(s Storage, key string) ([]byte, error) {
+	r, err := s.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// checkKey 检查文件键，不允许空键、绝对路径和 .. 等可能越出存储根目录的写法
+func checkKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+		}
+	}
+	return nil
+}
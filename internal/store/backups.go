@@ -0,0 +1,152 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"receipt/internal/model"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrBackupNotFound 备份不存在
+var ErrBackupNotFound = errors.New("备份文件不存在")
+
+// PutBackup 在备份清单中添加一项，同名的项已存在时不覆盖并返回false
+func (s *Store) PutBackup(entry *model.BackupEntry) (bool, error) {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+	added := false
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketBackups)
+		if bucket.Get([]byte(entry.Name)) != nil {
+			return nil
+		}
+		added = true
+		return bucket.Put([]byte(entry.Name), content)
+	})
+	if err != nil {
+		return false, fmt.Errorf("保存备份清单失败: %v", err)
+	}
+	return added, nil
+}
+
+// ReplaceBackup 保存备份清单中的一项，同名时覆盖；返回被覆盖的项（没有时为nil）以及其他备份是否仍引用它的文件内容
+func (s *Store) ReplaceBackup(entry *model.BackupEntry) (*model.BackupEntry, bool, error) {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return nil, false, err
+	}
+	var replaced *model.BackupEntry
+	referenced := false
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketBackups)
+		if old := bucket.Get([]byte(entry.Name)); old != nil {
+			var err error
+			if replaced, err = decodeBackup(old); err != nil {
+				return err
+			}
+		}
+		if err := bucket.Put([]byte(entry.Name), content); err != nil {
+			return err
+		}
+		if replaced == nil {
+			return nil
+		}
+		referenced, err = backupReferenced(bucket, replaced.SHA256)
+		return err
+	})
+	if err != nil {
+		return nil, false, fmt.Errorf("保存备份清单失败: %v", err)
+	}
+	return replaced, referenced, nil
+}
+
+// GetBackup 按备份文件名获取备份清单中的一项
+func (s *Store) GetBackup(name string) (*model.BackupEntry, error) {
+	var entry *model.BackupEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket(bucketBackups).Get([]byte(name))
+		if content == nil {
+			return fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+		}
+		var err error
+		entry, err = decodeBackup(content)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ListBackups 按文件名顺序列出备份清单
+func (s *Store) ListBackups() ([]*model.BackupEntry, error) {
+	entries := []*model.BackupEntry{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketBackups).ForEach(func(_, content []byte) error {
+			entry, err := decodeBackup(content)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取备份清单失败: %v", err)
+	}
+	return entries, nil
+}
+
+// DeleteBackup 从备份清单中删除一项，返回删除的项以及其他备份是否仍引用同一文件内容
+func (s *Store) DeleteBackup(name string) (*model.BackupEntry, bool, error) {
+	var entry *model.BackupEntry
+	referenced := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketBackups)
+		content := bucket.Get([]byte(name))
+		if content == nil {
+			return fmt.Errorf("%w: %s", ErrBackupNotFound, name)
+		}
+		var err error
+		if entry, err = decodeBackup(content); err != nil {
+			return err
+		}
+		if err := bucket.Delete([]byte(name)); err != nil {
+			return err
+		}
+		referenced, err = backupReferenced(bucket, entry.SHA256)
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return entry, referenced, nil
+}
+
+// backupReferenced 备份清单中是否有项引用摘要为hash的文件内容
+func backupReferenced(bucket *bolt.Bucket, hash string) (bool, error) {
+	referenced := false
+	err := bucket.ForEach(func(_, content []byte) error {
+		entry, err := decodeBackup(content)
+		if err != nil {
+			return err
+		}
+		if entry.SHA256 == hash {
+			referenced = true
+		}
+		return nil
+	})
+	return referenced, err
+}
+
+func decodeBackup(content []byte) (*model.BackupEntry, error) {
+	entry := &model.BackupEntry{}
+	if err := json.Unmarshal(content, entry); err != nil {
+		return nil, fmt.Errorf("解析备份清单失败: %v", err)
+	}
+	return entry, nil
+}
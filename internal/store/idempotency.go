@@ -0,0 +1,105 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"receipt/internal/model"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ClaimIdempotencyKey 占用幂等键：已有未过期的记录时返回该记录且不修改，否则保存record并返回nil
+//
+// 检查和保存在同一个写事务中完成，同一幂等键的并发请求只有一个能占用。
+func (s *Store) ClaimIdempotencyKey(record *model.IdempotencyRecord, now time.Time) (*model.IdempotencyRecord, error) {
+	var existing *model.IdempotencyRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketIdempotency)
+		if content := b.Get([]byte(record.Key)); content != nil {
+			found, err := decodeIdempotencyRecord(content)
+			if err != nil {
+				return err
+			}
+			if now.Before(found.ExpiresAt) {
+				existing = found
+				return nil
+			}
+		}
+		return putIdempotencyRecord(b, record)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("保存幂等记录失败: %v", err)
+	}
+	return existing, nil
+}
+
+// PutIdempotencyRecord 保存幂等记录，同一幂等键时覆盖
+func (s *Store) PutIdempotencyRecord(record *model.IdempotencyRecord) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return putIdempotencyRecord(tx.Bucket(bucketIdempotency), record)
+	})
+	if err != nil {
+		return fmt.Errorf("保存幂等记录失败: %v", err)
+	}
+	return nil
+}
+
+// DeleteIdempotencyRecord 删除幂等记录，不存在时不报错
+func (s *Store) DeleteIdempotencyRecord(key string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketIdempotency).Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("删除幂等记录失败: %v", err)
+	}
+	return nil
+}
+
+// PurgeIdempotencyRecords 删除在now之前过期的幂等记录，返回删除的条数
+func (s *Store) PurgeIdempotencyRecords(now time.Time) (int, error) {
+	var expired [][]byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketIdempotency)
+		err := b.ForEach(func(k, content []byte) error {
+			record, err := decodeIdempotencyRecord(content)
+			if err != nil {
+				return err
+			}
+			if !now.Before(record.ExpiresAt) {
+				expired = append(expired, append([]byte(nil), k...))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		// 遍历时不能修改bucket，遍历后再删除
+		for _, k := range expired {
+			if err := b.Delete(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("清理幂等记录失败: %v", err)
+	}
+	return len(expired), nil
+}
+
+func putIdempotencyRecord(b *bolt.Bucket, record *model.IdempotencyRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(record.Key), content)
+}
+
+func decodeIdempotencyRecord(content []byte) (*model.IdempotencyRecord, error) {
+	record := &model.IdempotencyRecord{}
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, fmt.Errorf("解析幂等记录失败: %v", err)
+	}
+	return record, nil
+}
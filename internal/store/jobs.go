@@ -0,0 +1,479 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"receipt/internal/model"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 任务错误
+var (
+	ErrJobNotFound       = errors.New("任务不存在")
+	ErrJobFinished       = errors.New("任务已结束")
+	ErrJobNotFinished    = errors.New("任务尚未结束")
+	ErrJobNothingToRetry = errors.New("任务没有可重试的项")
+)
+
+// CreateJob 保存新任务并加入队列
+func (s *Store) CreateJob(job *model.Job) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketJobs).Get([]byte(job.ID)) != nil {
+			return fmt.Errorf("任务编号已存在: %s", job.ID)
+		}
+		job.Status = model.JobStatusQueued
+		job.Tally()
+		if err := putJob(tx, job); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketJobQueue).Put([]byte(job.ID), nil)
+	})
+	if err != nil {
+		return fmt.Errorf("保存任务失败: %v", err)
+	}
+	return nil
+}
+
+// GetJob 按编号获取任务
+func (s *Store) GetJob(id string) (*model.Job, error) {
+	var job *model.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		job, err = loadJob(tx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// ListJobs 按提交时间倒序列出任务（不含任务项），返回当前页和总数
+func (s *Store) ListJobs(q *model.JobQuery) ([]*model.Job, int, error) {
+	var jobs []*model.Job
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJobs).ForEach(func(_, content []byte) error {
+			job, err := decodeJob(content)
+			if err != nil {
+				return err
+			}
+			if q.Status == "" || job.Status == q.Status {
+				jobs = append(jobs, job.Summary())
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询任务失败: %v", err)
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return jobs[i].ID > jobs[j].ID
+	})
+
+	total := len(jobs)
+	page, pageSize := q.Page, q.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*model.Job{}, total, nil
+	}
+	return jobs[start:min(start+pageSize, total)], total, nil
+}
+
+// ClaimJob 从队列中取出最早的任务并标记为执行中，队列为空时返回nil
+func (s *Store) ClaimJob() (*model.Job, error) {
+	var job *model.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		queue := tx.Bucket(bucketJobQueue)
+		id, _ := queue.Cursor().First()
+		if id == nil {
+			return nil
+		}
+		if err := queue.Delete(id); err != nil {
+			return err
+		}
+
+		var err error
+		if job, err = loadJobHeader(tx, string(id)); err != nil {
+			// 任务记录丢失时丢弃队列中的编号
+			if errors.Is(err, ErrJobNotFound) {
+				job = nil
+				return nil
+			}
+			return err
+		}
+		now := time.Now()
+		job.Status = model.JobStatusRunning
+		job.StartedAt = &now
+		if err := putJobHeader(tx, job); err != nil {
+			return err
+		}
+		job.Items, err = loadJobItems(tx, job.ID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取任务队列失败: %v", err)
+	}
+	return job, nil
+}
+
+// SaveJobItem 保存任务项的进度，返回任务是否已被请求取消
+//
+// 只写入该任务项并按状态变化更新任务的统计，不重写其他任务项。
+func (s *Store) SaveJobItem(id string, item *model.JobItem) (bool, error) {
+	var canceled bool
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		job, err := loadJobHeader(tx, id)
+		if err != nil {
+			return err
+		}
+		content := tx.Bucket(bucketJobItems).Get(jobItemKey(id, item.Index))
+		if content == nil {
+			return fmt.Errorf("任务项不存在: %d", item.Index)
+		}
+		previous, err := decodeJobItem(content)
+		if err != nil {
+			return err
+		}
+
+		if err := putJobItem(tx, id, item); err != nil {
+			return err
+		}
+		if previous.Status != item.Status {
+			job.Retally(previous.Status, item.Status)
+			if err := putJobHeader(tx, job); err != nil {
+				return err
+			}
+		}
+		canceled = job.CancelRequested
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return canceled, nil
+}
+
+// FinishJob 结束执行中的任务：已请求取消时未生成的项记为取消，否则按结果记为完成或失败
+func (s *Store) FinishJob(id string) (*model.Job, error) {
+	var job *model.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = loadJobHeader(tx, id); err != nil {
+			return err
+		}
+		now := time.Now()
+		job.FinishedAt = &now
+		if job.CancelRequested {
+			if job.Items, err = loadJobItems(tx, id); err != nil {
+				return err
+			}
+			cancelJob(job)
+			return putJob(tx, job)
+		}
+		if job.Succeeded > 0 {
+			job.Status = model.JobStatusCompleted
+		} else {
+			job.Status = model.JobStatusFailed
+		}
+		return putJobHeader(tx, job)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// CancelJob 取消任务：排队中的任务立即取消，执行中的任务在当前一项完成后停止
+func (s *Store) CancelJob(id string) (*model.Job, error) {
+	var job *model.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = loadJob(tx, id); err != nil {
+			return err
+		}
+		switch {
+		case job.Finished():
+			return fmt.Errorf("%w: %s", ErrJobFinished, job.Status)
+		case job.Status == model.JobStatusQueued:
+			if err := tx.Bucket(bucketJobQueue).Delete([]byte(id)); err != nil {
+				return err
+			}
+			now := time.Now()
+			job.FinishedAt = &now
+			cancelJob(job)
+			return putJob(tx, job)
+		default:
+			job.CancelRequested = true
+			return putJobHeader(tx, job)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RetryJob 将已结束任务中生成失败和取消的项重新加入队列，校验失败的项不重试
+func (s *Store) RetryJob(id string) (*model.Job, error) {
+	var job *model.Job
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		if job, err = loadJob(tx, id); err != nil {
+			return err
+		}
+		if !job.Finished() {
+			return fmt.Errorf("%w: %s", ErrJobNotFinished, job.Status)
+		}
+
+		retried := 0
+		for _, item := range job.Items {
+			if item.Request == nil || (item.Status != model.JobItemFailed && item.Status != model.JobItemCanceled) {
+				continue
+			}
+			item.Status = model.JobItemPending
+			item.Message = ""
+			retried++
+		}
+		if retried == 0 {
+			return ErrJobNothingToRetry
+		}
+
+		job.Status = model.JobStatusQueued
+		job.CancelRequested = false
+		job.FinishedAt = nil
+		job.Tally()
+		if err := putJob(tx, job); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketJobQueue).Put([]byte(id), nil)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// RecoverJobs 服务启动时将上次退出时仍在执行的任务重新加入队列，已请求取消的直接取消，返回重新加入队列的任务数
+func (s *Store) RecoverJobs() (int, error) {
+	recovered := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var running []*model.Job
+		err := tx.Bucket(bucketJobs).ForEach(func(_, content []byte) error {
+			job, err := decodeJob(content)
+			if err != nil {
+				return err
+			}
+			if job.Status == model.JobStatusRunning {
+				running = append(running, job)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, job := range running {
+			if !job.CancelRequested {
+				job.Status = model.JobStatusQueued
+				if err := tx.Bucket(bucketJobQueue).Put([]byte(job.ID), nil); err != nil {
+					return err
+				}
+				recovered++
+				if err := putJobHeader(tx, job); err != nil {
+					return err
+				}
+				continue
+			}
+			if job.Items, err = loadJobItems(tx, job.ID); err != nil {
+				return err
+			}
+			now := time.Now()
+			job.FinishedAt = &now
+			cancelJob(job)
+			if err := putJob(tx, job); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("恢复任务失败: %v", err)
+	}
+	return recovered, nil
+}
+
+// cancelJob 将任务标记为已取消，尚未生成的项记为取消
+func cancelJob(job *model.Job) {
+	for _, item := range job.Items {
+		if item.Status == model.JobItemPending {
+			item.Status = model.JobItemCanceled
+			item.Message = "任务已取消"
+		}
+	}
+	job.Status = model.JobStatusCanceled
+	job.CancelRequested = false
+	job.Tally()
+}
+
+// ExpiredJobs 返回在before之前结束的任务编号，按编号顺序
+func (s *Store) ExpiredJobs(before time.Time) ([]string, error) {
+	var ids []string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketJobs).ForEach(func(k, content []byte) error {
+			job, err := decodeJob(content)
+			if err != nil {
+				return err
+			}
+			if job.Finished() && job.FinishedAt != nil && job.FinishedAt.Before(before) {
+				ids = append(ids, string(k))
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询任务失败: %v", err)
+	}
+	return ids, nil
+}
+
+// DeleteJob 删除已结束的任务及其任务项，任务不存在时不报错
+func (s *Store) DeleteJob(id string) error {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		job, err := loadJobHeader(tx, id)
+		if errors.Is(err, ErrJobNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !job.Finished() {
+			return fmt.Errorf("%w: %s", ErrJobNotFinished, job.Status)
+		}
+		if err := deleteJobItems(tx, id); err != nil {
+			return err
+		}
+		return tx.Bucket(bucketJobs).Delete([]byte(id))
+	})
+	if err != nil && !errors.Is(err, ErrJobNotFinished) {
+		return fmt.Errorf("删除任务失败: %v", err)
+	}
+	return err
+}
+
+// loadJob 在事务中读取任务及全部任务项
+func loadJob(tx *bolt.Tx, id string) (*model.Job, error) {
+	job, err := loadJobHeader(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Items, err = loadJobItems(tx, id); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// loadJobHeader 在事务中读取任务，不含任务项
+func loadJobHeader(tx *bolt.Tx, id string) (*model.Job, error) {
+	content := tx.Bucket(bucketJobs).Get([]byte(id))
+	if content == nil {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return decodeJob(content)
+}
+
+// loadJobItems 按序号读取任务的全部任务项
+func loadJobItems(tx *bolt.Tx, id string) ([]*model.JobItem, error) {
+	var items []*model.JobItem
+	prefix := []byte(id + "/")
+	c := tx.Bucket(bucketJobItems).Cursor()
+	for k, content := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, content = c.Next() {
+		item, err := decodeJobItem(content)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// deleteJobItems 删除任务的全部任务项
+func deleteJobItems(tx *bolt.Tx, id string) error {
+	var keys [][]byte
+	prefix := []byte(id + "/")
+	c := tx.Bucket(bucketJobItems).Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		if err := tx.Bucket(bucketJobItems).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jobItemKey 任务项的键，序号补零使同一任务的任务项按序号排列
+func jobItemKey(id string, index int) []byte {
+	return []byte(fmt.Sprintf("%s/%08d", id, index))
+}
+
+func decodeJob(content []byte) (*model.Job, error) {
+	job := &model.Job{}
+	if err := json.Unmarshal(content, job); err != nil {
+		return nil, fmt.Errorf("解析任务失败: %v", err)
+	}
+	return job, nil
+}
+
+func decodeJobItem(content []byte) (*model.JobItem, error) {
+	item := &model.JobItem{}
+	if err := json.Unmarshal(content, item); err != nil {
+		return nil, fmt.Errorf("解析任务项失败: %v", err)
+	}
+	return item, nil
+}
+
+// putJob 保存任务及全部任务项，用于新建任务和同时修改多个任务项
+func putJob(tx *bolt.Tx, job *model.Job) error {
+	if err := deleteJobItems(tx, job.ID); err != nil {
+		return err
+	}
+	for _, item := range job.Items {
+		if err := putJobItem(tx, job.ID, item); err != nil {
+			return err
+		}
+	}
+	return putJobHeader(tx, job)
+}
+
+// putJobHeader 只保存任务本身，任务项不变
+func putJobHeader(tx *bolt.Tx, job *model.Job) error {
+	content, err := json.Marshal(job.Summary())
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketJobs).Put([]byte(job.ID), content)
+}
+
+func putJobItem(tx *bolt.Tx, id string, item *model.JobItem) error {
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(bucketJobItems).Put(jobItemKey(id, item.Index), content)
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"errors"
+	"path/filepath"
+	"receipt/internal/model"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "receipt.db")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, path
+}
+
+func newTestJob(id string, n int) *model.Job {
+	job := &model.Job{ID: id, Kind: model.JobKindBatch, Output: "zip", Format: "pdf", CreatedAt: time.Now()}
+	for i := 0; i < n; i++ {
+		item := &model.JobItem{Status: model.JobItemPending, Request: &model.ReceiptRequest{}}
+		item.Index = i
+		job.Items = append(job.Items, item)
+	}
+	return job
+}
+
+func TestSaveJobItemUpdatesCounters(t *testing.T) {
+	s, _ := openTestStore(t)
+	if err := s.CreateJob(newTestJob("job1", 3)); err != nil {
+		t.Fatal(err)
+	}
+	job, err := s.ClaimJob()
+	if err != nil || job == nil {
+		t.Fatalf("ClaimJob = %v, %v", job, err)
+	}
+
+	// 先保存编号（状态不变），再保存结果
+	job.Items[0].ReceiptID = "NO1"
+	if _, err := s.SaveJobItem(job.ID, job.Items[0]); err != nil {
+		t.Fatal(err)
+	}
+	job.Items[0].Status = model.JobItemSucceeded
+	if _, err := s.SaveJobItem(job.ID, job.Items[0]); err != nil {
+		t.Fatal(err)
+	}
+	job.Items[1].Status = model.JobItemFailed
+	if _, err := s.SaveJobItem(job.ID, job.Items[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.GetJob(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Total != 3 || got.Processed != 2 || got.Succeeded != 1 || got.Failed != 1 {
+		t.Errorf("counters = %d/%d/%d/%d, want 3/2/1/1", got.Total, got.Processed, got.Succeeded, got.Failed)
+	}
+	if len(got.Items) != 3 || got.Items[0].ReceiptID != "NO1" || got.Items[2].Status != model.JobItemPending {
+		t.Errorf("items not saved individually: %+v", got.Items)
+	}
+
+	// 任务记录本身不含任务项
+	s.db.View(func(tx *bolt.Tx) error {
+		header, _ := decodeJob(tx.Bucket(bucketJobs).Get([]byte(job.ID)))
+		if len(header.Items) != 0 {
+			t.Errorf("job header stores %d items", len(header.Items))
+		}
+		return nil
+	})
+}
+
+func TestDeleteJob(t *testing.T) {
+	s, _ := openTestStore(t)
+	if err := s.CreateJob(newTestJob("job1", 2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteJob("job1"); !errors.Is(err, ErrJobNotFinished) {
+		t.Fatalf("DeleteJob(queued) = %v, want ErrJobNotFinished", err)
+	}
+
+	if _, err := s.CancelJob("job1"); err != nil {
+		t.Fatal(err)
+	}
+	ids, err := s.ExpiredJobs(time.Now().Add(time.Minute))
+	if err != nil || len(ids) != 1 || ids[0] != "job1" {
+		t.Fatalf("ExpiredJobs = %v, %v", ids, err)
+	}
+	if ids, _ := s.ExpiredJobs(time.Now().Add(-time.Minute)); len(ids) != 0 {
+		t.Errorf("ExpiredJobs before finish = %v", ids)
+	}
+
+	if err := s.DeleteJob("job1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetJob("job1"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("GetJob after delete = %v", err)
+	}
+	s.db.View(func(tx *bolt.Tx) error {
+		if k, _ := tx.Bucket(bucketJobItems).Cursor().First(); k != nil {
+			t.Errorf("job item %s left after delete", k)
+		}
+		return nil
+	})
+	if err := s.DeleteJob("job1"); err != nil {
+		t.Errorf("DeleteJob(missing) = %v", err)
+	}
+}
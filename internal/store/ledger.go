@@ -0,0 +1,153 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"receipt/internal/model"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// LedgerEntries 按序号顺序读取开具记录
+func (s *Store) LedgerEntries(fn func(entry *model.LedgerEntry) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketLedger).ForEach(func(_, content []byte) error {
+			entry, err := decodeLedgerEntry(content)
+			if err != nil {
+				return err
+			}
+			return fn(entry)
+		})
+	})
+}
+
+// LedgerSnapshot 在同一个读事务中读取全部开具记录和收据登记记录，用于相互比对
+func (s *Store) LedgerSnapshot() ([]*model.LedgerEntry, []*model.ReceiptRecord, error) {
+	var entries []*model.LedgerEntry
+	var records []*model.ReceiptRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		// 只读打开的数据库不会创建缺少的bucket
+		if tx.Bucket(bucketLedger) == nil || tx.Bucket(bucketReceipts) == nil {
+			return fmt.Errorf("数据库中没有开具记录，可能不是收据数据库或尚未启动过服务")
+		}
+		err := tx.Bucket(bucketLedger).ForEach(func(_, content []byte) error {
+			entry, err := decodeLedgerEntry(content)
+			if err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(bucketReceipts).ForEach(func(_, content []byte) error {
+			record, err := decodeRecord(content)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取开具记录失败: %v", err)
+	}
+	return entries, records, nil
+}
+
+// appendLedger 在写事务中追加一条开具记录，序号、prev_hash和哈希接在最后一条之后
+func appendLedger(tx *bolt.Tx, entry *model.LedgerEntry) error {
+	b := tx.Bucket(bucketLedger)
+	entry.Seq, entry.PrevHash = 1, model.LedgerGenesisHash
+	if _, content := b.Cursor().Last(); content != nil {
+		last, err := decodeLedgerEntry(content)
+		if err != nil {
+			return err
+		}
+		entry.Seq, entry.PrevHash = last.Seq+1, last.Hash
+	}
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+	entry.Timestamp = entry.Timestamp.UTC()
+	entry.Hash = entry.ComputeHash()
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, entry.Seq)
+	return b.Put(key, content)
+}
+
+// ledgerEntry 按收据记录创建开具记录，未设置序号和哈希
+func ledgerEntry(event string, record *model.ReceiptRecord, documentHash, detail string) *model.LedgerEntry {
+	return &model.LedgerEntry{
+		Event:        event,
+		ReceiptID:    record.ID,
+		Amount:       record.Rent,
+		Payer:        record.Payer,
+		DocumentHash: documentHash,
+		Detail:       detail,
+	}
+}
+
+// backfillLedger 启用开具记录时为已登记的收据补记开具、生成文件和作废记录，按发生时间排列
+func backfillLedger(tx *bolt.Tx) error {
+	var entries []*model.LedgerEntry
+	err := tx.Bucket(bucketReceipts).ForEach(func(_, content []byte) error {
+		record, err := decodeRecord(content)
+		if err != nil {
+			return err
+		}
+		for i, file := range record.Files {
+			event := model.LedgerFile
+			if i == 0 {
+				event = model.LedgerIssue
+			}
+			entry := ledgerEntry(event, record, file.SHA256, "补记")
+			entry.Timestamp = file.CreatedAt
+			if i == 0 && record.Replaces != "" {
+				entry.Detail = "补记，替代 " + record.Replaces
+			}
+			entries = append(entries, entry)
+		}
+		if len(record.Files) == 0 {
+			entry := ledgerEntry(model.LedgerIssue, record, "", "补记")
+			entry.Timestamp = record.CreatedAt
+			entries = append(entries, entry)
+		}
+		if record.Voided() && record.VoidedAt != nil {
+			entry := ledgerEntry(model.LedgerVoid, record, "", "补记，"+record.VoidReason)
+			entry.Timestamp = *record.VoidedAt
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+	for _, entry := range entries {
+		if err := appendLedger(tx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeLedgerEntry(content []byte) (*model.LedgerEntry, error) {
+	entry := &model.LedgerEntry{}
+	if err := json.Unmarshal(content, entry); err != nil {
+		return nil, fmt.Errorf("解析开具记录失败: %v", err)
+	}
+	return entry, nil
+}
@@ -0,0 +1,340 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"receipt/internal/model"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// 分页默认值
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// 收据登记错误
+var (
+	ErrReceiptNotFound = errors.New("收据不存在")
+	ErrReceiptVoided   = errors.New("收据已作废")
+	ErrReceiptReplaced = errors.New("收据已重开")
+)
+
+// RecordReceipt 登记收据及本次生成的文件；同一编号再次生成文件时只追加文件信息
+//
+// 登记和追加开具记录在同一个写事务中完成。
+func (s *Store) RecordReceipt(data *model.ReceiptData, file model.ReceiptFile) error {
+	if data.ID == "" {
+		return fmt.Errorf("登记收据失败: 收据编号为空")
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketReceipts)
+
+		event := model.LedgerIssue
+		record := &model.ReceiptRecord{ReceiptData: *data, Status: model.ReceiptStatusIssued}
+		if existing := b.Get([]byte(data.ID)); existing != nil {
+			var err error
+			if record, err = decodeRecord(existing); err != nil {
+				return err
+			}
+			event = model.LedgerFile
+		}
+		record.Files = append(record.Files, file)
+		if err := putRecord(b, record); err != nil {
+			return err
+		}
+		return appendLedger(tx, ledgerEntry(event, record, file.SHA256, ""))
+	})
+	if err != nil {
+		return fmt.Errorf("登记收据失败: %v", err)
+	}
+	return nil
+}
+
+// GetReceipt 按编号获取收据记录
+func (s *Store) GetReceipt(id string) (*model.ReceiptRecord, error) {
+	var record *model.ReceiptRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		content := tx.Bucket(bucketReceipts).Get([]byte(id))
+		if content == nil {
+			return fmt.Errorf("%w: %s", ErrReceiptNotFound, id)
+		}
+		var err error
+		record, err = decodeRecord(content)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// FindReceiptByFile 按备份文件名查找收据记录
+func (s *Store) FindReceiptByFile(fileName string) (*model.ReceiptRecord, error) {
+	var found *model.ReceiptRecord
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReceipts).ForEach(func(_, content []byte) error {
+			if found != nil {
+				return nil
+			}
+			record, err := decodeRecord(content)
+			if err != nil {
+				return err
+			}
+			for _, file := range record.Files {
+				if file.FileName == fileName {
+					found = record
+					return nil
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询收据失败: %v", err)
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: %s", ErrReceiptNotFound, fileName)
+	}
+	return found, nil
+}
+
+// VoidReceipt 作废收据，作废后的记录仍然保留
+func (s *Store) VoidReceipt(id, reason string) (*model.ReceiptRecord, error) {
+	var record *model.ReceiptRecord
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketReceipts)
+		var err error
+		if record, err = loadRecord(b, id); err != nil {
+			return err
+		}
+		if record.Voided() {
+			return fmt.Errorf("%w: %s", ErrReceiptVoided, id)
+		}
+		voidRecord(record, reason)
+		if err := putRecord(b, record); err != nil {
+			return err
+		}
+		return appendLedger(tx, ledgerEntry(model.LedgerVoid, record, "", reason))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+// ReissueReceipt 登记重开的收据并与原收据互相关联
+//
+// 原收据尚未作废时以reason一并作废；原收据已被重开过时返回ErrReceiptReplaced。
+// 作废原收据、登记新收据以及追加开具记录在同一个写事务中完成。
+func (s *Store) ReissueReceipt(originalID, reason string, data *model.ReceiptData, file model.ReceiptFile) (original, replacement *model.ReceiptRecord, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketReceipts)
+		var err error
+		if original, err = loadRecord(b, originalID); err != nil {
+			return err
+		}
+		if original.ReplacedBy != "" {
+			return fmt.Errorf("%w: %s 已由 %s 替代", ErrReceiptReplaced, originalID, original.ReplacedBy)
+		}
+		if b.Get([]byte(data.ID)) != nil {
+			return fmt.Errorf("收据编号已存在: %s", data.ID)
+		}
+
+		if !original.Voided() {
+			voidRecord(original, reason)
+			if err := appendLedger(tx, ledgerEntry(model.LedgerVoid, original, "", reason)); err != nil {
+				return err
+			}
+		}
+		original.ReplacedBy = data.ID
+
+		replacement = &model.ReceiptRecord{
+			ReceiptData: *data,
+			Files:       []model.ReceiptFile{file},
+			Status:      model.ReceiptStatusIssued,
+			Replaces:    originalID,
+		}
+		if err := putRecord(b, original); err != nil {
+			return err
+		}
+		if err := putRecord(b, replacement); err != nil {
+			return err
+		}
+		return appendLedger(tx, ledgerEntry(model.LedgerIssue, replacement, file.SHA256, "替代 "+originalID))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return original, replacement, nil
+}
+
+// ListReceipts 按条件查询收据，返回当前页的记录和符合条件的总数
+//
+// 查询遍历全部记录后在内存中过滤和排序，适用于单个部署数万张收据以内的规模。
+func (s *Store) ListReceipts(q *model.ReceiptQuery) ([]*model.ReceiptRecord, int, error) {
+	minAmount, maxAmount, err := q.AmountRange()
+	if err != nil {
+		return nil, 0, err
+	}
+	dateFrom, dateTo, err := q.DateRange()
+	if err != nil {
+		return nil, 0, err
+	}
+	month := normalizeMonth(q.Month)
+
+	var records []*model.ReceiptRecord
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucketReceipts).ForEach(func(_, content []byte) error {
+			record, err := decodeRecord(content)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case q.RoomNumber != "" && record.RoomNumber != q.RoomNumber,
+				q.Payer != "" && !strings.Contains(record.Payer, q.Payer),
+				q.Recipient != "" && !strings.Contains(record.Recipient, q.Recipient),
+				q.Status != "" && record.Status != q.Status,
+				month != "" && normalizeMonth(record.Month) != month,
+				dateFrom != "" && !dateAtLeast(record.Date, dateFrom),
+				dateTo != "" && !dateAtMost(record.Date, dateTo),
+				minAmount != nil && record.Rent < *minAmount,
+				maxAmount != nil && record.Rent > *maxAmount:
+				return nil
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("查询收据失败: %v", err)
+	}
+
+	sortReceipts(records, q.Sort, q.Order != "asc")
+
+	total := len(records)
+	page, pageSize := q.Page, q.PageSize
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	start := (page - 1) * pageSize
+	if start >= total {
+		return []*model.ReceiptRecord{}, total, nil
+	}
+	end := start + pageSize
+	if end > total {
+		end = total
+	}
+	return records[start:end], total, nil
+}
+
+// loadRecord 在事务中读取收据记录
+func loadRecord(b *bolt.Bucket, id string) (*model.ReceiptRecord, error) {
+	content := b.Get([]byte(id))
+	if content == nil {
+		return nil, fmt.Errorf("%w: %s", ErrReceiptNotFound, id)
+	}
+	return decodeRecord(content)
+}
+
+// decodeRecord 解析收据记录，早期登记的记录没有状态，视为已开具
+func decodeRecord(content []byte) (*model.ReceiptRecord, error) {
+	record := &model.ReceiptRecord{}
+	if err := json.Unmarshal(content, record); err != nil {
+		return nil, fmt.Errorf("解析收据记录失败: %v", err)
+	}
+	if record.Status == "" {
+		record.Status = model.ReceiptStatusIssued
+	}
+	return record, nil
+}
+
+func putRecord(b *bolt.Bucket, record *model.ReceiptRecord) error {
+	content, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return b.Put([]byte(record.ID), content)
+}
+
+func voidRecord(record *model.ReceiptRecord, reason string) {
+	now := time.Now()
+	record.Status = model.ReceiptStatusVoided
+	record.VoidedAt = &now
+	record.VoidReason = reason
+}
+
+// sortReceipts 按字段排序，相同时按编号排序以保证分页稳定
+func sortReceipts(records []*model.ReceiptRecord, field string, desc bool) {
+	less := func(a, b *model.ReceiptRecord) bool {
+		switch field {
+		case "date":
+			if da, db := normalizeDate(a.Date), normalizeDate(b.Date); da != db {
+				return da < db
+			}
+		case "amount":
+			if a.Rent != b.Rent {
+				return a.Rent < b.Rent
+			}
+		case "room_number":
+			if a.RoomNumber != b.RoomNumber {
+				return a.RoomNumber < b.RoomNumber
+			}
+		case "id":
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		}
+		return a.ID < b.ID
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		if desc {
+			return less(records[j], records[i])
+		}
+		return less(records[i], records[j])
+	})
+}
+
+// normalizeDate 将日期统一为 YYYY-MM-DD 以便比较，无法识别时原样返回
+func normalizeDate(date string) string {
+	if normalized, err := model.NormalizeDate(date); err == nil {
+		return normalized
+	}
+	return date
+}
+
+// dateAtLeast 收据日期是否不早于from，无法识别的日期不在任何日期范围内
+func dateAtLeast(date, from string) bool {
+	d, err := model.NormalizeDate(date)
+	return err == nil && d >= from
+}
+
+// dateAtMost 收据日期是否不晚于to，无法识别的日期不在任何日期范围内
+func dateAtMost(date, to string) bool {
+	d, err := model.NormalizeDate(date)
+	return err == nil && d <= to
+}
+
+// normalizeMonth 将月份统一为 YYYYMM，无法识别时原样返回
+func normalizeMonth(month string) string {
+	if normalized, err := model.NormalizeMonth(month); err == nil {
+		return normalized
+	}
+	return month
+}
@@ -0,0 +1,51 @@
+package store
+
+import (
+	"receipt/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestListReceiptsMixedDateFormats(t *testing.T) {
+	s, _ := openTestStore(t)
+	for id, date := range map[string]string{
+		"A": "2025-9-5",
+		"B": "2025/09/20",
+		"C": "2025年10月1日",
+		"D": "2025-08-31",
+		"E": "20250910",
+	} {
+		data := &model.ReceiptData{ID: id, RoomNumber: "101", Date: date, Month: "2025年9月"}
+		if err := s.RecordReceipt(data, model.NewReceiptFile("pdf", "", []byte(id))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ids := func(records []*model.ReceiptRecord) string {
+		var out []string
+		for _, r := range records {
+			out = append(out, r.ID)
+		}
+		return strings.Join(out, ",")
+	}
+
+	records, _, err := s.ListReceipts(&model.ReceiptQuery{DateFrom: "2025年9月1日", DateTo: "2025/9/30", Sort: "date", Order: "asc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(records); got != "A,E,B" {
+		t.Errorf("September receipts = %s, want A,E,B", got)
+	}
+
+	records, _, err = s.ListReceipts(&model.ReceiptQuery{Sort: "date", Order: "desc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(records); got != "C,B,E,A,D" {
+		t.Errorf("sorted by date = %s, want C,B,E,A,D", got)
+	}
+
+	if _, _, err := s.ListReceipts(&model.ReceiptQuery{DateFrom: "九月"}); err == nil {
+		t.Error("unparseable date_from accepted")
+	}
+}
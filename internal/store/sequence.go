@@ -0,0 +1,71 @@
+package store
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// maxNumberAttempts 单次分配时跳过已占用编号的最大次数
+const maxNumberAttempts = 1000
+
+// AllocateNumber 在指定作用域内分配下一个序号，并用format生成编号
+//
+// 序号递增和编号登记在同一个写事务中完成，并发请求不会得到相同的编号；如果生成的
+// 编号已被其他作用域占用（如 {room}{seq} 中 1+11 与 11+1），则继续递增直到不冲突。
+// 事务提交后编号即持久化，即使后续生成收据失败也不会回收，因此序号可能不连续但绝不重复。
+func (s *Store) AllocateNumber(scope string, format func(seq int64) string) (string, error) {
+	var number string
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		sequences := tx.Bucket(bucketSequences)
+		numbers := tx.Bucket(bucketNumbers)
+
+		seq := decodeSequence(sequences.Get([]byte(scope)))
+		for attempt := 0; ; attempt++ {
+			if attempt >= maxNumberAttempts {
+				return fmt.Errorf("作用域%s中没有可用的编号", scope)
+			}
+			seq++
+			number = format(int64(seq))
+			if numbers.Get([]byte(number)) == nil {
+				break
+			}
+		}
+
+		if err := numbers.Put([]byte(number), []byte(scope)); err != nil {
+			return err
+		}
+		return sequences.Put([]byte(scope), encodeSequence(seq))
+	})
+	if err != nil {
+		return "", fmt.Errorf("写入编号序列失败: %v", err)
+	}
+	return number, nil
+}
+
+// CurrentSequence 返回指定作用域最近分配的序号，未分配过时为0
+func (s *Store) CurrentSequence(scope string) (int64, error) {
+	var seq uint64
+	err := s.db.View(func(tx *bolt.Tx) error {
+		seq = decodeSequence(tx.Bucket(bucketSequences).Get([]byte(scope)))
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("读取序号失败: %v", err)
+	}
+	return int64(seq), nil
+}
+
+func encodeSequence(seq uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, seq)
+	return b
+}
+
+func decodeSequence(b []byte) uint64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
@@ -0,0 +1,30 @@
+package store
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Secret 返回指定名称的随机密钥，首次调用时生成size字节并保存，之后重启仍返回同一密钥
+func (s *Store) Secret(name string, size int) ([]byte, error) {
+	var secret []byte
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(bucketSettings)
+		if existing := b.Get([]byte(name)); existing != nil {
+			secret = append([]byte(nil), existing...)
+			return nil
+		}
+
+		secret = make([]byte, size)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		return b.Put([]byte(name), secret)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥失败: %v", err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// bucketSequences 编号序列：键为序列作用域，值为大端序的当前序号
+	bucketSequences = []byte("sequences")
+	// bucketNumbers 已分配的收据编号：键为编号，值为所属作用域
+	bucketNumbers = []byte("numbers")
+	// bucketReceipts 收据登记记录：键为收据编号，值为JSON格式的 model.ReceiptRecord
+	bucketReceipts = []byte("receipts")
+	// bucketSettings 服务内部设置，如收据校验密钥：键为设置名称
+	bucketSettings = []byte("settings")
+	// bucketJobs 异步任务：键为任务编号，值为JSON格式的 model.Job，不含任务项
+	bucketJobs = []byte("jobs")
+	// bucketJobItems 异步任务的任务项：键为 <任务编号>/<8位序号>，值为JSON格式的 model.JobItem
+	bucketJobItems = []byte("job_items")
+	// bucketJobQueue 等待执行的任务：键为任务编号，按编号（提交时间）顺序执行
+	bucketJobQueue = []byte("job_queue")
+	// bucketBackups 备份清单：键为备份文件名，值为JSON格式的 model.BackupEntry
+	bucketBackups = []byte("backups")
+	// bucketLedger 收据开具记录：键为大端序的序号，值为JSON格式的 model.LedgerEntry，只追加不修改
+	bucketLedger = []byte("ledger")
+	// bucketIdempotency 生成接口的幂等记录：键为幂等键，值为JSON格式的 model.IdempotencyRecord
+	bucketIdempotency = []byte("idempotency")
+)
+
+// Store 基于BoltDB的嵌入式存储，单个数据库文件保存编号序列、收据登记记录、开具记录、异步任务、备份清单和幂等记录
+//
+// BoltDB的写事务串行执行并在提交时落盘，同一数据库文件只能被一个进程打开。
+type Store struct {
+	db *bolt.DB
+}
+
+// Open 打开或创建数据库文件
+func Open(path string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("创建数据目录失败: %v", err)
+	}
+
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 3 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketSequences, bucketNumbers, bucketReceipts, bucketSettings, bucketJobs, bucketJobItems, bucketJobQueue, bucketBackups, bucketIdempotency} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		// 首次启用开具记录时为已登记的收据补记
+		if tx.Bucket(bucketLedger) != nil {
+			return nil
+		}
+		if _, err := tx.CreateBucket(bucketLedger); err != nil {
+			return err
+		}
+		return backfillLedger(tx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("初始化数据库失败: %v", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// OpenReadOnly 以只读方式打开已有的数据库文件，不创建文件和bucket，用于校验等只读的命令
+//
+// 文件不存在时返回错误，避免路径写错时校验一个空数据库。
+func OpenReadOnly(path string) (*Store, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %v", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 3 * time.Second, ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("打开数据库失败: %v", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// Close 关闭数据库
+func (s *Store) Close() error {
+	return s.db.Close()
+}
@@ -22,9 +22,6 @@ if [ ! -f "templates/receipt_template.pdf" ]; then
     echo "参考 templates/README.md 了解模板要求"
 fi
 
-# 创建输出目录
-mkdir -p output
-
 # 安装依赖
 echo "📦 安装依赖..."
 go mod tidy